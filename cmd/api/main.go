@@ -6,16 +6,25 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 
+	"github.com/srypher/mural-challenge-backend/internal/auth"
 	"github.com/srypher/mural-challenge-backend/internal/handlers"
+	"github.com/srypher/mural-challenge-backend/internal/merchanthooks"
 	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
 	"github.com/srypher/mural-challenge-backend/internal/mural"
+	"github.com/srypher/mural-challenge-backend/internal/payments"
+	"github.com/srypher/mural-challenge-backend/internal/pubsub"
 	"github.com/srypher/mural-challenge-backend/internal/storage"
+	"github.com/srypher/mural-challenge-backend/internal/webhooks"
+	"github.com/srypher/mural-challenge-backend/internal/workflow"
 )
 
 func main() {
@@ -37,7 +46,7 @@ func main() {
 	// For this demo image, start from a clean slate on each container start so
 	// repeated $1 test payments are easier to reason about.
 	if strings.ToLower(os.Getenv("RESET_ORDERS_ON_START")) == "true" {
-		if _, err := db.Pool.Exec(ctx, "TRUNCATE TABLE orders"); err != nil {
+		if _, err := db.Pool.Exec(ctx, "TRUNCATE TABLE orders CASCADE"); err != nil {
 			log.Printf("failed to truncate orders table: %v", err)
 		} else {
 			log.Printf("orders table truncated on startup")
@@ -49,6 +58,10 @@ func main() {
 		APIKey:      os.Getenv("MURAL_API_KEY"),
 		TransferKey: os.Getenv("MURAL_TRANSFER_KEY"),
 		// OrganizationID and AccountID will be derived automatically when possible.
+		Timeout: getEnvDuration("MURAL_TIMEOUT", 15*time.Second),
+		Retry: mural.RetryPolicy{
+			MaxAttempts: getEnvInt("MURAL_MAX_ATTEMPTS", mural.DefaultRetryPolicy.MaxAttempts),
+		},
 	})
 	if err != nil {
 		log.Fatalf("mural client init: %v", err)
@@ -61,8 +74,102 @@ func main() {
 	}
 
 	orderStore := models.NewOrderStore(db.Pool)
+	// Order event streams are woken by changes made here and, through
+	// LISTEN/NOTIFY, by every other replica.
+	broker := pubsub.NewBroker()
 
-	app := handlers.NewApp(orderStore, muralClient, backendBaseURL, useWebhooks)
+	// Payment lifecycles are persisted as workflow runs; any run left in flight
+	// by a previous process is resumed as soon as the engine starts polling.
+	engine := workflow.NewEngine(models.NewWorkflowStore(db.Pool), workflow.Config{})
+	var detector payments.Detector = payments.NewPayinDetector(muralClient)
+	if strings.ToLower(getEnv("PAYMENT_DETECTOR", "payins")) == "transactions" {
+		// Some sandboxes return empty Payins search results; fall back to
+		// inspecting account transactions there.
+		detector = payments.NewTransactionDetector(muralClient)
+	}
+	depositStore := models.NewDepositStore(db.Pool)
+	ledger := payments.NewLedger(orderStore, depositStore, detector,
+		getEnvDecimal("PAYMENT_TOLERANCE", payments.DefaultTolerance))
+	destinationStore := models.NewDestinationStore(db.Pool)
+	quoter := payments.NewQuoter(orderStore, destinationStore, muralClient,
+		getEnvDuration("QUOTE_TTL", payments.DefaultQuoteTTL),
+		getEnvDecimal("MAX_RATE_DRIFT", payments.DefaultMaxRateDrift))
+	payments.NewLifecycle(orderStore, destinationStore, muralClient, quoter).Register(engine)
+	pricer := payments.NewPricer(quoter, destinationStore, payments.PricingConfig{
+		MarkupRate:      getEnvDecimal("PRICING_MARKUP_RATE", money.Decimal{}),
+		PassThroughFees: strings.ToLower(getEnv("PASS_THROUGH_MURAL_FEES", "true")) == "true",
+		PlatformFeeRate: getEnvDecimal("PLATFORM_FEE_RATE", money.Decimal{}),
+		PlatformFeeUSDC: getEnvDecimal("PLATFORM_FEE_USDC", money.Decimal{}),
+	})
+
+	productStore := models.NewProductStore(db.Pool)
+	idempotencyStore := models.NewIdempotencyStore(db.Pool)
+	refundStore := models.NewRefundStore(db.Pool)
+	refunds := payments.NewRefunds(refundStore, orderStore, muralClient,
+		getEnvDuration("REFUND_SWEEP_INTERVAL", payments.DefaultRefundSweepInterval))
+
+	dispatcher := webhooks.NewDispatcher(models.NewWebhookEventStore(db.Pool))
+	payments.NewEventHandlers(orderStore, ledger, refunds, muralClient).Register(dispatcher)
+	var verifier *webhooks.Verifier
+	if key := os.Getenv("MURAL_WEBHOOK_PUBLIC_KEY"); key != "" {
+		verifier, err = webhooks.NewVerifier(key, getEnvDuration("MURAL_WEBHOOK_MAX_AGE", webhooks.DefaultMaxAge))
+		if err != nil {
+			log.Fatalf("webhook verifier init: %v", err)
+		}
+	}
+
+	// Merchant webhook events are written to an outbox with the order change
+	// they announce, and sent from there.
+	merchantWebhookStore := models.NewMerchantWebhookStore(db.Pool)
+	webhookDeliveryStore := models.NewWebhookDeliveryStore(db.Pool)
+	deliverer := merchanthooks.NewDeliverer(merchantWebhookStore, webhookDeliveryStore, merchanthooks.Config{
+		PollInterval: getEnvDuration("MERCHANT_WEBHOOK_POLL_INTERVAL", 0),
+		Timeout:      getEnvDuration("MERCHANT_WEBHOOK_TIMEOUT", 0),
+		MaxAttempts:  getEnvInt("MERCHANT_WEBHOOK_MAX_ATTEMPTS", 0),
+	})
+	// An order event may have queued deliveries; send them straight away
+	// rather than at the deliverer's next poll.
+	orderStore.OnEvent(func(id uuid.UUID) {
+		broker.Publish(id)
+		deliverer.Notify()
+	})
+
+	userStore := models.NewUserStore(db.Pool)
+	authService := auth.NewService(userStore, models.NewSessionStore(db.Pool),
+		getEnvDuration("ACCESS_TOKEN_TTL", auth.DefaultAccessTTL),
+		getEnvDuration("REFRESH_TOKEN_TTL", auth.DefaultRefreshTTL))
+	seedUsers(ctx, authService)
+
+	app := handlers.NewApp(handlers.Deps{
+		Orders:       orderStore,
+		Products:     productStore,
+		Destinations: destinationStore,
+		Mural:        muralClient,
+		Workflows:    engine,
+		Payouts:      payments.NewPayoutTracker(orderStore, muralClient),
+		Auth:         authService,
+		Users:        userStore,
+		Deposits:     depositStore,
+		Ledger:       ledger,
+		Refunds:      refundStore,
+		Refunder:     refunds,
+		Quoter:       quoter,
+		Pricer:       pricer,
+
+		Idempotency:       idempotencyStore,
+		IdempotencyKeyTTL: getEnvDuration("IDEMPOTENCY_KEY_TTL", handlers.DefaultIdempotencyKeyTTL),
+		Broker:            broker,
+
+		PaymentWindow: getEnvDuration("PAYMENT_WINDOW", payments.DefaultPaymentWindow),
+
+		MerchantWebhooks:  merchantWebhookStore,
+		WebhookDeliveries: webhookDeliveryStore,
+		WebhookDeliverer:  deliverer,
+
+		Webhooks:              dispatcher,
+		WebhookVerifier:       verifier,
+		AllowUnsignedWebhooks: strings.ToLower(getEnv("ALLOW_UNSIGNED_WEBHOOKS", "false")) == "true",
+	}, backendBaseURL, useWebhooks)
 	mux := app.Routes()
 
 	addr := getEnv("PORT", "8080")
@@ -74,6 +181,23 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	srv.RegisterOnShutdown(broker.Shutdown)
+
+	poller := payments.NewDepositPoller(orderStore, ledger, getEnvDuration("DEPOSIT_POLL_INTERVAL", payments.DefaultDepositPollInterval))
+	sweeper := payments.NewExpirySweeper(orderStore, ledger, getEnvDuration("EXPIRY_SWEEP_INTERVAL", payments.DefaultSweepInterval))
+
+	engineCtx, stopEngine := context.WithCancel(ctx)
+	engineDone := make(chan struct{})
+	go func() {
+		defer close(engineDone)
+		engine.Run(engineCtx)
+	}()
+	go poller.Run(engineCtx)
+	go sweeper.Run(engineCtx)
+	go refunds.Run(engineCtx)
+	go deliverer.Run(engineCtx)
+	go handlers.PurgeIdempotencyKeys(engineCtx, idempotencyStore, time.Hour)
+	go broker.Listen(engineCtx, db.Pool, models.OrderEventsChannel)
 
 	// graceful shutdown
 	go func() {
@@ -90,6 +214,40 @@ func main() {
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	_ = srv.Shutdown(ctxShutdown)
+
+	stopEngine()
+	select {
+	case <-engineDone:
+	case <-ctxShutdown.Done():
+		log.Printf("workflow engine did not stop before shutdown deadline")
+	}
+}
+
+// seedUsers creates the accounts configured in the environment. Existing
+// accounts are left alone, so changing a password here has no effect once the
+// user exists.
+func seedUsers(ctx context.Context, svc *auth.Service) {
+	seed := func(username, password string, role models.Role) {
+		created, err := svc.EnsureUser(ctx, username, password, role)
+		if err != nil {
+			log.Fatalf("seed user %q: %v", username, err)
+		}
+		if created {
+			log.Printf("created %s user %q", role, username)
+		}
+	}
+	if username, password := os.Getenv("BOOTSTRAP_ADMIN_USERNAME"), os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"); username != "" && password != "" {
+		seed(username, password, models.RoleSuperAdmin)
+	}
+	// The demo accounts from the README, one per role; never enable this in
+	// production.
+	if strings.ToLower(os.Getenv("SEED_DEMO_USERS")) == "true" {
+		seed("guest", "guest", models.RoleCustomer)
+		seed("support", "support", models.RoleSupport)
+		seed("finance", "finance", models.RoleFinance)
+		seed("operator", "operator", models.RoleOperator)
+		seed("admin", "admin", models.RoleSuperAdmin)
+	}
 }
 
 func getEnv(key, fallback string) string {
@@ -98,3 +256,42 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %d: %v", key, v, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %s: %v", key, v, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func getEnvDecimal(key string, fallback money.Decimal) money.Decimal {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := money.Parse(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %s: %v", key, v, fallback, err)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,112 @@
+// Command muralsim serves an in-memory Mural API for local development.
+// Point the API server at it with MURAL_BASE_URL=http://localhost:9090.
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/muralsim"
+)
+
+func main() {
+	key, err := loadSigningKey(os.Getenv("MURALSIM_SIGNING_KEY_FILE"))
+	if err != nil {
+		log.Fatalf("signing key: %v", err)
+	}
+
+	settle := 3 * time.Second
+	if v := os.Getenv("MURALSIM_SETTLE_DELAY"); v != "" {
+		if settle, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("invalid MURALSIM_SETTLE_DELAY=%q: %v", v, err)
+		}
+	}
+
+	sim, err := muralsim.New(muralsim.Config{
+		AccountID:      os.Getenv("MURALSIM_ACCOUNT_ID"),
+		OrganizationID: os.Getenv("MURALSIM_ORGANIZATION_ID"),
+		APIKey:         os.Getenv("MURALSIM_API_KEY"),
+		TransferKey:    os.Getenv("MURALSIM_TRANSFER_KEY"),
+		SettleDelay:    settle,
+		SigningKey:     key,
+	})
+	if err != nil {
+		log.Fatalf("muralsim init: %v", err)
+	}
+
+	addr := getEnv("MURALSIM_ADDR", ":9090")
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           sim,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("webhook public key (MURAL_WEBHOOK_PUBLIC_KEY):\n%s", sim.PublicKeyPEM())
+	go func() {
+		log.Printf("mural simulator listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+}
+
+// loadSigningKey reads a PEM EC private key from path, creating the file
+// with a new key if it does not exist, so the public key stays stable across
+// restarts. An empty path yields a fresh key every run.
+func loadSigningKey(path string) (*ecdsa.PrivateKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, pemBytes, 0o600); err != nil {
+			return nil, err
+		}
+		log.Printf("wrote new webhook signing key to %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -16,4 +16,312 @@ CREATE TABLE IF NOT EXISTS orders (
 
 CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
 
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal_usdc NUMERIC(18,6) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_reference TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_deposit_id TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payin_id TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payin_status TEXT;
 
+-- No two orders awaiting payment (pending_payment, underpaid or
+-- payment_failed) may share an amount, so a deposit's amount identifies
+-- exactly one order; a deposit can settle at most one order.
+DROP INDEX IF EXISTS idx_orders_open_amount;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_accepting_amount ON orders(amount_usdc)
+    WHERE status IN ('pending_payment', 'underpaid', 'payment_failed');
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_payment_deposit ON orders(payment_deposit_id);
+
+CREATE TABLE IF NOT EXISTS workflow_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind TEXT NOT NULL,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    step TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_runs_due ON workflow_runs(next_run_at) WHERE status = 'running';
+
+CREATE TABLE IF NOT EXISTS order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(order_id, id);
+
+CREATE TABLE IF NOT EXISTS products (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price_usdc NUMERIC(18,6) NOT NULL CHECK (price_usdc >= 0),
+    image_url TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Seed the demo catalog; existing rows (including admin edits) are left alone.
+INSERT INTO products (id, name, description, price_usdc, image_url) VALUES
+    ('starter-kit', 'Starter Kit', 'Lightweight entry plan for small experiments.', 1, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('growth-bundle', 'Growth Bundle', 'Everything you need to scale your next launch.', 12, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('pro-suite', 'Pro Suite', 'Advanced toolkit for high‑volume merchants.', 20, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('studio-templates', 'Studio Templates', 'Pre‑built canvases for rapid ideation.', 7, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('team-collab', 'Team Collaboration', 'Unlocks real‑time team sessions.', 9, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('insights-pack', 'Insights Pack', 'Analytics overlay for every mural session.', 11, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('webinar-pass', 'Webinar Pass', 'Access to a live workshop series.', 4, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('design-library', 'Design Library', 'Hand‑crafted components and stickers.', 6.5, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('ops-playbook', 'Ops Playbook', 'Operational templates for recurring rituals.', 8, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('research-deck', 'Research Deck', 'User interview and discovery toolkit.', 10, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('retro-kit', 'Retro Kit', 'Facilitation assets for sprint retros.', 3.5, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg'),
+    ('strategy-board', 'Strategy Board', 'Long‑range planning frameworks bundle.', 14, 'https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg')
+ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS payout_destinations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    counterparty_id TEXT NOT NULL,
+    payout_method_id TEXT NOT NULL,
+    bank_name TEXT NOT NULL DEFAULT '',
+    account_owner TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (counterparty_id, payout_method_id)
+);
+
+-- At most one destination receives payouts by default.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payout_destinations_default ON payout_destinations(is_default) WHERE is_default;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payout_destination_id UUID REFERENCES payout_destinations(id);
+
+ALTER TABLE payout_destinations ADD COLUMN IF NOT EXISTS rail TEXT NOT NULL DEFAULT 'cop';
+ALTER TABLE payout_destinations ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'COP';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payout_amount NUMERIC(18,2);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payout_currency TEXT;
+
+-- Mural webhook events already processed, so redeliveries are dropped.
+CREATE TABLE IF NOT EXISTS webhook_events (
+    event_id TEXT PRIMARY KEY,
+    event_category TEXT NOT NULL,
+    payload_type TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMPTZ,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_payin ON orders(payin_id) WHERE payin_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_payout_request ON orders(mural_payout_request_id) WHERE mural_payout_request_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Login sessions. Only SHA-256 hashes of the opaque tokens are stored.
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    access_token_hash TEXT NOT NULL UNIQUE,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    access_expires_at TIMESTAMPTZ NOT NULL,
+    refresh_expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id) WHERE revoked_at IS NULL;
+
+-- The single "admin" role was split into support, finance, operator and
+-- super_admin; existing admins keep full access.
+UPDATE users SET role='super_admin', updated_at=NOW() WHERE role='admin';
+
+-- The signed-in user who placed the order. NULL for orders placed before
+-- accounts existed.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS customer_id UUID REFERENCES users(id);
+CREATE INDEX IF NOT EXISTS idx_orders_customer ON orders(customer_id, created_at DESC, id DESC) WHERE customer_id IS NOT NULL;
+
+-- Unpaid orders expire at expires_at. Orders created before it existed get
+-- the default 30 minute window.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+UPDATE orders SET expires_at = created_at + INTERVAL '30 minutes' WHERE expires_at IS NULL AND status = 'pending_payment';
+-- Orders still accepting payment (or just expired, for late payments) by
+-- expiry time.
+DROP INDEX IF EXISTS idx_orders_expiry;
+CREATE INDEX IF NOT EXISTS idx_orders_expiring ON orders(expires_at)
+    WHERE status IN ('pending_payment', 'underpaid', 'payment_failed', 'expired');
+
+-- Every deposit seen on the Mural account, linked to the order it pays (NULL
+-- until one is matched or an admin assigns it). An order's received amount is
+-- the sum of its completed deposits.
+CREATE TABLE IF NOT EXISTS deposits (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    amount_usdc NUMERIC(18,6) NOT NULL,
+    status TEXT NOT NULL,
+    payin_status TEXT,
+    matched_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_deposits_order ON deposits(order_id) WHERE order_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_deposits_unmatched ON deposits(created_at) WHERE order_id IS NULL;
+
+-- Orders settled before deposits were tracked were paid in full by their
+-- recorded deposit.
+INSERT INTO deposits (id, kind, order_id, amount_usdc, status, payin_status, matched_by)
+SELECT payment_deposit_id,
+       CASE WHEN payment_deposit_id = payin_id THEN 'payin' ELSE 'transaction' END,
+       id, amount_usdc, 'completed', payin_status, 'remaining'
+FROM orders WHERE payment_deposit_id IS NOT NULL
+ON CONFLICT (id) DO NOTHING;
+
+-- USDC returned from an order to a customer's wallet with a Mural blockchain
+-- payout. Refunds that have not failed count against what the order has
+-- received.
+CREATE TABLE IF NOT EXISTS refunds (
+    id UUID PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    amount_usdc NUMERIC(18,6) NOT NULL CHECK (amount_usdc > 0),
+    wallet_address TEXT NOT NULL,
+    blockchain TEXT NOT NULL,
+    reason TEXT,
+    status TEXT NOT NULL,
+    mural_payout_request_id UUID UNIQUE,
+    mural_payout_status TEXT,
+    error TEXT,
+    requested_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(order_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_open ON refunds(created_at) WHERE status IN ('requested', 'processing');
+
+-- The USDC→fiat quote locked on an order for its payout; its fiat amount is
+-- payout_amount in payout_currency.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS quote_rail TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS quote_rate NUMERIC(24,10);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS quote_fee_usdc NUMERIC(18,6);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS quoted_at TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS quote_expires_at TIMESTAMPTZ;
+
+-- Fees charged on top of an order's subtotal (markup, pass-through Mural
+-- conversion fees, platform fee), line by line; fees_usdc is their sum.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fees_usdc NUMERIC(18,6) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_breakdown JSONB NOT NULL DEFAULT '[]';
+
+-- Products may be priced in a fiat currency instead of USDC; price_fiat is
+-- then authoritative and price_usdc unused.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS price_currency TEXT NOT NULL DEFAULT 'USDC';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS price_fiat NUMERIC(18,2) NOT NULL DEFAULT 0 CHECK (price_fiat >= 0);
+
+-- How a fiat-priced order's USDC subtotal was computed at checkout: the fiat
+-- subtotal and the Mural fiat-to-token rate used. NULL for USDC-priced orders.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS price_currency TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal_fiat NUMERIC(18,2);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_rail TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_rate NUMERIC(24,10);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_quoted_at TIMESTAMPTZ;
+
+-- Idempotency-Key headers sent with POST /api/orders, per user: the hash of
+-- the request body and, once handled, the response to replay. status_code
+-- is NULL while the request is in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INT,
+    content_type TEXT,
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expiry ON idempotency_keys(expires_at);
+
+-- HTTPS endpoints merchants register to be told about order lifecycle
+-- events. events lists the event types sent to the endpoint; empty means
+-- all of them. secret signs every delivery (HMAC-SHA256).
+CREATE TABLE IF NOT EXISTS merchant_webhooks (
+    id UUID PRIMARY KEY,
+    url TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    events TEXT[] NOT NULL DEFAULT '{}',
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Outbox of merchant webhook events, one row per event and endpoint. Rows
+-- are written in the transaction that records the order event, and sent
+-- (with retries) by the webhook deliverer. event_id is shared by the rows
+-- of one event, so receivers can deduplicate.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES merchant_webhooks(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    order_id UUID REFERENCES orders(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    last_status_code INT,
+    last_error TEXT,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+-- Every attempt to send a webhook delivery and what the endpoint answered.
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    status_code INT,
+    error TEXT,
+    duration_ms INT NOT NULL,
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id, id);
+
+-- Mural's token-to-fiat rate for a fiat-priced order's USDC subtotal at
+-- checkout, which the market rate is checked against when the order is paid
+-- out. NULL for USDC-priced orders and those created before it was recorded.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_sell_rate NUMERIC(24,10);
+
+-- Which attempt at paying an order out is current. It is part of the payout
+-- idempotency keys and moves on when a failed payout request is released, so
+-- a retried payout creates a new request instead of replaying the failed one.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payout_attempt INT NOT NULL DEFAULT 1;
+
+-- Identifies the claim holding a run's lease. Steps record their outcome only
+-- while their claim still holds it, so a run whose lease expired mid-step and
+-- was claimed again is not advanced twice.
+ALTER TABLE workflow_runs ADD COLUMN IF NOT EXISTS lease_token UUID;
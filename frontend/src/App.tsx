@@ -1,12 +1,30 @@
-import { useEffect, useMemo, useState } from 'react'
+import { useEffect, useMemo, useRef, useState } from 'react'
 import { Routes, Route, Navigate, useLocation, useNavigate } from 'react-router-dom'
 import { FiShoppingBag, FiLogIn, FiLogOut, FiUser, FiGrid, FiCopy, FiCheck } from 'react-icons/fi'
 import axios from 'axios'
 
-type Role = 'guest' | 'admin' | null
+type Role = 'customer' | 'support' | 'finance' | 'operator' | 'super_admin' | null
+
+const ROLE_LABELS: Record<Exclude<Role, null>, string> = {
+  customer: 'Customer',
+  support: 'Support',
+  finance: 'Finance',
+  operator: 'Operator',
+  super_admin: 'Admin',
+}
+
+// Staff roles see the merchant dashboard; the backend decides what each may do.
+const isStaff = (role: Role) => role !== null && role !== 'customer'
 
 type AuthState = {
   token: string | null
+  refreshToken?: string | null
+  role: Role
+}
+
+type LoginResponse = {
+  token: string
+  refreshToken: string
   role: Role
 }
 
@@ -15,6 +33,8 @@ type Product = {
   name: string
   description: string
   priceUsdc: number
+  priceCurrency?: string
+  priceFiat?: number
   imageUrl?: string
 }
 
@@ -22,36 +42,137 @@ type OrderItem = {
   productId: string
   name: string
   priceUsdc: number
+  priceFiat?: number
+  currency?: string
   quantity: number
 }
 
+type FiatPricing = {
+  currency: string
+  subtotalFiat: number
+  rail: string
+  rate: number
+  sellRate?: number
+  quotedAt: string
+}
+
+// Products priced in fiat are converted to USDC at checkout.
+function unitPrice(p: Product): { amount: number; currency: string } {
+  if (p.priceCurrency && p.priceCurrency !== 'USDC') {
+    return { amount: p.priceFiat ?? 0, currency: p.priceCurrency }
+  }
+  return { amount: p.priceUsdc, currency: 'USDC' }
+}
+
+function itemPrice(it: OrderItem): number {
+  return it.currency ? it.priceFiat ?? 0 : it.priceUsdc
+}
+
+type FXQuote = {
+  rail: string
+  currency: string
+  rate: number
+  feeUsdc: number
+  fiatAmount: number
+  quotedAt: string
+  expiresAt: string
+}
+
+type FeeLine = {
+  kind: string
+  description: string
+  amountUsdc: number
+}
+
 type Order = {
   id: string
   customerName: string
   customerEmail?: string
   items: OrderItem[]
+  subtotalUsdc: number
+  feesUsdc: number
+  feeBreakdown: FeeLine[]
   amountUsdc: number
+  receivedUsdc: number
+  refundedUsdc: number
+  balanceDueUsdc: number
+  balanceOwedUsdc: number
   amountCop: number
+  payoutAmount: number
+  payoutCurrency?: string
+  quote?: FXQuote
+  fiatPricing?: FiatPricing
   status: string
   createdAt: string
 }
 
 const API_BASE = import.meta.env.VITE_API_BASE_URL ?? 'http://localhost:8080'
 
+// Reads an order's status event stream (Server-Sent Events over fetch, since
+// EventSource cannot send the Authorization header) and calls onStatus for
+// each event. Dropped connections are resumed from the last event ID; the
+// backend answers 204 once the order can no longer change.
+async function streamOrderEvents(orderId: string, signal: AbortSignal, onStatus: (status: string) => void) {
+  let lastEventId = ''
+  while (!signal.aborted) {
+    try {
+      const headers: Record<string, string> = {
+        Authorization: String(axios.defaults.headers.common.Authorization ?? ''),
+      }
+      if (lastEventId) headers['Last-Event-ID'] = lastEventId
+      const res = await fetch(`${API_BASE}/api/orders/${orderId}/events`, { headers, signal })
+      if (res.status === 204 || !res.ok || !res.body) return
+      const reader = res.body.pipeThrough(new TextDecoderStream()).getReader()
+      let buf = ''
+      for (;;) {
+        const { value, done } = await reader.read()
+        if (done) break
+        buf += value
+        let sep
+        while ((sep = buf.indexOf('\n\n')) >= 0) {
+          const block = buf.slice(0, sep)
+          buf = buf.slice(sep + 2)
+          let data = ''
+          for (const line of block.split('\n')) {
+            if (line.startsWith('id: ')) lastEventId = line.slice(4)
+            else if (line.startsWith('data: ')) data += line.slice(6)
+          }
+          if (data) onStatus((JSON.parse(data) as { status: string }).status)
+        }
+      }
+    } catch {
+      if (signal.aborted) return
+    }
+    await new Promise((resolve) => setTimeout(resolve, 3000))
+  }
+}
+
 const STORAGE_KEY = 'mural-auth'
 
+// Every API call carries the signed-in user's token.
+function setAuthHeader(token: string | null) {
+  if (token) {
+    axios.defaults.headers.common.Authorization = `Bearer ${token}`
+  } else {
+    delete axios.defaults.headers.common.Authorization
+  }
+}
+
 function useAuth(): [AuthState, (next: AuthState) => void, () => void] {
   const [auth, setAuth] = useState<AuthState>(() => {
     const raw = localStorage.getItem(STORAGE_KEY)
     if (!raw) return { token: null, role: null }
     try {
-      return JSON.parse(raw)
+      const stored = JSON.parse(raw) as AuthState
+      setAuthHeader(stored.token)
+      return stored
     } catch {
       return { token: null, role: null }
     }
   })
 
   const update = (next: AuthState) => {
+    setAuthHeader(next.token)
     setAuth(next)
     if (next.token) {
       localStorage.setItem(STORAGE_KEY, JSON.stringify(next))
@@ -60,7 +181,47 @@ function useAuth(): [AuthState, (next: AuthState) => void, () => void] {
     }
   }
 
-  const logout = () => update({ token: null, role: null })
+  const logout = () => {
+    if (auth.token) {
+      axios
+        .post(`${API_BASE}/api/logout`, null, {
+          headers: { Authorization: `Bearer ${auth.token}` },
+        })
+        .catch(() => {})
+    }
+    update({ token: null, role: null })
+  }
+
+  // Access tokens are short-lived: on a 401, trade the refresh token for a new
+  // pair once and replay the request.
+  useEffect(() => {
+    const id = axios.interceptors.response.use(undefined, async (error) => {
+      const original = error.config
+      if (
+        error.response?.status !== 401 ||
+        !auth.refreshToken ||
+        !original ||
+        original._retried ||
+        original.url?.endsWith('/api/auth/refresh')
+      ) {
+        return Promise.reject(error)
+      }
+      original._retried = true
+      try {
+        const res = await axios.post<LoginResponse>(`${API_BASE}/api/auth/refresh`, {
+          refreshToken: auth.refreshToken,
+        })
+        const data = res.data
+        update({ token: data.token, refreshToken: data.refreshToken, role: data.role })
+        original.headers = { ...original.headers, Authorization: `Bearer ${data.token}` }
+        return axios(original)
+      } catch {
+        update({ token: null, role: null })
+        return Promise.reject(error)
+      }
+    })
+    return () => axios.interceptors.response.eject(id)
+  }, [auth.refreshToken])
 
   return [auth, update, logout]
 }
@@ -96,7 +257,7 @@ function Navbar({
         </button>
 
         <div className="flex items-center gap-2 text-xs md:gap-3">
-          {auth.role === 'admin' && (
+          {isStaff(auth.role) && (
             <>
               <button
                 onClick={() => navigate(isAdminRoute ? '/' : '/admin')}
@@ -110,9 +271,16 @@ function Navbar({
 
           {auth.role ? (
             <>
+              <button
+                onClick={() => navigate('/orders')}
+                className="inline-flex items-center gap-1 rounded-full border border-slate-200 bg-white px-3 py-1.5 text-[11px] font-medium text-slate-700 shadow-sm shadow-slate-200/80 backdrop-blur-xs transition hover:border-slate-400 hover:bg-slate-50"
+              >
+                <FiShoppingBag className="text-xs" />
+                My orders
+              </button>
               <span className="hidden items-center gap-1 rounded-full border border-slate-200 bg-white px-2.5 py-1 text-[11px] font-medium text-slate-700 shadow-sm backdrop-blur-xs sm:inline-flex">
                 <FiUser className="text-xs text-[#FF7900]" />
-                {auth.role === 'admin' ? 'Admin' : 'Customer'}
+                {ROLE_LABELS[auth.role]}
               </span>
               <button
                 onClick={onLogout}
@@ -164,13 +332,19 @@ function CatalogPage({ auth }: { auth: AuthState }) {
   const [customerName, setCustomerName] = useState('')
   const [customerEmail, setCustomerEmail] = useState('')
   const [checkingOut, setCheckingOut] = useState(false)
+  // One Idempotency-Key per cart, so retrying a checkout never creates a
+  // second order for it.
+  const checkoutKey = useRef<string | null>(null)
   const [checkoutOpen, setCheckoutOpen] = useState(false)
   const [orderId, setOrderId] = useState<string | null>(null)
   const [orderStatus, setOrderStatus] = useState<string | null>(null)
   const [amountUsdc, setAmountUsdc] = useState<number | null>(null)
-  const [amountCop, setAmountCop] = useState<number | null>(null)
+  const [payout, setPayout] = useState<{ amount: number; currency: string } | null>(null)
   const [depositAddress, setDepositAddress] = useState<string | null>(null)
   const [network, setNetwork] = useState<string | null>(null)
+  const [expiresAt, setExpiresAt] = useState<string | null>(null)
+  const [quote, setQuote] = useState<FXQuote | null>(null)
+  const [fees, setFees] = useState<FeeLine[]>([])
   const [activeProduct, setActiveProduct] = useState<Product | null>(null)
   const [productModalOpen, setProductModalOpen] = useState(false)
   const [copiedAddress, setCopiedAddress] = useState(false)
@@ -192,10 +366,15 @@ function CatalogPage({ auth }: { auth: AuthState }) {
     fetchProducts()
   }, [])
 
+  useEffect(() => {
+    checkoutKey.current = null
+  }, [cart, customerName, customerEmail])
+
   const total = useMemo(
-    () => cart.reduce((sum, it) => sum + it.priceUsdc * it.quantity, 0),
+    () => cart.reduce((sum, it) => sum + itemPrice(it) * it.quantity, 0),
     [cart],
   )
+  const cartCurrency = cart[0]?.currency ?? 'USDC'
 
   const requireLogin = () => {
     if (!auth.role) {
@@ -207,6 +386,11 @@ function CatalogPage({ auth }: { auth: AuthState }) {
 
   const addToCart = (product: Product) => {
     if (!requireLogin()) return
+    const price = unitPrice(product)
+    if (cart.length > 0 && price.currency !== cartCurrency) {
+      alert(`Your cart is priced in ${cartCurrency}; check it out before adding ${price.currency} products.`)
+      return
+    }
     setCart((prev) => {
       const existing = prev.find((it) => it.productId === product.id)
       if (existing) {
@@ -220,6 +404,7 @@ function CatalogPage({ auth }: { auth: AuthState }) {
           productId: product.id,
           name: product.name,
           priceUsdc: product.priceUsdc,
+          ...(price.currency !== 'USDC' ? { priceFiat: price.amount, currency: price.currency } : {}),
           quantity: 1,
         },
       ]
@@ -248,18 +433,25 @@ function CatalogPage({ auth }: { auth: AuthState }) {
     }
     try {
       setCheckingOut(true)
-      const res = await axios.post(`${API_BASE}/api/orders`, {
-        customerName,
-        customerEmail,
-        items: cart,
-      })
+      checkoutKey.current ??= crypto.randomUUID()
+      const res = await axios.post(
+        `${API_BASE}/api/orders`,
+        { customerName, customerEmail, items: cart },
+        { headers: { 'Idempotency-Key': checkoutKey.current } },
+      )
       const data = res.data as {
         orderId: string
         amountUsdc: number
+        feeBreakdown: FeeLine[]
         depositAddress: string
         network: string
+        expiresAt?: string
+        quote?: FXQuote
       }
       setOrderId(data.orderId)
+      setFees(data.feeBreakdown ?? [])
+      setExpiresAt(data.expiresAt ?? null)
+      setQuote(data.quote ?? null)
       setDepositAddress(data.depositAddress)
       setCopiedAddress(false)
       setNetwork(data.network)
@@ -272,18 +464,24 @@ function CatalogPage({ auth }: { auth: AuthState }) {
     }
   }
 
+  // Reload the order whenever its status changes, as streamed by the backend.
   useEffect(() => {
     if (!orderId) return
-    const interval = setInterval(async () => {
+    const refresh = async () => {
       try {
         const res = await axios.get<Order>(`${API_BASE}/api/orders/${orderId}`)
         setOrderStatus(res.data.status)
-        setAmountCop(res.data.amountCop)
+        if (res.data.payoutCurrency) {
+          setPayout({ amount: res.data.payoutAmount, currency: res.data.payoutCurrency })
+        }
+        setQuote(res.data.quote ?? null)
       } catch {
         // noop for demo
       }
-    }, 4000)
-    return () => clearInterval(interval)
+    }
+    const ctrl = new AbortController()
+    void streamOrderEvents(orderId, ctrl.signal, () => void refresh())
+    return () => ctrl.abort()
   }, [orderId])
 
   // Animate product modal open/close so it "grows" out of the grid
@@ -297,7 +495,7 @@ function CatalogPage({ auth }: { auth: AuthState }) {
     setProductModalOpen(false)
   }, [activeProduct])
 
-  // Persist a separate cart per auth role (guest/admin) and clear when logged out
+  // Persist a separate cart per auth role and clear when logged out
   useEffect(() => {
     if (typeof window === 'undefined') return
     if (!auth.role) return
@@ -337,7 +535,7 @@ function CatalogPage({ auth }: { auth: AuthState }) {
               Browse a focused catalog, pay in{' '}
               <span className="font-semibold text-[#FF7900]">USDC on Polygon</span>, and
               watch funds move automatically into{' '}
-              <span className="font-semibold text-[#FFBF00]">COP</span> for the merchant.
+              <span className="font-semibold text-[#FFBF00]">local fiat</span> for the merchant.
             </p>
             <div className="h-px w-28 bg-gradient-to-r from-[#FFBF00] via-[#F2CF7E] to-[#FF7900]" />
           </div>
@@ -384,7 +582,7 @@ function CatalogPage({ auth }: { auth: AuthState }) {
                     </div>
                     <div className="mt-4 flex items-center justify-between">
                       <span className="text-sm font-semibold text-[#FF7900] md:text-base">
-                        {p.priceUsdc.toFixed(2)} USDC
+                        {unitPrice(p).amount.toFixed(2)} {unitPrice(p).currency}
                       </span>
                       <button
                         type="button"
@@ -455,7 +653,7 @@ function CatalogPage({ auth }: { auth: AuthState }) {
                   {activeProduct.description}
                 </p>
                 <p className="pt-2 text-sm font-semibold text-[#FF7900] md:text-base">
-                  {activeProduct.priceUsdc.toFixed(2)} USDC
+                  {unitPrice(activeProduct).amount.toFixed(2)} {unitPrice(activeProduct).currency}
                 </p>
                 <button
                   type="button"
@@ -522,7 +720,7 @@ function CatalogPage({ auth }: { auth: AuthState }) {
                       <div>
                         <div className="font-medium">{item.name}</div>
                         <div className="mt-0.5 text-[11px] text-slate-500">
-                          {item.priceUsdc.toFixed(2)} USDC × {item.quantity}
+                          {itemPrice(item).toFixed(2)} {item.currency ?? 'USDC'} × {item.quantity}
                         </div>
                       </div>
                       <div className="flex items-center gap-2">
@@ -549,9 +747,14 @@ function CatalogPage({ auth }: { auth: AuthState }) {
                   <div className="flex items-center justify-between">
                     <span>Total due</span>
                     <span className="font-semibold text-[#FF7900]">
-                      {total.toFixed(2)} USDC
+                      {total.toFixed(2)} {cartCurrency}
                     </span>
                   </div>
+                  {cartCurrency !== 'USDC' && (
+                    <div className="mt-1 text-[11px] text-slate-500">
+                      Converted to USDC at Mural's rate when you check out.
+                    </div>
+                  )}
                 </div>
               </div>
 
@@ -602,16 +805,39 @@ function CatalogPage({ auth }: { auth: AuthState }) {
                       {orderId.slice(0, 10)}…
                     </span>
                   </div>
+                  {fees.map((f) => (
+                    <div key={f.kind} className="flex items-center justify-between">
+                      <span>{f.description}</span>
+                      <span className="tabular-nums">{f.amountUsdc.toFixed(2)} USDC</span>
+                    </div>
+                  ))}
                   <div className="flex items-center justify-between">
-                    <span>Send</span>
+                    <span>Send exactly</span>
                     <span className="font-semibold">
-                      {amountUsdc?.toFixed(2)} USDC
+                      {amountUsdc?.toFixed(6)} USDC
                     </span>
                   </div>
                   <div className="flex items-center justify-between">
                     <span>Network</span>
                     <span>{network}</span>
                   </div>
+                  {expiresAt && (
+                    <div className="flex items-center justify-between">
+                      <span>Pay before</span>
+                      <span>{new Date(expiresAt).toLocaleTimeString()}</span>
+                    </div>
+                  )}
+                  {quote && (
+                    <div className="flex items-center justify-between">
+                      <span>
+                        Merchant receives (1 USDC = {quote.rate.toLocaleString()} {quote.currency}, locked until{' '}
+                        {new Date(quote.expiresAt).toLocaleTimeString()})
+                      </span>
+                      <span className="font-semibold tabular-nums">
+                        {quote.fiatAmount.toLocaleString()} {quote.currency}
+                      </span>
+                    </div>
+                  )}
                   <div className="flex flex-col gap-1.5">
                     <span>Deposit address</span>
                     <div className="flex items-center gap-2">
@@ -664,11 +890,11 @@ function CatalogPage({ auth }: { auth: AuthState }) {
                       {orderStatus}
                     </span>
                   </div>
-                  {amountCop && amountCop > 0 && (
+                  {payout && payout.amount > 0 && (
                     <div className="flex items-center justify-between">
-                      <span>Converted to COP</span>
+                      <span>Converted to {payout.currency}</span>
                       <span className="font-semibold tabular-nums">
-                        ${amountCop.toLocaleString('es-CO')} COP
+                        {payout.amount.toLocaleString()} {payout.currency}
                       </span>
                     </div>
                   )}
@@ -698,9 +924,9 @@ function LoginPage({ onLogin }: { onLogin: (auth: AuthState) => void }) {
     try {
       setLoading(true)
       const res = await axios.post(`${API_BASE}/api/login`, { username, password })
-      const data = res.data as { token: string; role: Role }
-      onLogin({ token: data.token, role: data.role })
-      if (data.role === 'admin') {
+      const data = res.data as LoginResponse
+      onLogin({ token: data.token, refreshToken: data.refreshToken, role: data.role })
+      if (isStaff(data.role)) {
         navigate('/admin', { replace: true })
       } else {
         navigate(from === '/login' || from === '/admin' ? '/' : from, {
@@ -767,6 +993,134 @@ function LoginPage({ onLogin }: { onLogin: (auth: AuthState) => void }) {
   )
 }
 
+type OrdersPage = {
+  results: Order[]
+  nextId?: string
+}
+
+type PaymentInstructions = {
+  orderId: string
+  receivedUsdc: number
+  remainingUsdc: number
+  depositAddress: string
+  network: string
+  expiresAt?: string
+}
+
+function MyOrdersPage({ auth }: { auth: AuthState }) {
+  const [orders, setOrders] = useState<Order[]>([])
+  const [nextId, setNextId] = useState<string | undefined>()
+  const [loading, setLoading] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+  const [payment, setPayment] = useState<PaymentInstructions | null>(null)
+
+  const load = async (after?: string) => {
+    try {
+      setLoading(true)
+      const res = await axios.get<OrdersPage>(`${API_BASE}/api/me/orders`, {
+        params: { limit: 10, nextId: after },
+      })
+      setOrders((prev) => (after ? [...prev, ...res.data.results] : res.data.results))
+      setNextId(res.data.nextId)
+    } catch {
+      setError('Unable to load your orders.')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  useEffect(() => {
+    if (auth.token) load()
+  }, [auth.token])
+
+  const resumePayment = async (orderId: string) => {
+    try {
+      const res = await axios.get<PaymentInstructions>(`${API_BASE}/api/orders/${orderId}/payment`)
+      setPayment(res.data)
+    } catch {
+      alert('This order is no longer awaiting payment.')
+      load()
+    }
+  }
+
+  if (!auth.token) {
+    return <Navigate to="/login" replace state={{ from: '/orders' }} />
+  }
+
+  return (
+    <div className="mx-auto w-full max-w-3xl space-y-4">
+      <h1 className="text-lg font-semibold tracking-tight text-slate-900">My orders</h1>
+      {error && (
+        <div className="rounded-2xl border border-rose-200 bg-rose-50 p-3 text-xs text-rose-700">{error}</div>
+      )}
+      <div className="space-y-2">
+        {orders.map((o) => (
+          <div
+            key={o.id}
+            className="rounded-2xl border border-slate-200 bg-white p-3 text-xs text-slate-700 shadow-sm"
+          >
+            <div className="flex items-center justify-between">
+              <span className="font-mono text-[11px]">{o.id.slice(0, 10)}…</span>
+              <span className="rounded-full bg-[#FFBF00]/20 px-2 py-0.5 text-[11px] font-medium uppercase tracking-[0.16em] text-[#B86400]">
+                {o.status}
+              </span>
+            </div>
+            <div className="mt-1 flex items-center justify-between">
+              <span>{new Date(o.createdAt).toLocaleString()}</span>
+              <span className="font-semibold">{o.amountUsdc.toFixed(6)} USDC</span>
+            </div>
+            {o.status === 'underpaid' && (
+              <div className="mt-1 text-[11px] text-slate-500">
+                Received {o.receivedUsdc.toFixed(6)} USDC; {o.balanceDueUsdc.toFixed(6)} USDC still due.
+              </div>
+            )}
+            {o.balanceOwedUsdc > 0 && (
+              <div className="mt-1 text-[11px] text-slate-500">
+                {o.balanceOwedUsdc.toFixed(6)} USDC will be returned to you.
+              </div>
+            )}
+            {o.refundedUsdc > 0 && (
+              <div className="mt-1 text-[11px] text-slate-500">
+                {o.refundedUsdc.toFixed(6)} USDC refunded to your wallet.
+              </div>
+            )}
+            {(o.status === 'pending_payment' || o.status === 'underpaid') && (
+              <button
+                onClick={() => resumePayment(o.id)}
+                className="mt-2 rounded-full border border-[#FFBF00]/70 bg-[#FFF7DA] px-3 py-1 text-[11px] font-semibold text-[#B86400]"
+              >
+                Resume payment
+              </button>
+            )}
+            {payment?.orderId === o.id && (
+              <div className="mt-2 space-y-1 rounded-xl bg-[#FFF7DA] p-2">
+                <div>
+                  Send exactly <span className="font-semibold">{payment.remainingUsdc.toFixed(6)} USDC</span> on{' '}
+                  {payment.network} to:
+                </div>
+                <div className="break-all font-mono text-[11px]">{payment.depositAddress}</div>
+                {payment.expiresAt && <div>Pay before {new Date(payment.expiresAt).toLocaleString()}.</div>}
+              </div>
+            )}
+          </div>
+        ))}
+        {!loading && orders.length === 0 && !error && (
+          <p className="text-xs text-slate-500">You have not placed any orders yet.</p>
+        )}
+      </div>
+      {nextId && (
+        <button
+          onClick={() => load(nextId)}
+          disabled={loading}
+          className="rounded-full border border-slate-200 bg-white px-3 py-1.5 text-[11px] font-medium text-slate-700"
+        >
+          {loading ? 'Loading…' : 'Load more'}
+        </button>
+      )}
+    </div>
+  )
+}
+
 function AdminDashboard({ auth }: { auth: AuthState }) {
   const [orders, setOrders] = useState<Order[]>([])
   const [loading, setLoading] = useState(true)
@@ -791,14 +1145,14 @@ function AdminDashboard({ auth }: { auth: AuthState }) {
         setLoading(false)
       }
     }
-    if (auth.role === 'admin') {
+    if (isStaff(auth.role)) {
       fetchOrders()
       const interval = setInterval(fetchOrders, 5000)
       return () => clearInterval(interval)
     }
   }, [auth])
 
-  if (auth.role !== 'admin') {
+  if (!isStaff(auth.role)) {
     return <Navigate to="/" replace />
   }
 
@@ -858,10 +1212,10 @@ function AdminDashboard({ auth }: { auth: AuthState }) {
                     </div>
                   </div>
                   <div className="text-right">
-                    <div className="text-slate-400">COP (est.)</div>
+                    <div className="text-slate-400">{o.payoutCurrency ?? 'Payout'} (est.)</div>
                     <div className="mt-0.5 text-sm font-semibold text-slate-900">
-                      {o.amountCop > 0
-                        ? `$${o.amountCop.toLocaleString('es-CO')}`
+                      {o.payoutAmount > 0
+                        ? `${o.payoutAmount.toLocaleString()} ${o.payoutCurrency ?? ''}`
                         : 'Pending'}
                     </div>
                   </div>
@@ -937,10 +1291,12 @@ function AdminDashboard({ auth }: { auth: AuthState }) {
                   </div>
                 </div>
                 <div>
-                  <div className="text-[11px] text-slate-400">COP (est.)</div>
+                  <div className="text-[11px] text-slate-400">
+                    {activeOrder.payoutCurrency ?? 'Payout'} (est.)
+                  </div>
                   <div className="mt-0.5 text-sm font-semibold text-slate-900">
-                    {activeOrder.amountCop > 0
-                      ? `$${activeOrder.amountCop.toLocaleString('es-CO')}`
+                    {activeOrder.payoutAmount > 0
+                      ? `${activeOrder.payoutAmount.toLocaleString()} ${activeOrder.payoutCurrency ?? ''}`
                       : 'Pending'}
                   </div>
                 </div>
@@ -970,6 +1326,7 @@ function App() {
       <Routes>
         <Route path="/" element={<CatalogPage auth={auth} />} />
         <Route path="/login" element={<LoginPage onLogin={setAuth} />} />
+        <Route path="/orders" element={<MyOrdersPage auth={auth} />} />
         <Route path="/admin" element={<AdminDashboard auth={auth} />} />
         <Route path="*" element={<Navigate to="/" replace />} />
       </Routes>
@@ -0,0 +1,280 @@
+// Package auth implements password sign-in and server-side sessions.
+//
+// Passwords are hashed with bcrypt. A successful sign-in creates a session
+// with two opaque random tokens: a short-lived access token sent as a Bearer
+// token on every request, and a long-lived refresh token that trades itself
+// for a fresh pair. Only SHA-256 hashes of the tokens are stored, and a
+// session can be revoked at any time (logout).
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+const (
+	DefaultAccessTTL  = time.Hour
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+
+	// MinPasswordLength applies to new accounts only.
+	MinPasswordLength = 8
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrInvalidUsername    = errors.New("username is required")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID    uuid.UUID
+	Username  string
+	Role      models.Role
+	SessionID uuid.UUID
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the request's principal, or nil for anonymous requests.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Tokens is the credential pair handed to a client after sign-in or refresh.
+type Tokens struct {
+	AccessToken      string
+	RefreshToken     string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+}
+
+type Service struct {
+	users      *models.UserStore
+	sessions   *models.SessionStore
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// dummyHash is compared against when a username does not exist, so a
+	// failed sign-in takes as long whether or not the user exists.
+	dummyHash []byte
+}
+
+// NewService returns a Service. Zero TTLs fall back to DefaultAccessTTL and
+// DefaultRefreshTTL.
+func NewService(users *models.UserStore, sessions *models.SessionStore, accessTTL, refreshTTL time.Duration) *Service {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTTL
+	}
+	dummy, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return &Service{
+		users:      users,
+		sessions:   sessions,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		dummyHash:  dummy,
+	}
+}
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Login checks a username and password and starts a new session.
+func (s *Service) Login(ctx context.Context, username, password string) (*models.User, *Tokens, error) {
+	u, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, models.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+	tokens, err := s.startSession(ctx, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, tokens, nil
+}
+
+// Register creates a customer account and signs it in.
+func (s *Service) Register(ctx context.Context, username, password string) (*models.User, *Tokens, error) {
+	u, err := s.CreateUser(ctx, username, password, models.RoleCustomer)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.startSession(ctx, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, tokens, nil
+}
+
+// CreateUser creates an account with the given role.
+func (s *Service) CreateUser(ctx context.Context, username, password string, role models.Role) (*models.User, error) {
+	if models.NormalizeUsername(username) == "" {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	u := &models.User{Username: username, PasswordHash: hash, Role: role}
+	if err := s.users.Create(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// EnsureUser creates an account unless one with the username already exists.
+// It is used to seed accounts at startup and does not enforce the minimum
+// password length, so demo credentials such as admin/admin keep working.
+func (s *Service) EnsureUser(ctx context.Context, username, password string, role models.Role) (created bool, err error) {
+	if _, err := s.users.GetByUsername(ctx, username); err == nil {
+		return false, nil
+	} else if !errors.Is(err, models.ErrUserNotFound) {
+		return false, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	err = s.users.Create(ctx, &models.User{Username: username, PasswordHash: hash, Role: role})
+	if errors.Is(err, models.ErrUserExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Authenticate resolves an access token to its principal.
+func (s *Service) Authenticate(ctx context.Context, accessToken string) (*Principal, error) {
+	if accessToken == "" {
+		return nil, ErrInvalidToken
+	}
+	sess, u, err := s.sessions.GetByAccessHash(ctx, hashToken(accessToken))
+	if errors.Is(err, models.ErrSessionNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{UserID: u.ID, Username: u.Username, Role: u.Role, SessionID: sess.ID}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The old access and
+// refresh tokens stop working.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*models.User, *Tokens, error) {
+	if refreshToken == "" {
+		return nil, nil, ErrInvalidToken
+	}
+	tokens, err := s.newTokens()
+	if err != nil {
+		return nil, nil, err
+	}
+	sess, err := s.sessions.Rotate(ctx, hashToken(refreshToken),
+		hashToken(tokens.AccessToken), hashToken(tokens.RefreshToken),
+		tokens.AccessExpiresAt, tokens.RefreshExpiresAt)
+	if errors.Is(err, models.ErrSessionNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := s.users.GetByID(ctx, sess.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, tokens, nil
+}
+
+// Logout revokes the principal's session, or all of the user's sessions when
+// everywhere is set.
+func (s *Service) Logout(ctx context.Context, p *Principal, everywhere bool) error {
+	if everywhere {
+		return s.RevokeSessions(ctx, p.UserID)
+	}
+	return s.sessions.Revoke(ctx, p.SessionID)
+}
+
+// RevokeSessions signs a user out of every session.
+func (s *Service) RevokeSessions(ctx context.Context, userID uuid.UUID) error {
+	return s.sessions.RevokeAllForUser(ctx, userID)
+}
+
+func (s *Service) startSession(ctx context.Context, userID uuid.UUID) (*Tokens, error) {
+	tokens, err := s.newTokens()
+	if err != nil {
+		return nil, err
+	}
+	sess := &models.Session{
+		UserID:           userID,
+		AccessExpiresAt:  tokens.AccessExpiresAt,
+		RefreshExpiresAt: tokens.RefreshExpiresAt,
+	}
+	if err := s.sessions.Create(ctx, sess, hashToken(tokens.AccessToken), hashToken(tokens.RefreshToken)); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *Service) newTokens() (*Tokens, error) {
+	access, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Tokens{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		AccessExpiresAt:  now.Add(s.accessTTL),
+		RefreshExpiresAt: now.Add(s.refreshTTL),
+	}, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
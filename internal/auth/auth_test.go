@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "correct horse battery staple" {
+		t.Fatal("password stored in clear")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("correct horse battery staple")); err != nil {
+		t.Errorf("hash does not match its password: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("Correct horse battery staple")); err == nil {
+		t.Error("hash matches a different password")
+	}
+	again, _ := HashPassword("correct horse battery staple")
+	if again == hash {
+		t.Error("hashes are not salted")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	a, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newToken()
+	if a == b || len(a) < 40 {
+		t.Errorf("tokens are not random enough: %q, %q", a, b)
+	}
+	if hashToken(a) != hashToken(a) || hashToken(a) == hashToken(b) || hashToken(a) == a {
+		t.Error("hashToken is not a stable one-way digest")
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	if FromContext(context.Background()) != nil {
+		t.Error("anonymous context has a principal")
+	}
+	p := &Principal{UserID: uuid.New(), Role: models.RoleFinance}
+	if got := FromContext(WithPrincipal(context.Background(), p)); got != p {
+		t.Errorf("FromContext = %v, want %v", got, p)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	tests := []struct {
+		role    models.Role
+		allowed []Permission
+	}{
+		{models.RoleCustomer, nil},
+		{models.RoleSupport, []Permission{PermViewOrders}},
+		{models.RoleFinance, []Permission{PermViewOrders, PermViewBalances, PermManagePayouts, PermManageRefunds,
+			PermExportReports, PermViewDestinations}},
+		{models.RoleOperator, []Permission{PermViewOrders, PermViewProducts, PermManageProducts, PermViewDestinations,
+			PermManageDestinations, PermViewWebhooks, PermManageWebhooks}},
+		{models.RoleSuperAdmin, AllPermissions},
+	}
+	for _, tt := range tests {
+		p := &Principal{Role: tt.role}
+		for _, perm := range AllPermissions {
+			if got, want := p.Can(perm), slices.Contains(tt.allowed, perm); got != want {
+				t.Errorf("%s can %s = %v, want %v", tt.role, perm, got, want)
+			}
+		}
+	}
+}
+
+func TestNilPrincipalCannotDoAnything(t *testing.T) {
+	var p *Principal
+	for _, perm := range AllPermissions {
+		if p.Can(perm) {
+			t.Errorf("anonymous caller can %s", perm)
+		}
+	}
+	if (&Principal{Role: "unknown"}).Can(PermViewOrders) {
+		t.Error("unknown role can view orders")
+	}
+}
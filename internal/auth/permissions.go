@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+// Permission is an action on the merchant side of the API. Routes require a
+// permission rather than a role, so roles can be reshaped without touching
+// handlers.
+type Permission string
+
+const (
+	PermViewOrders         Permission = "orders:read"
+	PermViewBalances       Permission = "balances:read"
+	PermManagePayouts      Permission = "payouts:write"
+	PermManageRefunds      Permission = "refunds:write"
+	PermExportReports      Permission = "reports:export"
+	PermViewProducts       Permission = "products:read"
+	PermManageProducts     Permission = "products:write"
+	PermViewDestinations   Permission = "destinations:read"
+	PermManageDestinations Permission = "destinations:write"
+	PermViewWebhooks       Permission = "webhooks:read"
+	PermManageWebhooks     Permission = "webhooks:write"
+	PermManageUsers        Permission = "users:write"
+)
+
+// AllPermissions lists every permission.
+var AllPermissions = []Permission{
+	PermViewOrders,
+	PermViewBalances,
+	PermManagePayouts,
+	PermManageRefunds,
+	PermExportReports,
+	PermViewProducts,
+	PermManageProducts,
+	PermViewDestinations,
+	PermManageDestinations,
+	PermViewWebhooks,
+	PermManageWebhooks,
+	PermManageUsers,
+}
+
+// rolePermissions is what each role may do. Customers hold no merchant
+// permissions; super admins hold all of them.
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleSupport: {
+		PermViewOrders,
+	},
+	models.RoleFinance: {
+		PermViewOrders,
+		PermViewBalances,
+		PermManagePayouts,
+		PermManageRefunds,
+		PermExportReports,
+		PermViewDestinations,
+	},
+	models.RoleOperator: {
+		PermViewOrders,
+		PermViewProducts,
+		PermManageProducts,
+		PermViewDestinations,
+		PermManageDestinations,
+		PermViewWebhooks,
+		PermManageWebhooks,
+	},
+	models.RoleSuperAdmin: AllPermissions,
+}
+
+// PermissionsFor returns the permissions granted to role.
+func PermissionsFor(role models.Role) []Permission {
+	return rolePermissions[role]
+}
+
+// Can reports whether the principal's role grants perm.
+func (p *Principal) Can(perm Permission) bool {
+	return p != nil && slices.Contains(rolePermissions[p.Role], perm)
+}
@@ -2,43 +2,141 @@ package handlers
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/asn1"
-	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"io"
 	"log"
-	"math"
-	"math/big"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/merchanthooks"
 	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
 	"github.com/srypher/mural-challenge-backend/internal/mural"
+	"github.com/srypher/mural-challenge-backend/internal/payments"
+	"github.com/srypher/mural-challenge-backend/internal/pubsub"
+	"github.com/srypher/mural-challenge-backend/internal/webhooks"
+	"github.com/srypher/mural-challenge-backend/internal/workflow"
 )
 
 type App struct {
 	orders         *models.OrderStore
+	products       *models.ProductStore
+	destinations   *models.DestinationStore
 	mural          *mural.Client
+	workflows      *workflow.Engine
 	depositAddress string
 	network        string
 	useWebhooks    bool
 	webhookID      string
-	webhookKeyPEM  string
+	webhooks       *webhooks.Dispatcher
+	verifier       *webhooks.Verifier
+	allowUnsigned  bool
+	payouts        *payments.PayoutTracker
+	auth           *auth.Service
+	users          *models.UserStore
+	deposits       *models.DepositStore
+	ledger         *payments.Ledger
+	refunds        *models.RefundStore
+	refunder       *payments.Refunds
+	quoter         *payments.Quoter
+	pricer         *payments.Pricer
+	idempotency    IdempotencyStore
+	idempotencyTTL time.Duration
+	broker         *pubsub.Broker
+	paymentWindow  time.Duration
+
+	merchantWebhooks  *models.MerchantWebhookStore
+	webhookDeliveries *models.WebhookDeliveryStore
+	webhookDeliverer  *merchanthooks.Deliverer
 }
 
-func NewApp(orders *models.OrderStore, muralClient *mural.Client, backendBaseURL string, useWebhooks bool) *App {
+// Deps are the stores and services the HTTP handlers use.
+type Deps struct {
+	Orders       *models.OrderStore
+	Products     *models.ProductStore
+	Destinations *models.DestinationStore
+	Mural        *mural.Client
+	Workflows    *workflow.Engine
+	Payouts      *payments.PayoutTracker
+	Auth         *auth.Service
+	Users        *models.UserStore
+	Deposits     *models.DepositStore
+	Ledger       *payments.Ledger
+	Refunds      *models.RefundStore
+	Refunder     *payments.Refunds
+	Quoter       *payments.Quoter
+	Pricer       *payments.Pricer
+	// Idempotency stores Idempotency-Key responses for order creation, for
+	// IdempotencyKeyTTL (default DefaultIdempotencyKeyTTL). Without it the
+	// header is ignored.
+	Idempotency       IdempotencyStore
+	IdempotencyKeyTTL time.Duration
+	// Broker wakes order event streams when an order changes. Without it
+	// streams only pick up changes on their heartbeat.
+	Broker *pubsub.Broker
+	// PaymentWindow is how long customers have to pay a new order.
+	PaymentWindow time.Duration
+	// MerchantWebhooks are the endpoints merchants receive order events on,
+	// and WebhookDeliveries their outbox and delivery log. Without
+	// WebhookDeliverer deliveries cannot be resent by hand.
+	MerchantWebhooks  *models.MerchantWebhookStore
+	WebhookDeliveries *models.WebhookDeliveryStore
+	WebhookDeliverer  *merchanthooks.Deliverer
+	// Webhooks routes verified Mural webhook events. Without
+	// WebhookVerifier every event is refused, unless AllowUnsignedWebhooks
+	// is set for local development, when signatures are not checked.
+	Webhooks              *webhooks.Dispatcher
+	WebhookVerifier       *webhooks.Verifier
+	AllowUnsignedWebhooks bool
+}
+
+func NewApp(deps Deps, backendBaseURL string, useWebhooks bool) *App {
+	muralClient := deps.Mural
 	app := &App{
-		orders:      orders,
-		mural:       muralClient,
-		useWebhooks: useWebhooks,
+		orders:         deps.Orders,
+		products:       deps.Products,
+		destinations:   deps.Destinations,
+		mural:          muralClient,
+		workflows:      deps.Workflows,
+		useWebhooks:    useWebhooks,
+		webhooks:       deps.Webhooks,
+		verifier:       deps.WebhookVerifier,
+		allowUnsigned:  deps.AllowUnsignedWebhooks,
+		payouts:        deps.Payouts,
+		auth:           deps.Auth,
+		users:          deps.Users,
+		deposits:       deps.Deposits,
+		ledger:         deps.Ledger,
+		refunds:        deps.Refunds,
+		refunder:       deps.Refunder,
+		quoter:         deps.Quoter,
+		pricer:         deps.Pricer,
+		idempotency:    deps.Idempotency,
+		idempotencyTTL: deps.IdempotencyKeyTTL,
+		broker:         deps.Broker,
+		paymentWindow:  deps.PaymentWindow,
+
+		merchantWebhooks:  deps.MerchantWebhooks,
+		webhookDeliveries: deps.WebhookDeliveries,
+		webhookDeliverer:  deps.WebhookDeliverer,
+	}
+
+	if app.paymentWindow <= 0 {
+		app.paymentWindow = payments.DefaultPaymentWindow
+	}
+	if app.idempotencyTTL <= 0 {
+		app.idempotencyTTL = DefaultIdempotencyKeyTTL
+	}
+	if app.broker == nil {
+		app.broker = pubsub.NewBroker()
 	}
 
 	// Prefer the real Mural account wallet address (and derive org/account IDs) when available.
@@ -97,23 +195,23 @@ func NewApp(orders *models.OrderStore, muralClient *mural.Client, backendBaseURL
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		webhooks, err := muralClient.ListWebhooks(ctx)
+		existing, err := muralClient.ListWebhooks(ctx)
 		if err != nil {
 			log.Printf("failed to list Mural webhooks: %v", err)
 		} else {
 			var match *mural.Webhook
-			for i := range webhooks {
-				w := &webhooks[i]
+			for i := range existing {
+				w := &existing[i]
 				if w.URL == callbackURL {
 					match = w
 					break
 				}
 			}
 			if match == nil {
-				if len(webhooks) >= 5 {
+				if len(existing) >= 5 {
 					log.Printf("cannot create Mural webhook: already at max count")
 				} else {
-					created, err := muralClient.CreateWebhook(ctx, callbackURL, []string{"MURAL_ACCOUNT_BALANCE_ACTIVITY"})
+					created, err := muralClient.CreateWebhook(ctx, callbackURL, webhooks.Categories)
 					if err != nil {
 						log.Printf("failed to create Mural webhook: %v", err)
 					} else {
@@ -129,11 +227,21 @@ func NewApp(orders *models.OrderStore, muralClient *mural.Client, backendBaseURL
 						match = updated
 					}
 				}
+				for _, c := range webhooks.Categories {
+					if !slices.Contains(match.Events, c) {
+						log.Printf("Mural webhook %s is not subscribed to %s events", match.ID, c)
+					}
+				}
 				app.webhookID = match.ID
-				// Public key is configured via env for now
-				app.webhookKeyPEM = os.Getenv("MURAL_WEBHOOK_PUBLIC_KEY")
 			}
 		}
+		switch {
+		case app.verifier != nil:
+		case app.allowUnsigned:
+			log.Printf("MURAL_WEBHOOK_PUBLIC_KEY is not set and ALLOW_UNSIGNED_WEBHOOKS is true; webhook signatures will not be verified")
+		default:
+			log.Printf("MURAL_WEBHOOK_PUBLIC_KEY is not set; Mural webhooks will be refused")
+		}
 	}
 
 	return app
@@ -144,15 +252,58 @@ func (a *App) Routes() http.Handler {
 
 	mux.HandleFunc("GET /healthz", a.handleHealth)
 	mux.HandleFunc("POST /api/login", a.handleLogin)
+	mux.HandleFunc("POST /api/register", a.handleRegister)
+	mux.HandleFunc("POST /api/auth/refresh", a.handleRefresh)
+	mux.HandleFunc("POST /api/logout", a.requireAuth(a.handleLogout))
+	mux.HandleFunc("GET /api/me", a.requireAuth(a.handleMe))
 	mux.HandleFunc("GET /api/products", a.handleProducts)
-	mux.HandleFunc("POST /api/orders", a.handleCreateOrder)
-	mux.HandleFunc("GET /api/orders/{id}", a.handleGetOrder)
-	mux.HandleFunc("GET /api/admin/orders", a.requireAdmin(a.handleListOrders))
-	mux.HandleFunc("GET /api/admin/mural/account", a.requireAdmin(a.handleAdminMuralAccount))
-	mux.HandleFunc("GET /api/admin/orders/{id}/payout", a.requireAdmin(a.handleAdminOrderPayout))
+	mux.HandleFunc("GET /api/admin/products", a.require(auth.PermViewProducts, a.handleAdminListProducts))
+	mux.HandleFunc("POST /api/admin/products", a.require(auth.PermManageProducts, a.handleAdminCreateProduct))
+	mux.HandleFunc("GET /api/admin/products/{id}", a.require(auth.PermViewProducts, a.handleAdminGetProduct))
+	mux.HandleFunc("PUT /api/admin/products/{id}", a.require(auth.PermManageProducts, a.handleAdminUpdateProduct))
+	mux.HandleFunc("DELETE /api/admin/products/{id}", a.require(auth.PermManageProducts, a.handleAdminDeleteProduct))
+	mux.HandleFunc("POST /api/orders", a.requireAuth(a.idempotent(a.handleCreateOrder)))
+	mux.HandleFunc("GET /api/orders/{id}", a.requireAuth(a.handleGetOrder))
+	mux.HandleFunc("GET /api/orders/{id}/payment", a.requireAuth(a.handleGetOrderPayment))
+	mux.HandleFunc("GET /api/orders/{id}/refunds", a.requireAuth(a.handleGetOrderRefunds))
+	mux.HandleFunc("GET /api/orders/{id}/events", a.requireAuth(a.handleOrderEvents))
+	mux.HandleFunc("GET /api/me/orders", a.requireAuth(a.handleMyOrders))
+	mux.HandleFunc("GET /api/admin/orders", a.require(auth.PermViewOrders, a.handleListOrders))
+	mux.HandleFunc("GET /api/admin/mural/account", a.require(auth.PermViewBalances, a.handleAdminMuralAccount))
+	mux.HandleFunc("GET /api/admin/orders/{id}/payout", a.require(auth.PermViewOrders, a.handleAdminOrderPayout))
+	mux.HandleFunc("POST /api/admin/orders/{id}/payout/sync", a.require(auth.PermManagePayouts, a.handleAdminSyncOrderPayout))
+	mux.HandleFunc("POST /api/admin/orders/{id}/payout/retry", a.require(auth.PermManagePayouts, a.handleAdminRetryOrderPayout))
+	mux.HandleFunc("POST /api/admin/orders/{id}/accept-late-payment", a.require(auth.PermManagePayouts, a.handleAdminAcceptLatePayment))
+	mux.HandleFunc("GET /api/admin/orders/{id}/events", a.require(auth.PermViewOrders, a.handleAdminOrderEvents))
+	mux.HandleFunc("GET /api/admin/orders/{id}/workflows", a.require(auth.PermViewOrders, a.handleAdminOrderWorkflows))
+	mux.HandleFunc("GET /api/admin/orders/{id}/deposits", a.require(auth.PermViewOrders, a.handleAdminOrderDeposits))
+	mux.HandleFunc("POST /api/admin/orders/{id}/refunds", a.require(auth.PermManageRefunds, a.handleAdminCreateRefund))
+	mux.HandleFunc("GET /api/admin/deposits/unmatched", a.require(auth.PermViewBalances, a.handleAdminUnmatchedDeposits))
+	mux.HandleFunc("POST /api/admin/deposits/{id}/assign", a.require(auth.PermManagePayouts, a.handleAdminAssignDeposit))
+	mux.HandleFunc("GET /api/admin/balances", a.require(auth.PermViewBalances, a.handleAdminBalances))
+	mux.HandleFunc("GET /api/admin/payout-destinations", a.require(auth.PermViewDestinations, a.handleAdminListDestinations))
+	mux.HandleFunc("POST /api/admin/payout-destinations", a.require(auth.PermManageDestinations, a.handleAdminCreateDestination))
+	mux.HandleFunc("GET /api/admin/payout-destinations/{id}", a.require(auth.PermViewDestinations, a.handleAdminGetDestination))
+	mux.HandleFunc("POST /api/admin/payout-destinations/{id}/verify", a.require(auth.PermManageDestinations, a.handleAdminVerifyDestination))
+	mux.HandleFunc("POST /api/admin/payout-destinations/{id}/disable", a.require(auth.PermManageDestinations, a.handleAdminDisableDestination))
+	mux.HandleFunc("POST /api/admin/payout-destinations/{id}/default", a.require(auth.PermManageDestinations, a.handleAdminSetDefaultDestination))
+	mux.HandleFunc("GET /api/admin/merchant-webhooks", a.require(auth.PermViewWebhooks, a.handleAdminListMerchantWebhooks))
+	mux.HandleFunc("POST /api/admin/merchant-webhooks", a.require(auth.PermManageWebhooks, a.handleAdminCreateMerchantWebhook))
+	mux.HandleFunc("GET /api/admin/merchant-webhooks/{id}", a.require(auth.PermViewWebhooks, a.handleAdminGetMerchantWebhook))
+	mux.HandleFunc("PUT /api/admin/merchant-webhooks/{id}", a.require(auth.PermManageWebhooks, a.handleAdminUpdateMerchantWebhook))
+	mux.HandleFunc("DELETE /api/admin/merchant-webhooks/{id}", a.require(auth.PermManageWebhooks, a.handleAdminDeleteMerchantWebhook))
+	mux.HandleFunc("POST /api/admin/merchant-webhooks/{id}/rotate-secret", a.require(auth.PermManageWebhooks, a.handleAdminRotateMerchantWebhookSecret))
+	mux.HandleFunc("GET /api/admin/merchant-webhooks/{id}/deliveries", a.require(auth.PermViewWebhooks, a.handleAdminListWebhookDeliveries))
+	mux.HandleFunc("GET /api/admin/webhook-deliveries/{id}", a.require(auth.PermViewWebhooks, a.handleAdminGetWebhookDelivery))
+	mux.HandleFunc("POST /api/admin/webhook-deliveries/{id}/redeliver", a.require(auth.PermManageWebhooks, a.handleAdminRedeliverWebhook))
+	mux.HandleFunc("GET /api/admin/reports/orders", a.require(auth.PermExportReports, a.handleAdminExportOrders))
+	mux.HandleFunc("GET /api/admin/users", a.require(auth.PermManageUsers, a.handleAdminListUsers))
+	mux.HandleFunc("POST /api/admin/users", a.require(auth.PermManageUsers, a.handleAdminCreateUser))
+	mux.HandleFunc("PUT /api/admin/users/{id}/role", a.require(auth.PermManageUsers, a.handleAdminSetUserRole))
+	mux.HandleFunc("POST /api/admin/users/{id}/revoke-sessions", a.require(auth.PermManageUsers, a.handleAdminRevokeUserSessions))
 	mux.HandleFunc("POST /api/webhooks/mural", a.handleMuralWebhook)
 
-	return a.cors(mux)
+	return a.cors(a.authenticate(mux))
 }
 
 func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -160,156 +311,35 @@ func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
-type loginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-type loginResponse struct {
-	Token string `json:"token"`
-	Role  string `json:"role"`
-}
-
-// simple hardcoded auth: guest/guest and admin/admin, returns a bearer token
-func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var req loginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
-		return
-	}
-
-	var role, token string
-	switch {
-	case req.Username == "guest" && req.Password == "guest":
-		role = "guest"
-		token = "guest-token"
-	case req.Username == "admin" && req.Password == "admin":
-		role = "admin"
-		token = "admin-token"
-	default:
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	writeJSON(w, http.StatusOK, loginResponse{
-		Token: token,
-		Role:  role,
-	})
-}
-
-type product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	PriceUSDC   float64 `json:"priceUsdc"`
-	ImageURL    string  `json:"imageUrl"`
-}
-
-func (a *App) handleProducts(w http.ResponseWriter, r *http.Request) {
-	products := []product{
-		{
-			ID:          "starter-kit",
-			Name:        "Starter Kit",
-			Description: "Lightweight entry plan for small experiments.",
-			PriceUSDC:   1,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "growth-bundle",
-			Name:        "Growth Bundle",
-			Description: "Everything you need to scale your next launch.",
-			PriceUSDC:   12,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "pro-suite",
-			Name:        "Pro Suite",
-			Description: "Advanced toolkit for high‑volume merchants.",
-			PriceUSDC:   20,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "studio-templates",
-			Name:        "Studio Templates",
-			Description: "Pre‑built canvases for rapid ideation.",
-			PriceUSDC:   7,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "team-collab",
-			Name:        "Team Collaboration",
-			Description: "Unlocks real‑time team sessions.",
-			PriceUSDC:   9,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "insights-pack",
-			Name:        "Insights Pack",
-			Description: "Analytics overlay for every mural session.",
-			PriceUSDC:   11,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "webinar-pass",
-			Name:        "Webinar Pass",
-			Description: "Access to a live workshop series.",
-			PriceUSDC:   4,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "design-library",
-			Name:        "Design Library",
-			Description: "Hand‑crafted components and stickers.",
-			PriceUSDC:   6.5,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "ops-playbook",
-			Name:        "Ops Playbook",
-			Description: "Operational templates for recurring rituals.",
-			PriceUSDC:   8,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "research-deck",
-			Name:        "Research Deck",
-			Description: "User interview and discovery toolkit.",
-			PriceUSDC:   10,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "retro-kit",
-			Name:        "Retro Kit",
-			Description: "Facilitation assets for sprint retros.",
-			PriceUSDC:   3.5,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-		{
-			ID:          "strategy-board",
-			Name:        "Strategy Board",
-			Description: "Long‑range planning frameworks bundle.",
-			PriceUSDC:   14,
-			ImageURL:    "https://images.pexels.com/photos/546819/pexels-photo-546819.jpeg",
-		},
-	}
-	writeJSON(w, http.StatusOK, products)
+type createOrderRequest struct {
+	CustomerName  string                 `json:"customerName"`
+	CustomerEmail string                 `json:"customerEmail"`
+	Items         []createOrderItemInput `json:"items"`
 }
 
-type createOrderRequest struct {
-	CustomerName  string             `json:"customerName"`
-	CustomerEmail string             `json:"customerEmail"`
-	Items         []models.OrderItem `json:"items"`
+// createOrderItemInput is all a client may say about a line item; names and
+// prices come from the product catalog.
+type createOrderItemInput struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
 }
 
 type createOrderResponse struct {
-	OrderID        string  `json:"orderId"`
-	AmountUSDC     float64 `json:"amountUsdc"`
-	DepositAddress string  `json:"depositAddress"`
-	Network        string  `json:"network"`
+	OrderID          string           `json:"orderId"`
+	SubtotalUSDC     money.Decimal    `json:"subtotalUsdc"`
+	FeesUSDC         money.Decimal    `json:"feesUsdc"`
+	FeeBreakdown     []models.FeeLine `json:"feeBreakdown"`
+	AmountUSDC       money.Decimal    `json:"amountUsdc"`
+	PaymentReference string           `json:"paymentReference"`
+	DepositAddress   string           `json:"depositAddress"`
+	Network          string           `json:"network"`
+	ExpiresAt        *time.Time       `json:"expiresAt,omitempty"`
+	// Quote is what the merchant receives for the order, locked until its
+	// expiresAt; absent if no quote could be taken.
+	Quote *models.FXQuote `json:"quote,omitempty"`
+	// FiatPricing is set for orders of fiat-priced products: the fiat
+	// subtotal and the rate it was converted to USDC at.
+	FiatPricing *models.FiatPricing `json:"fiatPricing,omitempty"`
 }
 
 func (a *App) handleCreateOrder(w http.ResponseWriter, r *http.Request) {
@@ -328,46 +358,94 @@ func (a *App) handleCreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var total float64
-	for _, it := range req.Items {
-		total += it.PriceUSDC * float64(it.Quantity)
+	items, total, err := a.priceItems(r.Context(), req.Items)
+	if err != nil {
+		var invalid *invalidItemError
+		if errors.As(err, &invalid) {
+			http.Error(w, invalid.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("price order items: %v", err)
+		http.Error(w, "could not price order", http.StatusInternalServerError)
+		return
+	}
+
+	// Fiat prices are converted at a Mural quote taken now; the rate is kept
+	// on the order so its payout can be checked against it.
+	total, fiatPricing, err := a.convertToUSDC(r.Context(), items, total)
+	if err != nil {
+		log.Printf("convert order total to USDC: %v", err)
+		http.Error(w, "could not quote order total, please retry", http.StatusServiceUnavailable)
+		return
+	}
+
+	fees, err := a.pricer.Price(r.Context(), total)
+	if err != nil {
+		log.Printf("price order fees: %v", err)
+		http.Error(w, "could not price order fees, please retry", http.StatusServiceUnavailable)
+		return
 	}
 
+	p := auth.FromContext(r.Context())
+	if strings.TrimSpace(req.CustomerName) == "" {
+		req.CustomerName = p.Username
+	}
+	expiresAt := time.Now().Add(a.paymentWindow)
 	order := &models.Order{
+		ExpiresAt:     &expiresAt,
+		CustomerID:    p.UserID,
 		CustomerName:  req.CustomerName,
 		CustomerEmail: req.CustomerEmail,
-		Items:         req.Items,
-		AmountUSDC:    total,
+		Items:         items,
+		SubtotalUSDC:  total.Amount,
+		FeeBreakdown:  fees,
+		FiatPricing:   fiatPricing,
 		Status:        models.StatusPendingPayment,
 	}
 
-	if err := a.orders.Create(r.Context(), order); err != nil {
+	// Persist the payment pipeline with the order so it resumes after a
+	// restart and no order is left without one.
+	run, err := a.workflows.NewRun(payments.WorkflowKind, uuid.Nil)
+	if err != nil {
 		log.Printf("create order error: %v", err)
 		http.Error(w, "could not create order", http.StatusInternalServerError)
 		return
 	}
+	if err := a.orders.Create(r.Context(), order, run); err != nil {
+		log.Printf("create order error: %v", err)
+		http.Error(w, "could not create order", http.StatusInternalServerError)
+		return
+	}
+	persisted(w)
+	a.workflows.Notify()
 
-	// start fake payment pipeline in background
-	go a.simulatePaymentLifecycle(order.ID, total)
+	// The quote is informational until the payout, which re-quotes if this
+	// one has expired, so checkout goes ahead without one.
+	if _, err := a.quoter.LockAtCheckout(r.Context(), order); err != nil {
+		log.Printf("quote order %s at checkout: %v", order.ID.String(), err)
+	}
 
+	// The customer must send exactly AmountUSDC: the subtotal and fees plus
+	// the order's sub-cent payment reference, which is how the deposit is
+	// matched.
 	writeJSON(w, http.StatusCreated, createOrderResponse{
-		OrderID:        order.ID.String(),
-		AmountUSDC:     total,
-		DepositAddress: a.depositAddress,
-		Network:        a.network,
+		OrderID:          order.ID.String(),
+		SubtotalUSDC:     order.SubtotalUSDC,
+		FeesUSDC:         order.FeesUSDC,
+		FeeBreakdown:     order.FeeBreakdown,
+		AmountUSDC:       order.AmountUSDC,
+		PaymentReference: order.PaymentReference,
+		DepositAddress:   a.depositAddress,
+		Network:          a.network,
+		ExpiresAt:        order.ExpiresAt,
+		Quote:            order.Quote,
+		FiatPricing:      order.FiatPricing,
 	})
 }
 
 func (a *App) handleGetOrder(w http.ResponseWriter, r *http.Request) {
-	idStr := r.PathValue("id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
-		return
-	}
-	order, err := a.orders.GetByID(r.Context(), id)
-	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+	order, ok := a.loadCustomerOrder(w, r)
+	if !ok {
 		return
 	}
 	writeJSON(w, http.StatusOK, order)
@@ -398,7 +476,8 @@ func (a *App) handleAdminMuralAccount(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleAdminOrderPayout returns the stored payout metadata for an order plus
-// a live lookup from Mural using the payout request ID, if present.
+// a live lookup from Mural using the payout request ID, if present. It is
+// read-only; POST .../payout/sync applies the live status to the order.
 func (a *App) handleAdminOrderPayout(w http.ResponseWriter, r *http.Request) {
 	if a.mural == nil {
 		http.Error(w, "mural client not configured", http.StatusServiceUnavailable)
@@ -427,26 +506,6 @@ func (a *App) handleAdminOrderPayout(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// If we successfully fetched a live payout, refresh stored metadata and, if needed,
-	// map Mural status -> internal order status.
-	if payout != nil {
-		if payoutUUID, err := uuid.Parse(payout.ID); err == nil {
-			if err := a.orders.UpdatePayoutMetadata(r.Context(), order.ID, payoutUUID, payout.Status); err != nil {
-				log.Printf("failed to refresh payout metadata for order %s: %v", order.ID.String(), err)
-			}
-		}
-		switch payout.Status {
-		case "EXECUTED":
-			// Ensure order is marked withdrawn if payout executed.
-			_ = a.orders.UpdateStatus(r.Context(), order.ID, models.StatusWithdrawn, order.AmountCOP)
-		case "FAILED", "CANCELED":
-			// Mark order as payout_error so UI/admin can see something went wrong.
-			_ = a.orders.UpdateStatus(r.Context(), order.ID, models.StatusPayoutError, order.AmountCOP)
-		}
-		// Reload order so response reflects refreshed fields.
-		order, _ = a.orders.GetByID(r.Context(), order.ID)
-	}
-
 	resp := struct {
 		Order       *models.Order        `json:"order"`
 		MuralPayout *mural.PayoutRequest `json:"muralPayout,omitempty"`
@@ -458,306 +517,239 @@ func (a *App) handleAdminOrderPayout(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
-// muralWebhookEnvelope captures just the parts of the WebhookEventRequestBody / payload
-// that we care about for account balance activity.
-type muralWebhookEnvelope struct {
-	EventCategory string `json:"eventCategory"`
-	Payload       struct {
-		Type        string            `json:"type"`
-		AccountID   string            `json:"accountId"`
-		TokenAmount mural.TokenAmount `json:"tokenAmount"`
-	} `json:"payload"`
-}
-
-// handleMuralWebhook processes Mural webhook callbacks. For this demo we only handle
-// mural_account_balance_activity.account_credited to mark orders as paid when USDC
-// is credited to the configured Account.
-func (a *App) handleMuralWebhook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+// handleAdminSyncOrderPayout fetches the order's payout request from Mural and
+// applies its status through the payout tracker, for when neither the
+// webhook nor the workflow's polling has caught up.
+func (a *App) handleAdminSyncOrderPayout(w http.ResponseWriter, r *http.Request) {
+	if a.mural == nil || a.payouts == nil {
+		http.Error(w, "mural client not configured", http.StatusServiceUnavailable)
 		return
 	}
-
-	if a.mural == nil {
-		http.Error(w, "mural client not configured", http.StatusServiceUnavailable)
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-
-	body, err := io.ReadAll(r.Body)
+	order, err := a.orders.GetByID(r.Context(), orderID)
 	if err != nil {
-		http.Error(w, "failed to read body", http.StatusBadRequest)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if order.MuralPayoutRequestID == uuid.Nil {
+		http.Error(w, "order has no payout request", http.StatusConflict)
 		return
 	}
-	defer r.Body.Close()
 
-	// Verify webhook signature when a public key is configured.
-	if a.webhookKeyPEM != "" {
-		sigB64 := r.Header.Get("x-mural-webhook-signature")
-		sigVersion := r.Header.Get("x-mural-webhook-signature-version")
-		ts := r.Header.Get("x-mural-webhook-timestamp")
+	payout, _, err := a.payouts.Refresh(r.Context(), order, models.ActorAdmin)
+	if err != nil {
+		log.Printf("sync payout for order %s: %v", order.ID.String(), err)
+		writeMuralError(w, "failed to sync payout", err)
+		return
+	}
+	order, err = a.orders.GetByID(r.Context(), order.ID)
+	if err != nil {
+		http.Error(w, "failed to reload order", http.StatusInternalServerError)
+		return
+	}
 
-		if sigB64 == "" || sigVersion == "" || ts == "" {
-			http.Error(w, "missing webhook signature headers", http.StatusUnauthorized)
-			return
-		}
+	writeJSON(w, http.StatusOK, struct {
+		Order       *models.Order        `json:"order"`
+		MuralPayout *mural.PayoutRequest `json:"muralPayout"`
+	}{order, payout})
+}
 
-		sigBytes, err := base64.StdEncoding.DecodeString(sigB64)
-		if err != nil {
-			http.Error(w, "invalid signature encoding", http.StatusUnauthorized)
-			return
-		}
+// handleAdminRetryOrderPayout pays out an order in payout_error again. A
+// payout request still recorded on the order is checked with Mural first: one
+// that failed or was never executed is released, while one that Mural is
+// paying out (or has paid) blocks the retry. The payment workflow then resumes
+// at the quote step and creates a new payout request for the order's next
+// payout attempt.
+func (a *App) handleAdminRetryOrderPayout(w http.ResponseWriter, r *http.Request) {
+	if a.mural == nil || a.payouts == nil {
+		http.Error(w, "mural client not configured", http.StatusServiceUnavailable)
+		return
+	}
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	order, err := a.orders.GetByID(r.Context(), orderID)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if order.Status != models.StatusPayoutError {
+		http.Error(w, "order is "+string(order.Status)+", not payout_error", http.StatusConflict)
+		return
+	}
 
-		block, _ := pem.Decode([]byte(a.webhookKeyPEM))
-		if block == nil {
-			http.Error(w, "invalid webhook public key", http.StatusInternalServerError)
-			return
-		}
-		pubAny, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if payoutID := order.MuralPayoutRequestID; payoutID != uuid.Nil {
+		payout, _, err := a.payouts.Refresh(r.Context(), order, models.ActorAdmin)
 		if err != nil {
-			http.Error(w, "failed to parse webhook public key", http.StatusInternalServerError)
-			return
-		}
-		pub, ok := pubAny.(*ecdsa.PublicKey)
-		if !ok {
-			http.Error(w, "unexpected public key type", http.StatusInternalServerError)
+			log.Printf("check payout for order %s: %v", order.ID.String(), err)
+			writeMuralError(w, "failed to check payout", err)
 			return
 		}
-
-		var rs struct {
-			R, S *big.Int
+		if strings.EqualFold(payout.Status, mural.PayoutStatusAwaitingExecution) {
+			if _, err := a.orders.ReleasePayoutRequest(r.Context(), order.ID, payoutID); err != nil {
+				log.Printf("release payout %s for order %s: %v", payoutID, order.ID.String(), err)
+				http.Error(w, "failed to release payout request", http.StatusInternalServerError)
+				return
+			}
 		}
-		if _, err := asn1.Unmarshal(sigBytes, &rs); err != nil {
-			http.Error(w, "invalid signature format", http.StatusUnauthorized)
+		if order, err = a.orders.GetByID(r.Context(), order.ID); err != nil {
+			http.Error(w, "failed to reload order", http.StatusInternalServerError)
 			return
 		}
-
-		msg := []byte(ts + "." + string(body))
-		hash := sha256.Sum256(msg)
-		if !ecdsa.Verify(pub, hash[:], rs.R, rs.S) {
-			http.Error(w, "invalid webhook signature", http.StatusUnauthorized)
+		if order.MuralPayoutRequestID != uuid.Nil {
+			http.Error(w, "payout request "+order.MuralPayoutRequestID.String()+" is "+payout.Status+
+				" and cannot be retried", http.StatusConflict)
 			return
 		}
 	}
 
-	var env muralWebhookEnvelope
-	if err := json.Unmarshal(body, &env); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
+	err = a.workflows.Resume(r.Context(), payments.WorkflowKind, order.ID, payments.StepQuote)
+	switch {
+	case errors.Is(err, models.ErrWorkflowRunning):
+		http.Error(w, "the order's payment workflow is still running", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("resume payment workflow for order %s: %v", order.ID.String(), err)
+		http.Error(w, "failed to retry payout", http.StatusInternalServerError)
 		return
 	}
+	log.Printf("payout of order %s retried by %s (attempt %d)", order.ID.String(),
+		auth.FromContext(r.Context()).Username, order.PayoutAttempt)
+	writeJSON(w, http.StatusOK, order)
+}
 
-	if env.EventCategory != "MURAL_ACCOUNT_BALANCE_ACTIVITY" {
-		w.WriteHeader(http.StatusNoContent)
+// handleAdminAcceptLatePayment accepts a deposit that arrived after its order
+// expired: the order is marked paid and its payment workflow resumes at the
+// quote step, so the payout goes ahead as for an on-time payment.
+func (a *App) handleAdminAcceptLatePayment(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-
-	if env.Payload.Type != "account_credited" {
-		w.WriteHeader(http.StatusNoContent)
+	p := auth.FromContext(r.Context())
+	err = a.orders.TransitionFrom(r.Context(), orderID, models.StatusLatePayment, models.StatusPaid, models.ActorAdmin,
+		"late payment accepted by "+p.Username)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("accept late payment for order %s: %v", orderID, err)
+		http.Error(w, "failed to accept late payment", http.StatusInternalServerError)
 		return
 	}
-
-	// Only react to credits for the configured Account and USDC token.
-	if env.Payload.AccountID == "" || !strings.EqualFold(env.Payload.TokenAmount.TokenSymbol, "USDC") {
-		w.WriteHeader(http.StatusNoContent)
+	err = a.workflows.Resume(r.Context(), payments.WorkflowKind, orderID, payments.StepQuote)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// No run recorded for the order; a new one skips straight past the paid order's await step.
+		err = a.workflows.Start(r.Context(), payments.WorkflowKind, orderID)
+	}
+	if errors.Is(err, models.ErrWorkflowRunning) {
+		// The run has not noticed the expiry yet; it moves on from the paid order by itself.
+		err = nil
+	}
+	if err != nil {
+		log.Printf("resume payment workflow for order %s: %v", orderID, err)
+		http.Error(w, "late payment accepted but the payout could not be started", http.StatusInternalServerError)
 		return
 	}
-
-	// Best-effort matching: mark the oldest pending_payment order whose amount is
-	// less than or equal to the credited amount as paid.
-	list, err := a.orders.ListAll(r.Context())
+	order, err := a.orders.GetByID(r.Context(), orderID)
 	if err != nil {
-		log.Printf("failed to list orders for webhook: %v", err)
-		w.WriteHeader(http.StatusNoContent)
+		http.Error(w, "failed to reload order", http.StatusInternalServerError)
 		return
 	}
+	writeJSON(w, http.StatusOK, order)
+}
 
-	var target *models.Order
-	for i := len(list) - 1; i >= 0; i-- { // newest first
-		o := list[i]
-		if o.Status == models.StatusPendingPayment && o.AmountUSDC <= env.Payload.TokenAmount.TokenAmount {
-			target = o
-			break
-		}
+// handleAdminOrderEvents returns the status transition history of an order.
+func (a *App) handleAdminOrderEvents(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
 	}
-
-	if target == nil {
-		w.WriteHeader(http.StatusNoContent)
+	events, err := a.orders.ListEvents(r.Context(), orderID)
+	if err != nil {
+		log.Printf("list events for order %s: %v", orderID.String(), err)
+		http.Error(w, "failed to list events", http.StatusInternalServerError)
 		return
 	}
-
-	if err := a.orders.UpdateStatus(r.Context(), target.ID, models.StatusPaid, 0); err != nil {
-		log.Printf("failed to update order %s to paid from webhook: %v", target.ID.String(), err)
+	if events == nil {
+		events = []*models.OrderEvent{}
 	}
-
-	w.WriteHeader(http.StatusNoContent)
+	writeJSON(w, http.StatusOK, events)
 }
 
-// simulatePaymentLifecycle mocks on-chain payment detection, FX conversion and withdrawal
-// for demo purposes only. We now poll the Mural Account for USDC deposits instead
-// of using a fixed sleep, and use real Mural payouts for the COP conversion and withdrawal.
-func (a *App) simulatePaymentLifecycle(id uuid.UUID, amountUSDC float64) {
-	ctx := context.Background()
-
-	// Load the order so we can filter out transactions that occurred before it was created.
-	order, err := a.orders.GetByID(ctx, id)
+// handleAdminOrderWorkflows returns the persisted workflow runs for an order so
+// stalled or failed pipelines are visible to admins.
+func (a *App) handleAdminOrderWorkflows(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	runs, err := a.workflows.RunsForOrder(r.Context(), orderID)
 	if err != nil {
-		log.Printf("failed to load order %s before waiting for payment: %v", id.String(), err)
+		log.Printf("list workflows for order %s: %v", orderID.String(), err)
+		http.Error(w, "failed to list workflows", http.StatusInternalServerError)
 		return
 	}
+	if runs == nil {
+		runs = []*models.WorkflowRun{}
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
 
-	// Poll Transactions for the configured Account and look for an incoming USDC
-	// transaction whose amount matches this order's USDC total and which was
-	// executed after the order was created.  We only
-	// wait 1 minute to keep the demo snappy.
-	paymentDeadline := time.Now().Add(1 * time.Minute)
-	const amountTolerance = 0.000001 // allow minor rounding differences
-	log.Printf("waiting for USDC transaction for order %s amount %.6f created_at=%s", id.String(), amountUSDC, order.CreatedAt.Format(time.RFC3339))
-	paymentMarked := false
-	for {
-		resp, err := a.mural.SearchTransactionsForAccount(ctx, 50)
-		if err != nil {
-			log.Printf("mural search transactions error while waiting for payment for order %s: %v", id.String(), err)
-		} else {
-			log.Printf("search transactions for order %s returned count=%d nextId=%v", id.String(), resp.Count, resp.NextID)
-			var matched bool
-			for _, tx := range resp.Transactions {
-				if !tx.ExecutedAt.IsZero() && tx.ExecutedAt.Before(order.CreatedAt) {
-					// ignore historical transactions that predate the order
-					continue
-				}
-				if !strings.EqualFold(tx.TokenAmount.TokenSymbol, "USDC") {
-					continue
-				}
-				if math.Abs(tx.TokenAmount.TokenAmount-amountUSDC) <= amountTolerance {
-					matched = true
-					break
-				}
-			}
-			if matched {
-				log.Printf("matched incoming USDC transaction for order %s; marking as paid", id.String())
-				if err := a.orders.UpdateStatus(ctx, id, models.StatusPaid, 0); err != nil {
-					log.Printf("failed to update order %s to paid: %v", id.String(), err)
-				}
-				paymentMarked = true
-				break
-			}
-		}
-		if time.Now().After(paymentDeadline) {
-			// For demo purposes, assume payment was received even if we didn't see a
-			// matching on-chain transaction, so the rest of the lifecycle (quote +
-			// payout) can still be exercised.
-			log.Printf("timed out waiting for USDC payment for order %s; proceeding as paid for demo", id.String())
-			if !paymentMarked {
-				if err := a.orders.UpdateStatus(ctx, id, models.StatusPaid, 0); err != nil {
-					log.Printf("failed to update order %s to paid after timeout: %v", id.String(), err)
-				} else {
-					paymentMarked = true
-				}
-			}
-			break
-		}
-		time.Sleep(5 * time.Second)
+// handleMuralWebhook verifies a Mural webhook delivery and dispatches it.
+// Failures to process an event return 500 so Mural redelivers it; events
+// already processed are acknowledged without being applied again.
+func (a *App) handleMuralWebhook(w http.ResponseWriter, r *http.Request) {
+	if a.webhooks == nil {
+		http.Error(w, "webhooks not configured", http.StatusServiceUnavailable)
+		return
 	}
 
-	// quote token-to-fiat to estimate COP amount via Mural.
-	quoteResults, err := a.mural.QuoteTokenToFiat(ctx, amountUSDC, "USDC", "cop")
-	if err != nil {
-		log.Printf("mural quote error for order %s: %v", id.String(), err)
-		// keep simple fallback in case of quote failure.
-		rate := 4000.0
-		cop := amountUSDC * rate
-		// update paid status with COP estimate
-		_ = a.orders.UpdateStatus(ctx, id, models.StatusPaid, cop)
-	} else {
-		var estimatedCOP float64
-		if len(quoteResults) > 0 {
-			estimatedCOP = quoteResults[0].EstimatedFiatAmount.Amount
-		}
-		// update paid status with COP estimate
-		_ = a.orders.UpdateStatus(ctx, id, models.StatusPaid, estimatedCOP)
-	}
-
-	// build a single stubbed COP payout to a demo Colombian bank recipient.
-	payoutReq := mural.CreatePayoutRequestRequest{
-		SourceAccountID: "34b0890c-889b-4b02-8ba7-0011e4af5074",
-		Memo:            "Order " + id.String(),
-		Payouts: []mural.PayoutInfoInput{
-			{
-				Amount: mural.TokenAmount{
-					TokenAmount: amountUSDC,
-					TokenSymbol: "USDC",
-				},
-				PayoutDetails: mural.FiatPayoutDetails{
-					Type:             "fiat",
-					BankName:         "Bancolombia",
-					BankAccountOwner: "Demo Recipient S.A.S.",
-					FiatAndRailDetails: mural.CopDetails{
-						Type:              "cop",
-						Symbol:            "COP",
-						PhoneNumber:       "+573001234567",
-						AccountType:       "CHECKING",
-						BankAccountNumber: "1234567890",
-						DocumentNumber:    "9001234568",
-						DocumentType:      "RUC",
-					},
-				},
-				RecipientInfo: mural.BusinessRecipientInfo{
-					Type:  "business",
-					Name:  "Demo Recipient S.A.S.",
-					Email: "demo-recipient@example.com",
-					PhysicalAddress: mural.PhysicalAddressInput{
-						Address1: "Calle 123 #45-67",
-						Country:  "CO",
-						State:    "ANT",
-						City:     "Medellín",
-						Zip:      "050021",
-					},
-				},
-			},
-		},
-	}
-
-	payout, err := a.mural.CreatePayoutRequest(ctx, payoutReq)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("mural create payout error for order %s: %T %+v", id.String(), err, err)
+		http.Error(w, "failed to read body", http.StatusBadRequest)
 		return
 	}
+	defer r.Body.Close()
 
-	// persist the payout request ID and initial status on the order.
-	if payout.ID != "" {
-		if payoutUUID, err := uuid.Parse(payout.ID); err == nil {
-			if err := a.orders.UpdatePayoutMetadata(ctx, id, payoutUUID, payout.Status); err != nil {
-				log.Printf("failed to update payout metadata for order %s: %v", id.String(), err)
-			}
+	switch {
+	case a.verifier != nil:
+		if err := a.verifier.Verify(r.Header, body); err != nil {
+			log.Printf("rejected mural webhook: %v", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
 		}
+	case !a.allowUnsigned:
+		log.Printf("rejected mural webhook: MURAL_WEBHOOK_PUBLIC_KEY is not set")
+		http.Error(w, "webhook signature verification not configured", http.StatusServiceUnavailable)
+		return
 	}
 
-	executed, err := a.mural.ExecutePayoutRequest(ctx, payout.ID, "FLEXIBLE")
+	event, err := webhooks.Parse(body)
 	if err != nil {
-		log.Printf("mural execute payout error for order %s: %T %+v", id.String(), err, err)
+		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
 
-	// update stored payout status to reflect execution result.
-	if executed.ID != "" {
-		if payoutUUID, err := uuid.Parse(executed.ID); err == nil {
-			if err := a.orders.UpdatePayoutMetadata(ctx, id, payoutUUID, executed.Status); err != nil {
-				log.Printf("failed to update payout metadata after execute for order %s: %v", id.String(), err)
-			}
-		}
-	}
-
-	// For demo purposes, treat both EXECUTED and PENDING payout request statuses
-	// as "good enough" to show a completed withdrawal in the UI.
-	if executed.Status == "EXECUTED" || executed.Status == "PENDING" {
-		// we already set a COP estimate earlier; keep that as the withdrawn amount.
-		order, err := a.orders.GetByID(ctx, id)
-		if err != nil {
-			log.Printf("failed to reload order %s after payout: %v", id.String(), err)
-			return
-		}
-		log.Printf("marking order %s withdrawn with amountCop=%.2f after payout status=%s", id.String(), order.AmountCOP, executed.Status)
-		_ = a.orders.UpdateStatus(ctx, id, models.StatusWithdrawn, order.AmountCOP)
+	if err := a.webhooks.Dispatch(r.Context(), event); err != nil {
+		log.Printf("mural webhook: %v", err)
+		http.Error(w, "failed to process event", http.StatusInternalServerError)
+		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // muralAccountID returns the configured Mural Account ID from env as a fallback.
@@ -769,22 +761,6 @@ func (a *App) muralAccountID() string {
 	return ""
 }
 
-func (a *App) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		if !strings.HasPrefix(auth, "Bearer ") {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		token := strings.TrimPrefix(auth, "Bearer ")
-		if token != "admin-token" {
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
-		}
-		next.ServeHTTP(w, r)
-	}
-}
-
 func (a *App) cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
@@ -792,8 +768,9 @@ func (a *App) cors(next http.Handler) http.Handler {
 			origin = "*"
 		}
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID, "+IdempotencyKeyHeader)
+		w.Header().Set("Access-Control-Expose-Headers", "Idempotent-Replayed")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == http.MethodOptions {
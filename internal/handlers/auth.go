@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type logoutRequest struct {
+	// Everywhere revokes every session of the user, not just this one.
+	Everywhere bool `json:"everywhere"`
+}
+
+type loginResponse struct {
+	Token            string            `json:"token"`
+	ExpiresAt        time.Time         `json:"expiresAt"`
+	RefreshToken     string            `json:"refreshToken"`
+	RefreshExpiresAt time.Time         `json:"refreshExpiresAt"`
+	Role             models.Role       `json:"role"`
+	Permissions      []auth.Permission `json:"permissions"`
+	User             *models.User      `json:"user"`
+}
+
+// meResponse is the signed-in user and what they may do.
+type meResponse struct {
+	*models.User
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+// permissionsFor never returns nil, so clients always get a JSON array.
+func permissionsFor(role models.Role) []auth.Permission {
+	if perms := auth.PermissionsFor(role); perms != nil {
+		return perms
+	}
+	return []auth.Permission{}
+}
+
+func newLoginResponse(u *models.User, t *auth.Tokens) loginResponse {
+	return loginResponse{
+		Token:            t.AccessToken,
+		ExpiresAt:        t.AccessExpiresAt,
+		RefreshToken:     t.RefreshToken,
+		RefreshExpiresAt: t.RefreshExpiresAt,
+		Role:             u.Role,
+		Permissions:      permissionsFor(u.Role),
+		User:             u,
+	}
+}
+
+func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	u, tokens, err := a.auth.Login(r.Context(), req.Username, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("login %q: %v", req.Username, err)
+		http.Error(w, "failed to sign in", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newLoginResponse(u, tokens))
+}
+
+func (a *App) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	u, tokens, err := a.auth.Register(r.Context(), req.Username, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrInvalidUsername), errors.Is(err, auth.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("register %q: %v", req.Username, err)
+		http.Error(w, "failed to register", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newLoginResponse(u, tokens))
+}
+
+func (a *App) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	u, tokens, err := a.auth.Refresh(r.Context(), req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("refresh session: %v", err)
+		http.Error(w, "failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newLoginResponse(u, tokens))
+}
+
+func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var req logoutRequest
+	// The body is optional.
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+	}
+	p := auth.FromContext(r.Context())
+	if err := a.auth.Logout(r.Context(), p, req.Everywhere); err != nil {
+		log.Printf("logout user %s: %v", p.UserID, err)
+		http.Error(w, "failed to sign out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) handleMe(w http.ResponseWriter, r *http.Request) {
+	p := auth.FromContext(r.Context())
+	u, err := a.users.GetByID(r.Context(), p.UserID)
+	if err != nil {
+		log.Printf("load user %s: %v", p.UserID, err)
+		http.Error(w, "failed to load user", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, meResponse{User: u, Permissions: permissionsFor(u.Role)})
+}
+
+// authenticate resolves the request's Bearer token, if any, and stores the
+// principal in the request context. Requests without a valid token continue
+// anonymously; requireAuth and require reject them where needed.
+func (a *App) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := a.auth.Authenticate(r.Context(), token)
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidToken) {
+				log.Printf("authenticate request: %v", err)
+				http.Error(w, "failed to authenticate", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+func (a *App) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromContext(r.Context()) == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// require rejects requests whose principal lacks perm: 401 when anonymous, 403
+// otherwise. Denials are logged so they can be audited.
+func (a *App) require(perm auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := auth.FromContext(r.Context())
+		if p == nil {
+			log.Printf("denied %s %s: not signed in", r.Method, r.URL.Path)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !p.Can(perm) {
+			log.Printf("denied %s %s to user %s (%s): missing %s", r.Method, r.URL.Path, p.Username, p.Role, perm)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
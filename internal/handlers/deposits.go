@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+type assignDepositRequest struct {
+	OrderID string `json:"orderId"`
+}
+
+// handleAdminOrderDeposits returns the deposits attributed to an order.
+func (a *App) handleAdminOrderDeposits(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	deps, err := a.deposits.ListByOrder(r.Context(), orderID)
+	if err != nil {
+		log.Printf("list deposits for order %s: %v", orderID, err)
+		http.Error(w, "failed to list deposits", http.StatusInternalServerError)
+		return
+	}
+	if deps == nil {
+		deps = []*models.Deposit{}
+	}
+	writeJSON(w, http.StatusOK, deps)
+}
+
+// handleAdminUnmatchedDeposits returns the deposits no order could be matched
+// to, for an admin to assign.
+func (a *App) handleAdminUnmatchedDeposits(w http.ResponseWriter, r *http.Request) {
+	deps, err := a.deposits.ListUnmatched(r.Context())
+	if err != nil {
+		log.Printf("list unmatched deposits: %v", err)
+		http.Error(w, "failed to list deposits", http.StatusInternalServerError)
+		return
+	}
+	if deps == nil {
+		deps = []*models.Deposit{}
+	}
+	writeJSON(w, http.StatusOK, deps)
+}
+
+// handleAdminAssignDeposit attributes an unmatched deposit to an order, which
+// counts it towards the order's received amount exactly as if it had been
+// matched automatically.
+func (a *App) handleAdminAssignDeposit(w http.ResponseWriter, r *http.Request) {
+	var req assignDepositRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	orderID, err := uuid.Parse(req.OrderID)
+	if err != nil {
+		http.Error(w, "invalid orderId", http.StatusBadRequest)
+		return
+	}
+	if _, err := a.orders.GetByID(r.Context(), orderID); errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("load order %s: %v", orderID, err)
+		http.Error(w, "failed to load order", http.StatusInternalServerError)
+		return
+	}
+
+	p := auth.FromContext(r.Context())
+	dep, err := a.ledger.Assign(r.Context(), r.PathValue("id"), orderID, models.ActorAdmin)
+	switch {
+	case errors.Is(err, models.ErrDepositNotFound):
+		http.Error(w, "deposit not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrDepositAssigned):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("assign deposit %s to order %s: %v", r.PathValue("id"), orderID, err)
+		http.Error(w, "failed to assign deposit", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user %s assigned deposit %s to order %s", p.Username, dep.ID, orderID)
+
+	order, err := a.orders.GetByID(r.Context(), orderID)
+	if err != nil {
+		http.Error(w, "failed to reload order", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Deposit *models.Deposit `json:"deposit"`
+		Order   *models.Order   `json:"order"`
+	}{dep, order})
+}
+
+// handleAdminBalances lists the orders with money still due from, or owed
+// back to, their customer.
+func (a *App) handleAdminBalances(w http.ResponseWriter, r *http.Request) {
+	orders, err := a.orders.ListWithBalance(r.Context())
+	if err != nil {
+		log.Printf("list order balances: %v", err)
+		http.Error(w, "failed to list balances", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	writeJSON(w, http.StatusOK, orders)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// destinationInput either links an existing Mural counterparty payout method
+// (CounterpartyID + PayoutMethodID) or creates one from Recipient and
+// PayoutDetails.
+type destinationInput struct {
+	Name           string                       `json:"name"`
+	CounterpartyID string                       `json:"counterpartyId"`
+	PayoutMethodID string                       `json:"payoutMethodId"`
+	Recipient      *mural.BusinessRecipientInfo `json:"recipient"`
+	PayoutDetails  *mural.FiatPayoutDetails     `json:"payoutDetails"`
+}
+
+func (in destinationInput) validate() string {
+	linking := in.CounterpartyID != "" || in.PayoutMethodID != ""
+	switch {
+	case strings.TrimSpace(in.Name) == "":
+		return "name is required"
+	case linking && (in.CounterpartyID == "" || in.PayoutMethodID == ""):
+		return "counterpartyId and payoutMethodId must be given together"
+	case linking && (in.Recipient != nil || in.PayoutDetails != nil):
+		return "give either counterpartyId/payoutMethodId or recipient/payoutDetails, not both"
+	case !linking && (in.Recipient == nil || in.PayoutDetails == nil):
+		return "recipient and payoutDetails are required"
+	}
+	if in.PayoutDetails != nil {
+		if err := in.PayoutDetails.Validate(); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// writeMuralError reports a failed Mural call: Mural rejecting our input is
+// the client's problem, anything else is a gateway failure.
+func writeMuralError(w http.ResponseWriter, msg string, err error) {
+	code := mural.StatusCode(err)
+	if code >= 400 && code < 500 && !mural.IsRetryable(err) {
+		http.Error(w, msg+": "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	http.Error(w, msg, http.StatusBadGateway)
+}
+
+func (a *App) handleAdminListDestinations(w http.ResponseWriter, r *http.Request) {
+	list, err := a.destinations.List(r.Context())
+	if err != nil {
+		log.Printf("list payout destinations: %v", err)
+		http.Error(w, "failed to list payout destinations", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []*models.PayoutDestination{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *App) handleAdminGetDestination(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.destinations.GetByID(r.Context(), id)
+	if err != nil {
+		a.writeDestinationError(w, "get payout destination", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// handleAdminCreateDestination registers a payout destination. New
+// destinations must be verified before they can receive payouts.
+func (a *App) handleAdminCreateDestination(w http.ResponseWriter, r *http.Request) {
+	var in destinationInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if msg := in.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if a.mural == nil {
+		http.Error(w, "mural client not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	d := &models.PayoutDestination{
+		Name:           strings.TrimSpace(in.Name),
+		CounterpartyID: in.CounterpartyID,
+		PayoutMethodID: in.PayoutMethodID,
+	}
+	details := in.PayoutDetails
+	if in.Recipient != nil {
+		cp, err := a.mural.CreateCounterparty(r.Context(), *in.Recipient)
+		if err != nil {
+			log.Printf("create mural counterparty: %v", err)
+			writeMuralError(w, "failed to create counterparty", err)
+			return
+		}
+		pm, err := a.mural.CreatePayoutMethod(r.Context(), cp.ID, mural.CreatePayoutMethodRequest{
+			Alias:         d.Name,
+			PayoutDetails: *in.PayoutDetails,
+		})
+		if err != nil {
+			log.Printf("create mural payout method for counterparty %s: %v", cp.ID, err)
+			writeMuralError(w, "failed to create payout method", err)
+			return
+		}
+		d.CounterpartyID = cp.ID
+		d.PayoutMethodID = pm.ID
+	} else {
+		// Linking an existing payout method: take its rail and bank from Mural.
+		pm, err := a.mural.GetPayoutMethod(r.Context(), d.CounterpartyID, d.PayoutMethodID)
+		if err != nil {
+			log.Printf("get mural payout method %s: %v", d.PayoutMethodID, err)
+			writeMuralError(w, "failed to load payout method", err)
+			return
+		}
+		if pm.PayoutDetails.FiatAndRailDetails == nil {
+			http.Error(w, "payout method has no supported fiat rail", http.StatusUnprocessableEntity)
+			return
+		}
+		details = &pm.PayoutDetails
+	}
+	d.BankName = details.BankName
+	d.AccountOwner = details.BankAccountOwner
+	d.Rail = details.FiatAndRailDetails.Rail()
+	d.Currency = details.FiatAndRailDetails.Currency()
+
+	if err := a.destinations.Create(r.Context(), d); err != nil {
+		a.writeDestinationError(w, "create payout destination", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, d)
+}
+
+// handleAdminVerifyDestination confirms the destination's counterparty and
+// payout method exist in Mural and activates it.
+func (a *App) handleAdminVerifyDestination(w http.ResponseWriter, r *http.Request) {
+	if a.mural == nil {
+		http.Error(w, "mural client not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.destinations.GetByID(r.Context(), id)
+	if err != nil {
+		a.writeDestinationError(w, "get payout destination", err)
+		return
+	}
+	if d.Status == models.DestinationDisabled {
+		http.Error(w, "payout destination is disabled", http.StatusConflict)
+		return
+	}
+
+	if _, err := a.mural.GetCounterparty(r.Context(), d.CounterpartyID); err != nil {
+		log.Printf("verify payout destination %s: get counterparty: %v", d.ID, err)
+		writeMuralError(w, "counterparty could not be verified", err)
+		return
+	}
+	pm, err := a.mural.GetPayoutMethod(r.Context(), d.CounterpartyID, d.PayoutMethodID)
+	if err != nil {
+		log.Printf("verify payout destination %s: get payout method: %v", d.ID, err)
+		writeMuralError(w, "payout method could not be verified", err)
+		return
+	}
+	if pm.CounterpartyID != "" && pm.CounterpartyID != d.CounterpartyID {
+		http.Error(w, "payout method belongs to a different counterparty", http.StatusUnprocessableEntity)
+		return
+	}
+
+	d, err = a.destinations.MarkVerified(r.Context(), id)
+	if err != nil {
+		a.writeDestinationError(w, "verify payout destination", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (a *App) handleAdminDisableDestination(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.destinations.Disable(r.Context(), id)
+	if err != nil {
+		a.writeDestinationError(w, "disable payout destination", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// handleAdminSetDefaultDestination makes an active destination the one new
+// payouts are sent to.
+func (a *App) handleAdminSetDefaultDestination(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.destinations.SetDefault(r.Context(), id)
+	if err != nil {
+		a.writeDestinationError(w, "set default payout destination", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (a *App) writeDestinationError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, models.ErrDestinationNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrDestinationExists):
+		http.Error(w, "payout destination already exists", http.StatusConflict)
+	case errors.Is(err, models.ErrDestinationInactive):
+		http.Error(w, "payout destination is not active", http.StatusConflict)
+	default:
+		log.Printf("%s: %v", op, err)
+		http.Error(w, "failed to "+op, http.StatusInternalServerError)
+	}
+}
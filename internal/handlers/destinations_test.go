@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+func TestDestinationInputValidate(t *testing.T) {
+	recipient := &mural.BusinessRecipientInfo{Name: "Acme S.A.S."}
+	details := &mural.FiatPayoutDetails{BankName: "BBVA", BankAccountOwner: "Acme",
+		FiatAndRailDetails: mural.MxnDetails{BankAccountNumber: "012180001234567897"}}
+	badDetails := &mural.FiatPayoutDetails{BankName: "BBVA", BankAccountOwner: "Acme",
+		FiatAndRailDetails: mural.MxnDetails{BankAccountNumber: "123"}}
+
+	tests := []struct {
+		name    string
+		in      destinationInput
+		wantErr string // substring; empty when valid
+	}{
+		{"link", destinationInput{Name: "Main", CounterpartyID: "cp", PayoutMethodID: "pm"}, ""},
+		{"create", destinationInput{Name: "Main", Recipient: recipient, PayoutDetails: details}, ""},
+		{"blank name", destinationInput{Name: "  ", CounterpartyID: "cp", PayoutMethodID: "pm"}, "name is required"},
+		{"counterparty without method", destinationInput{Name: "Main", CounterpartyID: "cp"}, "must be given together"},
+		{"method without counterparty", destinationInput{Name: "Main", PayoutMethodID: "pm"}, "must be given together"},
+		{"link and create", destinationInput{Name: "Main", CounterpartyID: "cp", PayoutMethodID: "pm",
+			Recipient: recipient}, "not both"},
+		{"neither", destinationInput{Name: "Main"}, "recipient and payoutDetails are required"},
+		{"recipient without details", destinationInput{Name: "Main", Recipient: recipient}, "recipient and payoutDetails are required"},
+		{"invalid rail details", destinationInput{Name: "Main", Recipient: recipient, PayoutDetails: badDetails}, "CLABE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in.validate()
+			if tt.wantErr == "" && got != "" || !strings.Contains(got, tt.wantErr) {
+				t.Errorf("validate() = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteMuralError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"rejected input", &mural.ServiceError{Message: "bad iban", StatusCode: http.StatusBadRequest}, http.StatusUnprocessableEntity},
+		{"rate limited", &mural.HTTPError{StatusCode: http.StatusTooManyRequests}, http.StatusBadGateway},
+		{"server error", &mural.HTTPError{StatusCode: http.StatusInternalServerError}, http.StatusBadGateway},
+		{"no response", errors.New("dial tcp: connection refused"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeMuralError(rec, "create counterparty", tt.err)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
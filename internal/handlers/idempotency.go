@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a retry-safe request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// DefaultIdempotencyKeyTTL is how long a key's response is replayed.
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+	// idempotentRequestTimeout bounds how long a request holding a key may
+	// run; its context is cancelled after that.
+	idempotentRequestTimeout = time.Minute
+	// idempotencyStaleAfter is how long a key may be held by a request that
+	// never stored a response (e.g. the process died mid-request) before a
+	// retry may claim it. It is well past idempotentRequestTimeout, so a key
+	// is never claimed while its first request is still running.
+	idempotencyStaleAfter = 5 * time.Minute
+	maxIdempotencyKeyLen  = 255
+	maxIdempotentBody     = 1 << 20
+)
+
+// IdempotencyStore claims Idempotency-Keys and stores the responses to their
+// requests; *models.IdempotencyStore implements it in Postgres.
+type IdempotencyStore interface {
+	// Begin claims a key for a request with the given hash, or returns the
+	// key as stored and false if it is already held.
+	Begin(ctx context.Context, userID uuid.UUID, key, requestHash string, ttl, staleAfter time.Duration) (*models.IdempotencyKey, bool, error)
+	// Complete stores the response to a key's request.
+	Complete(ctx context.Context, userID uuid.UUID, key string, statusCode int, contentType string, body []byte) error
+	// Release forgets a key whose request failed without a stored response.
+	Release(ctx context.Context, userID uuid.UUID, key string) error
+}
+
+// idempotent makes a handler safe to retry with an Idempotency-Key header.
+// The first request with a key runs next, for at most
+// idempotentRequestTimeout, and unless it fails with a 5xx before persisting
+// anything (see persisted) its response is stored and replayed to every later
+// request with the same key and body. The same key with a different body is
+// rejected with 422, and while the first request is still running with 409. Requests without the
+// header are handled as before. Keys are per user, so the wrapped handler
+// must require a signed-in principal.
+func (a *App) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		p := auth.FromContext(r.Context())
+		if key == "" || a.idempotency == nil || p == nil {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody))
+		if err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := requestHash(r, body)
+		stored, claimed, err := a.idempotency.Begin(r.Context(), p.UserID, key, hash, a.idempotencyTTL, idempotencyStaleAfter)
+		if err != nil {
+			log.Printf("claim idempotency key for user %s: %v", p.UserID, err)
+			http.Error(w, "could not process request", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			replay(w, r, stored, hash)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w}
+		ctx, cancel := context.WithTimeout(r.Context(), idempotentRequestTimeout)
+		next(rec, r.WithContext(ctx))
+		cancel()
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// The outcome is stored even if the client has gone away, so its
+		// retry gets the order that was created.
+		ctx = context.WithoutCancel(r.Context())
+		if rec.status >= 500 && !rec.persisted {
+			if err := a.idempotency.Release(ctx, p.UserID, key); err != nil {
+				log.Printf("release idempotency key for user %s: %v", p.UserID, err)
+			}
+			return
+		}
+		if err := a.idempotency.Complete(ctx, p.UserID, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			log.Printf("store idempotent response for user %s: %v", p.UserID, err)
+		}
+	}
+}
+
+// replay answers a request whose key is already held.
+func replay(w http.ResponseWriter, r *http.Request, stored *models.IdempotencyKey, hash string) {
+	switch {
+	case stored.RequestHash != hash:
+		http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+	case !stored.Completed():
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "a request with this Idempotency-Key is still being processed", http.StatusConflict)
+	default:
+		log.Printf("replaying %s %s for idempotency key %q", r.Method, r.URL.Path, stored.Key)
+		if stored.ContentType != "" {
+			w.Header().Set("Content-Type", stored.ContentType)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(stored.StatusCode)
+		_, _ = w.Write(stored.ResponseBody)
+	}
+}
+
+// requestHash identifies a request by method, path and body. JSON bodies are
+// compacted first, so whitespace does not make a retry look different.
+func requestHash(r *http.Request, body []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter passes a response through while keeping a copy of its
+// status and body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	persisted bool
+}
+
+// persisted tells the idempotent wrapper, if the request has one, that the
+// handler has committed a change. From then on the response is stored even
+// if it is an error, so a retry cannot repeat the change.
+func persisted(w http.ResponseWriter) {
+	if rec, ok := w.(*recordingWriter); ok {
+		rec.persisted = true
+	}
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// PurgeIdempotencyKeys deletes expired idempotency keys every interval until
+// ctx is cancelled.
+func PurgeIdempotencyKeys(ctx context.Context, store *models.IdempotencyStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := store.DeleteExpired(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("purge idempotency keys: %v", err)
+		} else if n > 0 {
+			log.Printf("purged %d expired idempotency keys", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+// memoryIdempotencyStore is an IdempotencyStore in memory. Keys never expire
+// or go stale.
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]*models.IdempotencyKey
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: map[string]*models.IdempotencyKey{}}
+}
+
+func (s *memoryIdempotencyStore) Begin(_ context.Context, userID uuid.UUID, key, requestHash string, _, _ time.Duration) (*models.IdempotencyKey, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := userID.String() + "/" + key
+	if k, ok := s.keys[id]; ok {
+		stored := *k
+		return &stored, false, nil
+	}
+	k := &models.IdempotencyKey{UserID: userID, Key: key, RequestHash: requestHash}
+	s.keys[id] = k
+	stored := *k
+	return &stored, true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, userID uuid.UUID, key string, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[userID.String()+"/"+key]
+	if !ok {
+		return models.ErrIdempotencyKeyNotFound
+	}
+	k.StatusCode, k.ContentType, k.ResponseBody = statusCode, contentType, body
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, userID uuid.UUID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := userID.String() + "/" + key
+	if k, ok := s.keys[id]; ok && !k.Completed() {
+		delete(s.keys, id)
+	}
+	return nil
+}
+
+// idempotencyTest wraps handler with App.idempotent over a memory store and
+// counts the requests that reach it.
+type idempotencyTest struct {
+	user    *auth.Principal
+	handler http.HandlerFunc
+
+	mu    sync.Mutex
+	calls int
+}
+
+func newIdempotencyTest(handler http.HandlerFunc) *idempotencyTest {
+	it := &idempotencyTest{user: &auth.Principal{UserID: uuid.New(), Role: models.RoleCustomer}}
+	app := &App{idempotency: newMemoryIdempotencyStore(), idempotencyTTL: time.Hour}
+	it.handler = app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		it.mu.Lock()
+		it.calls++
+		it.mu.Unlock()
+		handler(w, r)
+	})
+	return it
+}
+
+func (it *idempotencyTest) do(key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	r = r.WithContext(auth.WithPrincipal(r.Context(), it.user))
+	w := httptest.NewRecorder()
+	it.handler(w, r)
+	return w
+}
+
+func (it *idempotencyTest) handled() int {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.calls
+}
+
+func created(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(`{"id":"order-1"}`))
+}
+
+func TestIdempotentReplaysResponse(t *testing.T) {
+	it := newIdempotencyTest(created)
+
+	first := it.do("key-1", `{"items": [1]}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: %d, replayed %q", first.Code, first.Header().Get("Idempotent-Replayed"))
+	}
+	for _, body := range []string{`{"items": [1]}`, `{"items":[1]}`} {
+		again := it.do("key-1", body)
+		if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() ||
+			again.Header().Get("Content-Type") != "application/json" ||
+			again.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("replay of %s: %d %q (%s), replayed %q", body, again.Code, again.Body.String(),
+				again.Header().Get("Content-Type"), again.Header().Get("Idempotent-Replayed"))
+		}
+	}
+	if n := it.handled(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestIdempotentRejectsDifferentBody(t *testing.T) {
+	it := newIdempotencyTest(created)
+	it.do("key-1", `{"items": [1]}`)
+	if w := it.do("key-1", `{"items": [2]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: %d, want 422", w.Code)
+	}
+	if w := it.do("key-2", `{"items": [2]}`); w.Code != http.StatusCreated {
+		t.Errorf("new key: %d, want 201", w.Code)
+	}
+	if n := it.handled(); n != 2 {
+		t.Errorf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotentConflictWhileInFlight(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	it := newIdempotencyTest(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		created(w, r)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- it.do("key-1", `{}`) }()
+	<-started
+
+	w := it.do("key-1", `{}`)
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("while in flight: %d, Retry-After %q; want 409 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	close(finish)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first request: %d", first.Code)
+	}
+	if w := it.do("key-1", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("after it finished: %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotentReleasesKeyAfterServerError(t *testing.T) {
+	fail := true
+	it := newIdempotencyTest(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "database unavailable", http.StatusInternalServerError)
+			return
+		}
+		created(w, r)
+	})
+
+	if w := it.do("key-1", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("first request: %d", w.Code)
+	}
+	fail = false
+	if w := it.do("key-1", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after 500: %d, replayed %q; want it handled afresh", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if n := it.handled(); n != 2 {
+		t.Errorf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotentKeepsKeyOnceChangePersisted(t *testing.T) {
+	it := newIdempotencyTest(func(w http.ResponseWriter, r *http.Request) {
+		persisted(w)
+		http.Error(w, "order created but not returned", http.StatusInternalServerError)
+	})
+
+	it.do("key-1", `{}`)
+	w := it.do("key-1", `{}`)
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: %d, replayed %q; want the stored 500", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if n := it.handled(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestIdempotentClientErrorsAreStored(t *testing.T) {
+	it := newIdempotencyTest(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown product", http.StatusBadRequest)
+	})
+	it.do("key-1", `{}`)
+	if w := it.do("key-1", `{}`); w.Code != http.StatusBadRequest || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry of a 400: %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	it := newIdempotencyTest(created)
+	it.do("", `{}`)
+	it.do("", `{}`)
+	if n := it.handled(); n != 2 {
+		t.Errorf("handler ran %d times without a key, want 2", n)
+	}
+	if w := it.do(strings.Repeat("k", maxIdempotencyKeyLen+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("overlong key: %d, want 400", w.Code)
+	}
+}
+
+func TestRequestHash(t *testing.T) {
+	post := func(path string) *http.Request { return httptest.NewRequest(http.MethodPost, path, nil) }
+	a := requestHash(post("/api/orders"), []byte(`{"a": 1, "b": [1, 2]}`))
+	if b := requestHash(post("/api/orders"), []byte("{\"a\":1,\n \"b\":[1,2]}")); a != b {
+		t.Error("whitespace changes the hash")
+	}
+	if b := requestHash(post("/api/orders"), []byte(`{"a": 2, "b": [1, 2]}`)); a == b {
+		t.Error("body does not change the hash")
+	}
+	if b := requestHash(post("/api/other"), []byte(`{"a": 1, "b": [1, 2]}`)); a == b {
+		t.Error("path does not change the hash")
+	}
+	if b := requestHash(httptest.NewRequest(http.MethodPut, "/api/orders", nil), []byte(`{"a": 1, "b": [1, 2]}`)); a == b {
+		t.Error("method does not change the hash")
+	}
+}
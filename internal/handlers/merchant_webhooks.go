@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+const (
+	defaultDeliveriesPageSize = 50
+	maxDeliveriesPageSize     = 200
+)
+
+// merchantWebhookInput registers or updates a merchant webhook. Events lists
+// the event types to send (see models.WebhookEventTypes); empty means all.
+// Active is only read on update and defaults to true.
+type merchantWebhookInput struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
+
+func (in merchantWebhookInput) validate() string {
+	u, err := url.Parse(strings.TrimSpace(in.URL))
+	switch {
+	case in.URL == "":
+		return "url is required"
+	case err != nil || u.Host == "" || u.User != nil:
+		return "url must be an absolute URL without credentials"
+	case u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())):
+		return "url must use https"
+	}
+	for _, e := range in.Events {
+		if !slices.Contains(models.WebhookEventTypes, e) {
+			return "unknown event type " + strconv.Quote(e) + "; expected one of " + strings.Join(models.WebhookEventTypes, ", ")
+		}
+	}
+	return ""
+}
+
+// isLoopback reports whether host is this machine, which plain http is
+// allowed to for local development.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (in merchantWebhookInput) webhook(id uuid.UUID) *models.MerchantWebhook {
+	events := slices.Compact(slices.Sorted(slices.Values(in.Events)))
+	wh := &models.MerchantWebhook{
+		ID:          id,
+		URL:         strings.TrimSpace(in.URL),
+		Description: strings.TrimSpace(in.Description),
+		Events:      events,
+		Active:      true,
+	}
+	if in.Active != nil {
+		wh.Active = *in.Active
+	}
+	return wh
+}
+
+// merchantWebhookWithSecret is a webhook together with its signing secret,
+// returned only when the secret is first handed out.
+type merchantWebhookWithSecret struct {
+	*models.MerchantWebhook
+	Secret string `json:"secret"`
+}
+
+func (a *App) handleAdminListMerchantWebhooks(w http.ResponseWriter, r *http.Request) {
+	list, err := a.merchantWebhooks.List(r.Context())
+	if err != nil {
+		log.Printf("list merchant webhooks: %v", err)
+		http.Error(w, "failed to list merchant webhooks", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []*models.MerchantWebhook{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *App) handleAdminGetMerchantWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	wh, err := a.merchantWebhooks.GetByID(r.Context(), id)
+	if err != nil {
+		writeMerchantWebhookError(w, "get merchant webhook", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// handleAdminCreateMerchantWebhook registers an endpoint. The response is the
+// only time its signing secret is shown.
+func (a *App) handleAdminCreateMerchantWebhook(w http.ResponseWriter, r *http.Request) {
+	var in merchantWebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if msg := in.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	wh := in.webhook(uuid.Nil)
+	if err := a.merchantWebhooks.Create(r.Context(), wh); err != nil {
+		writeMerchantWebhookError(w, "create merchant webhook", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, merchantWebhookWithSecret{MerchantWebhook: wh, Secret: wh.Secret})
+}
+
+func (a *App) handleAdminUpdateMerchantWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var in merchantWebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if msg := in.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	wh := in.webhook(id)
+	if err := a.merchantWebhooks.Update(r.Context(), wh); err != nil {
+		writeMerchantWebhookError(w, "update merchant webhook", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, wh)
+}
+
+func (a *App) handleAdminDeleteMerchantWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := a.merchantWebhooks.Delete(r.Context(), id); err != nil {
+		writeMerchantWebhookError(w, "delete merchant webhook", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminRotateMerchantWebhookSecret replaces an endpoint's signing
+// secret; deliveries are signed with the new one from their next attempt.
+func (a *App) handleAdminRotateMerchantWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	wh, err := a.merchantWebhooks.RotateSecret(r.Context(), id)
+	if err != nil {
+		writeMerchantWebhookError(w, "rotate merchant webhook secret", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, merchantWebhookWithSecret{MerchantWebhook: wh, Secret: wh.Secret})
+}
+
+// handleAdminListWebhookDeliveries is an endpoint's delivery log, newest
+// first, optionally filtered by ?status=pending|delivered|failed.
+func (a *App) handleAdminListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	status := models.WebhookDeliveryStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.DeliveryPending, models.DeliverySucceeded, models.DeliveryFailed:
+	default:
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeliveriesPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDeliveriesPageSize)
+	}
+
+	if _, err := a.merchantWebhooks.GetByID(r.Context(), id); err != nil {
+		writeMerchantWebhookError(w, "get merchant webhook", err)
+		return
+	}
+	list, err := a.webhookDeliveries.ListByWebhook(r.Context(), id, status, limit)
+	if err != nil {
+		log.Printf("list deliveries for merchant webhook %s: %v", id, err)
+		http.Error(w, "failed to list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []*models.WebhookDelivery{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// webhookDeliveryResponse is a delivery with every attempt made to send it.
+type webhookDeliveryResponse struct {
+	*models.WebhookDelivery
+	AttemptLog []*models.WebhookDeliveryAttempt `json:"attemptLog"`
+}
+
+func (a *App) handleAdminGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.webhookDeliveries.GetByID(r.Context(), id)
+	if err != nil {
+		writeMerchantWebhookError(w, "get webhook delivery", err)
+		return
+	}
+	a.writeWebhookDelivery(r.Context(), w, d)
+}
+
+// handleAdminRedeliverWebhook sends a delivery again straight away, whatever
+// its status, and answers with the outcome. If that attempt fails the
+// delivery is retried with backoff as if it were new.
+func (a *App) handleAdminRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	if a.webhookDeliverer == nil {
+		http.Error(w, "merchant webhook delivery not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.webhookDeliveries.Redeliver(r.Context(), id, a.webhookDeliverer.Lease())
+	if err != nil {
+		writeMerchantWebhookError(w, "redeliver webhook", err)
+		return
+	}
+	// The delivery is leased to this request; finish the attempt even if the
+	// client goes away, or the delivery waits out the lease.
+	ctx := context.WithoutCancel(r.Context())
+	if _, err := a.webhookDeliverer.Deliver(ctx, d); err != nil {
+		log.Printf("redeliver webhook delivery %s: %v", id, err)
+		http.Error(w, "failed to redeliver webhook", http.StatusInternalServerError)
+		return
+	}
+	if d, err = a.webhookDeliveries.GetByID(ctx, id); err != nil {
+		writeMerchantWebhookError(w, "get webhook delivery", err)
+		return
+	}
+	a.writeWebhookDelivery(ctx, w, d)
+}
+
+func (a *App) writeWebhookDelivery(ctx context.Context, w http.ResponseWriter, d *models.WebhookDelivery) {
+	attempts, err := a.webhookDeliveries.ListAttempts(ctx, d.ID)
+	if err != nil {
+		log.Printf("list attempts for webhook delivery %s: %v", d.ID, err)
+		http.Error(w, "failed to load webhook delivery", http.StatusInternalServerError)
+		return
+	}
+	if attempts == nil {
+		attempts = []*models.WebhookDeliveryAttempt{}
+	}
+	writeJSON(w, http.StatusOK, webhookDeliveryResponse{WebhookDelivery: d, AttemptLog: attempts})
+}
+
+func writeMerchantWebhookError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, models.ErrMerchantWebhookNotFound), errors.Is(err, models.ErrWebhookDeliveryNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrWebhookDeliveryInFlight):
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "webhook delivery is being sent, retry shortly", http.StatusConflict)
+	default:
+		log.Printf("%s: %v", op, err)
+		http.Error(w, "failed to "+op, http.StatusInternalServerError)
+	}
+}
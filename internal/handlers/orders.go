@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+const (
+	defaultOrdersPageSize = 20
+	maxOrdersPageSize     = 100
+)
+
+type ordersPage struct {
+	Results []*models.Order `json:"results"`
+	// NextID is passed back as ?nextId= to fetch the following page; it is
+	// empty on the last page.
+	NextID string `json:"nextId,omitempty"`
+}
+
+// paymentInstructions tell a customer how to pay an order.
+type paymentInstructions struct {
+	OrderID          string             `json:"orderId"`
+	Status           models.OrderStatus `json:"status"`
+	AmountUSDC       money.Decimal      `json:"amountUsdc"`
+	ReceivedUSDC     money.Decimal      `json:"receivedUsdc"`
+	RemainingUSDC    money.Decimal      `json:"remainingUsdc"`
+	PaymentReference string             `json:"paymentReference"`
+	DepositAddress   string             `json:"depositAddress"`
+	Network          string             `json:"network"`
+	ExpiresAt        *time.Time         `json:"expiresAt,omitempty"`
+}
+
+// canViewOrder reports whether p may see order: its own customer, or staff
+// who can view orders.
+func canViewOrder(p *auth.Principal, order *models.Order) bool {
+	if p.Can(auth.PermViewOrders) {
+		return true
+	}
+	return order.CustomerID != uuid.Nil && order.CustomerID == p.UserID
+}
+
+// loadCustomerOrder loads the {id} order for the signed-in principal. Orders
+// the principal may not see are reported as not found, so order IDs cannot be
+// probed.
+func (a *App) loadCustomerOrder(w http.ResponseWriter, r *http.Request) (*models.Order, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return nil, false
+	}
+	order, err := a.orders.GetByID(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("load order %s: %v", id, err)
+		http.Error(w, "failed to load order", http.StatusInternalServerError)
+		return nil, false
+	}
+	if p := auth.FromContext(r.Context()); !canViewOrder(p, order) {
+		log.Printf("denied order %s to user %s", id, p.Username)
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	return order, true
+}
+
+// handleMyOrders pages through the signed-in customer's orders, newest first.
+func (a *App) handleMyOrders(w http.ResponseWriter, r *http.Request) {
+	limit := defaultOrdersPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxOrdersPageSize)
+	}
+	var after uuid.UUID
+	if v := r.URL.Query().Get("nextId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "invalid nextId", http.StatusBadRequest)
+			return
+		}
+		after = id
+	}
+
+	p := auth.FromContext(r.Context())
+	orders, more, err := a.orders.ListByCustomer(r.Context(), p.UserID, after, limit)
+	if err != nil {
+		log.Printf("list orders of user %s: %v", p.UserID, err)
+		http.Error(w, "failed to list orders", http.StatusInternalServerError)
+		return
+	}
+	page := ordersPage{Results: orders}
+	if page.Results == nil {
+		page.Results = []*models.Order{}
+	}
+	if more {
+		page.NextID = orders[len(orders)-1].ID.String()
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleGetOrderPayment re-opens an unpaid or underpaid order: it returns
+// what is still due and where to send it.
+func (a *App) handleGetOrderPayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := a.loadCustomerOrder(w, r)
+	if !ok {
+		return
+	}
+	if order.Status != models.StatusPendingPayment && order.Status != models.StatusUnderpaid {
+		http.Error(w, "order is not awaiting payment (status "+string(order.Status)+")", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.paymentInstructions(order))
+}
+
+func (a *App) paymentInstructions(order *models.Order) paymentInstructions {
+	return paymentInstructions{
+		OrderID:          order.ID.String(),
+		Status:           order.Status,
+		AmountUSDC:       order.AmountUSDC,
+		ReceivedUSDC:     order.ReceivedUSDC,
+		RemainingUSDC:    order.BalanceDueUSDC,
+		PaymentReference: order.PaymentReference,
+		DepositAddress:   a.depositAddress,
+		Network:          a.network,
+		ExpiresAt:        order.ExpiresAt,
+	}
+}
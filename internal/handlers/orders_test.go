@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+func TestCanViewOrder(t *testing.T) {
+	owner, other := uuid.New(), uuid.New()
+	owned := &models.Order{ID: uuid.New(), CustomerID: owner}
+	guest := &models.Order{ID: uuid.New()} // placed before orders had customers
+
+	tests := []struct {
+		name  string
+		user  uuid.UUID
+		role  models.Role
+		order *models.Order
+		want  bool
+	}{
+		{"owner", owner, models.RoleCustomer, owned, true},
+		{"other customer", other, models.RoleCustomer, owned, false},
+		{"customer, order without customer", other, models.RoleCustomer, guest, false},
+		{"customer without id, order without customer", uuid.Nil, models.RoleCustomer, guest, false},
+		{"support", other, models.RoleSupport, owned, true},
+		{"finance", other, models.RoleFinance, guest, true},
+		{"operator", other, models.RoleOperator, owned, true},
+		{"super admin", other, models.RoleSuperAdmin, owned, true},
+	}
+	for _, tt := range tests {
+		p := &auth.Principal{UserID: tt.user, Role: tt.role}
+		if got := canViewOrder(p, tt.order); got != tt.want {
+			t.Errorf("%s: canViewOrder = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
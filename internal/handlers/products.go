@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// handleProducts lists the active catalog for the storefront.
+func (a *App) handleProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := a.products.List(r.Context(), false)
+	if err != nil {
+		log.Printf("list products: %v", err)
+		http.Error(w, "failed to list products", http.StatusInternalServerError)
+		return
+	}
+	if products == nil {
+		products = []*models.Product{}
+	}
+	writeJSON(w, http.StatusOK, products)
+}
+
+// invalidItemError is a client error in an order's line items.
+type invalidItemError struct {
+	msg string
+}
+
+func (e *invalidItemError) Error() string { return e.msg }
+
+// priceItems resolves each requested line against the catalog and returns the
+// order items (with server-side names and prices) and their total in the
+// currency the products are priced in; an order's products must all share
+// one. Repeated product IDs are merged into a single line.
+func (a *App) priceItems(ctx context.Context, in []createOrderItemInput) ([]models.OrderItem, money.Money, error) {
+	ids, quantities, err := mergeItems(in)
+	if err != nil {
+		return nil, money.Money{}, err
+	}
+	catalog, err := a.products.GetMany(ctx, ids)
+	if err != nil {
+		return nil, money.Money{}, err
+	}
+	return priceFromCatalog(ids, quantities, catalog)
+}
+
+// mergeItems checks the requested lines and returns their product IDs, in
+// order of first appearance, with the total quantity of each.
+func mergeItems(in []createOrderItemInput) ([]string, map[string]int, error) {
+	quantities := map[string]int{}
+	var ids []string
+	for _, it := range in {
+		id := strings.TrimSpace(it.ProductID)
+		if id == "" {
+			return nil, nil, &invalidItemError{msg: "item is missing productId"}
+		}
+		if it.Quantity <= 0 {
+			return nil, nil, &invalidItemError{msg: "invalid quantity for product " + id}
+		}
+		if _, seen := quantities[id]; !seen {
+			ids = append(ids, id)
+		}
+		quantities[id] += it.Quantity
+	}
+	return ids, quantities, nil
+}
+
+// priceFromCatalog prices the merged lines from mergeItems with the catalog
+// products they name.
+func priceFromCatalog(ids []string, quantities map[string]int, catalog map[string]*models.Product) ([]models.OrderItem, money.Money, error) {
+	var (
+		total money.Money
+		err   error
+	)
+	items := make([]models.OrderItem, 0, len(ids))
+	for _, id := range ids {
+		p, ok := catalog[id]
+		if !ok {
+			return nil, money.Money{}, &invalidItemError{msg: "unknown product " + id}
+		}
+		if !p.Active {
+			return nil, money.Money{}, &invalidItemError{msg: "product " + id + " is not available"}
+		}
+		price := p.Price()
+		if len(items) == 0 {
+			total = money.Zero(price.Currency)
+		} else if price.Currency != total.Currency {
+			return nil, money.Money{}, &invalidItemError{msg: "products priced in " + string(total.Currency) +
+				" and " + string(price.Currency) + " cannot be ordered together"}
+		}
+		item := models.OrderItem{
+			ProductID: p.ID,
+			Name:      p.Name,
+			PriceUSDC: p.PriceUSDC,
+			Quantity:  quantities[id],
+		}
+		line := price.MulInt(int64(item.Quantity))
+		if price.Currency != money.USDC {
+			item.PriceFiat, item.Currency = &price.Amount, price.Currency
+		}
+		if total, err = total.Add(line); err != nil {
+			return nil, money.Money{}, err
+		}
+		items = append(items, item)
+	}
+	return items, total, nil
+}
+
+// convertToUSDC converts the total of fiat-priced items to the USDC subtotal
+// the customer pays, and prices each item at the same rate. USDC totals are
+// returned as they are, with no pricing.
+func (a *App) convertToUSDC(ctx context.Context, items []models.OrderItem, total money.Money) (money.Money, *models.FiatPricing, error) {
+	if total.Currency == money.USDC {
+		return total, nil, nil
+	}
+	subtotal, pricing, err := a.quoter.FiatToUSDC(ctx, total)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+	for i := range items {
+		items[i].PriceUSDC = items[i].PriceFiat.Div(pricing.Rate, money.USDC.Scale())
+	}
+	return subtotal, pricing, nil
+}
+
+type productInput struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	Description   string        `json:"description"`
+	PriceUSDC     money.Decimal `json:"priceUsdc"`
+	PriceCurrency string        `json:"priceCurrency"`
+	PriceFiat     money.Decimal `json:"priceFiat"`
+	ImageURL      string        `json:"imageUrl"`
+	Active        *bool         `json:"active"`
+}
+
+// currency returns the currency the product is priced in; USDC by default.
+func (in productInput) currency() money.Currency {
+	if strings.TrimSpace(in.PriceCurrency) == "" {
+		return money.USDC
+	}
+	return money.ParseCurrency(in.PriceCurrency)
+}
+
+func (in productInput) validate() string {
+	switch c := in.currency(); {
+	case strings.TrimSpace(in.Name) == "":
+		return "name is required"
+	case in.PriceUSDC.Sign() < 0:
+		return "priceUsdc must not be negative"
+	case c == money.USDC:
+		return ""
+	case !supportedFiat(c):
+		return "unsupported priceCurrency " + string(c)
+	case in.PriceFiat.Sign() <= 0:
+		return "priceFiat must be positive for products priced in " + string(c)
+	}
+	return ""
+}
+
+// product returns the catalog product described by in, with the given ID.
+func (in productInput) product(id string) *models.Product {
+	p := &models.Product{
+		ID:            id,
+		Name:          in.Name,
+		Description:   in.Description,
+		PriceUSDC:     in.PriceUSDC,
+		PriceCurrency: in.currency(),
+		ImageURL:      in.ImageURL,
+		Active:        in.Active == nil || *in.Active,
+	}
+	if p.PriceCurrency != money.USDC {
+		p.PriceFiat = in.PriceFiat
+	}
+	return p
+}
+
+func supportedFiat(c money.Currency) bool {
+	_, ok := mural.RailForCurrency(c)
+	return ok
+}
+
+func (a *App) handleAdminListProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := a.products.List(r.Context(), true)
+	if err != nil {
+		log.Printf("list products: %v", err)
+		http.Error(w, "failed to list products", http.StatusInternalServerError)
+		return
+	}
+	if products == nil {
+		products = []*models.Product{}
+	}
+	writeJSON(w, http.StatusOK, products)
+}
+
+func (a *App) handleAdminGetProduct(w http.ResponseWriter, r *http.Request) {
+	p, err := a.products.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, models.ErrProductNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("get product: %v", err)
+		http.Error(w, "failed to get product", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *App) handleAdminCreateProduct(w http.ResponseWriter, r *http.Request) {
+	var in productInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	in.ID = strings.TrimSpace(in.ID)
+	if in.ID == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	if msg := in.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	p := in.product(in.ID)
+	if err := a.products.Create(r.Context(), p); err != nil {
+		if errors.Is(err, models.ErrProductExists) {
+			http.Error(w, "product already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("create product: %v", err)
+		http.Error(w, "failed to create product", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (a *App) handleAdminUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	var in productInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if msg := in.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	p := in.product(r.PathValue("id"))
+	if err := a.products.Update(r.Context(), p); err != nil {
+		if errors.Is(err, models.ErrProductNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("update product: %v", err)
+		http.Error(w, "failed to update product", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *App) handleAdminDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	if err := a.products.Delete(r.Context(), r.PathValue("id")); err != nil {
+		if errors.Is(err, models.ErrProductNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("delete product: %v", err)
+		http.Error(w, "failed to delete product", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
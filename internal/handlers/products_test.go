@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+func TestMergeItems(t *testing.T) {
+	ids, quantities, err := mergeItems([]createOrderItemInput{
+		{ProductID: "mug", Quantity: 1},
+		{ProductID: " tee ", Quantity: 2},
+		{ProductID: "mug", Quantity: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"mug", "tee"}) || quantities["mug"] != 4 || quantities["tee"] != 2 {
+		t.Errorf("ids %v, quantities %v", ids, quantities)
+	}
+
+	for name, in := range map[string]createOrderItemInput{
+		"missing product": {ProductID: " ", Quantity: 1},
+		"zero quantity":   {ProductID: "mug", Quantity: 0},
+		"negative":        {ProductID: "mug", Quantity: -1},
+	} {
+		var itemErr *invalidItemError
+		if _, _, err := mergeItems([]createOrderItemInput{in}); !errors.As(err, &itemErr) {
+			t.Errorf("%s: err = %v, want *invalidItemError", name, err)
+		}
+	}
+}
+
+func TestPriceFromCatalog(t *testing.T) {
+	catalog := map[string]*models.Product{
+		"mug":     {ID: "mug", Name: "Mug", PriceUSDC: money.MustParse("12.5"), Active: true},
+		"tee":     {ID: "tee", Name: "Tee", PriceUSDC: money.MustParse("20.000001"), PriceCurrency: money.USDC, Active: true},
+		"retired": {ID: "retired", Name: "Retired", PriceUSDC: money.MustParse("1"), Active: false},
+	}
+
+	items, total, err := priceFromCatalog([]string{"mug", "tee"}, map[string]int{"mug": 4, "tee": 2}, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Currency != money.USDC || !total.Amount.Equal(money.MustParse("90.000002")) {
+		t.Errorf("total = %s, want 90.000002 USDC", total)
+	}
+	if len(items) != 2 || items[0].Name != "Mug" || items[0].Quantity != 4 || !items[0].PriceUSDC.Equal(money.MustParse("12.5")) ||
+		items[0].PriceFiat != nil || items[1].ProductID != "tee" || items[1].Quantity != 2 {
+		t.Errorf("items = %+v", items)
+	}
+
+	for name, id := range map[string]string{"unknown": "hat", "inactive": "retired"} {
+		var itemErr *invalidItemError
+		if _, _, err := priceFromCatalog([]string{"mug", id}, map[string]int{"mug": 1, id: 1}, catalog); !errors.As(err, &itemErr) {
+			t.Errorf("%s: err = %v, want *invalidItemError", name, err)
+		}
+	}
+}
+
+func TestProductInputValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   productInput
+		want string
+	}{
+		{"usdc", productInput{Name: "Mug", PriceUSDC: money.MustParse("12.5")}, ""},
+		{"free", productInput{Name: "Sticker"}, ""},
+		{"blank name", productInput{Name: " ", PriceUSDC: money.MustParse("1")}, "name is required"},
+		{"negative price", productInput{Name: "Mug", PriceUSDC: money.MustParse("-1")}, "priceUsdc must not be negative"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.validate(); got != tt.want {
+			t.Errorf("%s: validate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProductInputProduct(t *testing.T) {
+	inactive := false
+	p := productInput{Name: "Mug", PriceUSDC: money.MustParse("12.5"), Active: &inactive}.product("mug")
+	if p.ID != "mug" || p.Active || p.PriceCurrency != money.USDC {
+		t.Errorf("product = %+v", p)
+	}
+	if p := (productInput{Name: "Mug"}).product("mug"); !p.Active {
+		t.Error("products are active unless disabled")
+	}
+}
+
+func TestPriceFromCatalogFiat(t *testing.T) {
+	catalog := map[string]*models.Product{
+		"poncho":   {ID: "poncho", Name: "Poncho", PriceCurrency: money.MXN, PriceFiat: money.MustParse("450"), Active: true},
+		"sombrero": {ID: "sombrero", Name: "Sombrero", PriceCurrency: money.MXN, PriceFiat: money.MustParse("300.5"), Active: true},
+		"mug":      {ID: "mug", Name: "Mug", PriceUSDC: money.MustParse("12.5"), Active: true},
+	}
+
+	items, total, err := priceFromCatalog([]string{"poncho", "sombrero"}, map[string]int{"poncho": 2, "sombrero": 1}, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Currency != money.MXN || !total.Amount.Equal(money.MustParse("1200.5")) {
+		t.Errorf("total = %s, want 1200.5 MXN", total)
+	}
+	for _, it := range items {
+		if it.PriceFiat == nil || it.Currency != money.MXN {
+			t.Errorf("item %s has no fiat price: %+v", it.ProductID, it)
+		}
+	}
+	if !items[1].PriceFiat.Equal(money.MustParse("300.5")) {
+		t.Errorf("sombrero priced at %s", items[1].PriceFiat)
+	}
+
+	var itemErr *invalidItemError
+	if _, _, err := priceFromCatalog([]string{"poncho", "mug"}, map[string]int{"poncho": 1, "mug": 1}, catalog); !errors.As(err, &itemErr) {
+		t.Errorf("mixed currencies: err = %v, want *invalidItemError", err)
+	}
+}
+
+func TestProductInputValidateFiat(t *testing.T) {
+	tests := []struct {
+		name string
+		in   productInput
+		want string
+	}{
+		{"mxn", productInput{Name: "Poncho", PriceCurrency: "mxn", PriceFiat: money.MustParse("450")}, ""},
+		{"explicit usdc", productInput{Name: "Mug", PriceCurrency: "USDC", PriceUSDC: money.MustParse("1")}, ""},
+		{"no fiat price", productInput{Name: "Poncho", PriceCurrency: "MXN"}, "priceFiat must be positive for products priced in MXN"},
+		{"unsupported currency", productInput{Name: "Scarf", PriceCurrency: "GBP", PriceFiat: money.MustParse("10")}, "unsupported priceCurrency GBP"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.validate(); got != tt.want {
+			t.Errorf("%s: validate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	p := productInput{Name: "Mug", PriceUSDC: money.MustParse("1"), PriceFiat: money.MustParse("17")}.product("mug")
+	if !p.PriceFiat.IsZero() {
+		t.Errorf("USDC-priced product keeps fiat price %s", p.PriceFiat)
+	}
+	if price := (&models.Product{PriceCurrency: money.MXN, PriceFiat: money.MustParse("450"), PriceUSDC: money.MustParse("26")}).Price(); price.Currency != money.MXN ||
+		!price.Amount.Equal(money.MustParse("450")) {
+		t.Errorf("Price() = %s, want 450 MXN", price)
+	}
+}
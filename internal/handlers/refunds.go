@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/payments"
+)
+
+type createRefundRequest struct {
+	// AmountUSDC defaults to what is owed back to the customer, or with
+	// Full to everything the order has left to refund.
+	AmountUSDC    *money.Decimal `json:"amountUsdc"`
+	Full          bool           `json:"full"`
+	WalletAddress string         `json:"walletAddress"`
+	// Blockchain defaults to the network customers pay on.
+	Blockchain string `json:"blockchain"`
+	Reason     string `json:"reason"`
+}
+
+// handleGetOrderRefunds returns an order's refunds to its customer or to
+// staff.
+func (a *App) handleGetOrderRefunds(w http.ResponseWriter, r *http.Request) {
+	order, ok := a.loadCustomerOrder(w, r)
+	if !ok {
+		return
+	}
+	refunds, err := a.refunds.ListByOrder(r.Context(), order.ID)
+	if err != nil {
+		log.Printf("list refunds for order %s: %v", order.ID, err)
+		http.Error(w, "failed to list refunds", http.StatusInternalServerError)
+		return
+	}
+	if refunds == nil {
+		refunds = []*models.Refund{}
+	}
+	writeJSON(w, http.StatusOK, refunds)
+}
+
+// handleAdminCreateRefund refunds USDC from an order to a wallet, in full or
+// in part. The refund is paid out in the background; its status shows how
+// far it got. Refunding more than is owed back on a paid order that has not
+// been paid out yet reduces its payout, and refunding everything cancels it.
+func (a *App) handleAdminCreateRefund(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req createRefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	order, err := a.orders.GetByID(r.Context(), orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("load order %s: %v", orderID, err)
+		http.Error(w, "failed to load order", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Full && req.AmountUSDC != nil {
+		http.Error(w, "give either amountUsdc or full, not both", http.StatusBadRequest)
+		return
+	}
+	_, owed := order.Balances()
+	amount := owed.Amount
+	switch {
+	case req.AmountUSDC != nil:
+		amount = *req.AmountUSDC
+	case req.Full:
+		amount = order.Refundable().Amount
+	}
+	if amount.IsZero() && req.AmountUSDC == nil {
+		http.Error(w, "order has nothing to refund (status "+string(order.Status)+")", http.StatusConflict)
+		return
+	}
+	blockchain := strings.TrimSpace(req.Blockchain)
+	if blockchain == "" {
+		blockchain = a.network
+	}
+
+	p := auth.FromContext(r.Context())
+	refund := &models.Refund{
+		OrderID:       order.ID,
+		AmountUSDC:    amount,
+		WalletAddress: strings.TrimSpace(req.WalletAddress),
+		Blockchain:    blockchain,
+		Reason:        strings.TrimSpace(req.Reason),
+		RequestedBy:   p.Username,
+	}
+	err = a.refunder.Request(r.Context(), refund)
+	switch {
+	case errors.Is(err, payments.ErrInvalidRefund):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrRefundExceedsRefundable),
+		errors.Is(err, models.ErrRefundLeavesNoPayout),
+		errors.Is(err, models.ErrPayoutRequested):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("refund order %s: %v", order.ID, err)
+		http.Error(w, "failed to create refund", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, refund)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// reportDefaultRange is the window exported when no "from" is given.
+const reportDefaultRange = 30 * 24 * time.Hour
+
+var orderReportHeader = []string{
+	"order_id", "created_at", "updated_at", "status", "customer_name", "customer_email",
+	"subtotal_usdc", "fees_usdc", "amount_usdc", "price_currency", "subtotal_fiat", "checkout_rate",
+	"received_usdc", "refunded_usdc", "balance_due_usdc", "balance_owed_usdc",
+	"payout_amount", "payout_currency",
+	"payin_id", "payment_deposit_id", "mural_payout_request_id", "mural_payout_status",
+}
+
+// handleAdminExportOrders streams orders created in [from, to) as CSV. from
+// and to are RFC 3339 timestamps or YYYY-MM-DD dates (UTC); they default to
+// the last 30 days.
+func (a *App) handleAdminExportOrders(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	to, err := parseReportTime(r.URL.Query().Get("to"), now)
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := parseReportTime(r.URL.Query().Get("from"), to.Add(-reportDefaultRange))
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := a.orders.ListCreatedBetween(r.Context(), from, to)
+	if err != nil {
+		log.Printf("export orders: %v", err)
+		http.Error(w, "failed to export orders", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user %s exported %d orders from %s to %s",
+		auth.FromContext(r.Context()).Username, len(orders), from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="orders-%s-%s.csv"`,
+		from.Format("20060102"), to.Format("20060102")))
+	cw := csv.NewWriter(w)
+	_ = cw.Write(orderReportHeader)
+	for _, o := range orders {
+		payoutID := ""
+		if o.MuralPayoutRequestID != uuid.Nil {
+			payoutID = o.MuralPayoutRequestID.String()
+		}
+		priceCurrency, subtotalFiat, checkoutRate := string(money.USDC), "", ""
+		if fp := o.FiatPricing; fp != nil {
+			priceCurrency, subtotalFiat, checkoutRate = string(fp.Currency), fp.SubtotalFiat.String(), fp.Rate.String()
+		}
+		_ = cw.Write([]string{
+			o.ID.String(),
+			o.CreatedAt.UTC().Format(time.RFC3339),
+			o.UpdatedAt.UTC().Format(time.RFC3339),
+			string(o.Status),
+			o.CustomerName,
+			o.CustomerEmail,
+			o.SubtotalUSDC.String(),
+			o.FeesUSDC.String(),
+			o.AmountUSDC.String(),
+			priceCurrency,
+			subtotalFiat,
+			checkoutRate,
+			o.ReceivedUSDC.String(),
+			o.RefundedUSDC.String(),
+			o.BalanceDueUSDC.String(),
+			o.BalanceOwedUSDC.String(),
+			o.PayoutAmount.String(),
+			o.PayoutCurrency,
+			o.PayinID,
+			o.PaymentDepositID,
+			payoutID,
+			o.MuralPayoutStatus,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("export orders: write csv: %v", err)
+	}
+}
+
+func parseReportTime(v string, fallback time.Time) (time.Time, error) {
+	if v == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+// orderStreamHeartbeat is how often an idle order stream sends a comment, so
+// proxies and clients do not time it out.
+const orderStreamHeartbeat = 15 * time.Second
+
+// orderStatusEvent is the data of a "status" event on an order stream.
+type orderStatusEvent struct {
+	OrderID        string             `json:"orderId"`
+	Status         models.OrderStatus `json:"status"`
+	PreviousStatus models.OrderStatus `json:"previousStatus,omitempty"`
+	At             time.Time          `json:"at"`
+}
+
+// handleOrderEvents streams an order's status changes as Server-Sent Events.
+// Each change is a "status" event whose id is the order event's ID. A new
+// stream starts with the order's full status history; a client reconnecting
+// with Last-Event-ID (or ?lastEventId=) gets only what happened after that
+// event. The stream ends once the order reaches a terminal status.
+func (a *App) handleOrderEvents(w http.ResponseWriter, r *http.Request) {
+	order, ok := a.loadCustomerOrder(w, r)
+	if !ok {
+		return
+	}
+	lastID, ok := lastEventID(r)
+	if !ok {
+		http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before the first read, so a change made in between still
+	// wakes the stream.
+	changed, unsubscribe := a.broker.Subscribe(order.ID)
+	defer unsubscribe()
+
+	ctx := r.Context()
+	status := order.Status
+	events, err := a.orders.ListEventsAfter(ctx, order.ID, lastID)
+	if err != nil {
+		log.Printf("order %s stream: list events: %v", order.ID.String(), err)
+		http.Error(w, "failed to load order events", http.StatusInternalServerError)
+		return
+	}
+	if status.Terminal() && len(events) == 0 {
+		// Nothing more will happen; 204 tells EventSource not to reconnect.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Streams outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("order %s stream: clear write deadline: %v", order.ID.String(), err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+
+	heartbeat := time.NewTicker(orderStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		for _, ev := range events {
+			if err := writeStatusEvent(w, ev); err != nil {
+				return
+			}
+			lastID, status = ev.ID, ev.ToStatus
+		}
+		if err := rc.Flush(); err != nil || status.Terminal() {
+			return
+		}
+
+		// Heartbeats also re-read the events, in case a notification was
+		// missed.
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.broker.Done():
+			return
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if events, err = a.orders.ListEventsAfter(ctx, order.ID, lastID); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("order %s stream: list events: %v", order.ID.String(), err)
+			}
+			return
+		}
+	}
+}
+
+// lastEventID returns the ID of the last event a reconnecting client saw,
+// from the Last-Event-ID header or the lastEventId query parameter, or 0 for
+// a new stream. It reports false if the ID is not a valid event ID.
+func lastEventID(r *http.Request) (int64, bool) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		if !r.URL.Query().Has("lastEventId") {
+			return 0, true
+		}
+		v = r.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// writeStatusEvent writes ev as a "status" event.
+func writeStatusEvent(w io.Writer, ev *models.OrderEvent) error {
+	data, err := json.Marshal(orderStatusEvent{
+		OrderID:        ev.OrderID.String(),
+		Status:         ev.ToStatus,
+		PreviousStatus: ev.FromStatus,
+		At:             ev.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", ev.ID, data)
+	return err
+}
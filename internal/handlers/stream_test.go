@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+func TestLastEventID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   int64
+		wantOK bool
+	}{
+		{"new stream", "", "", 0, true},
+		{"header", "42", "", 42, true},
+		{"query", "", "?lastEventId=7", 7, true},
+		{"header wins", "42", "?lastEventId=7", 42, true},
+		{"empty query", "", "?lastEventId=", 0, false},
+		{"not a number", "abc", "", 0, false},
+		{"negative", "", "?lastEventId=-1", 0, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/orders/x/events"+tt.query, nil)
+		if tt.header != "" {
+			r.Header.Set("Last-Event-ID", tt.header)
+		}
+		got, ok := lastEventID(r)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: lastEventID = %d, %v; want %d, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestWriteStatusEvent(t *testing.T) {
+	orderID := uuid.MustParse("0b0c8f5e-8a43-4a1e-9d0b-3c8b1f2f6a11")
+	ev := &models.OrderEvent{
+		ID:         12,
+		OrderID:    orderID,
+		FromStatus: models.StatusPendingPayment,
+		ToStatus:   models.StatusPaid,
+		CreatedAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	var b strings.Builder
+	if err := writeStatusEvent(&b, ev); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 12\nevent: status\n" +
+		`data: {"orderId":"` + orderID.String() + `","status":"paid","previousStatus":"pending_payment","at":"2026-01-02T03:04:05Z"}` +
+		"\n\n"
+	if b.String() != want {
+		t.Errorf("wrote %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	ev.FromStatus = ""
+	if err := writeStatusEvent(&b, ev); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "previousStatus") {
+		t.Errorf("first event has a previous status: %q", b.String())
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/auth"
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+type createUserRequest struct {
+	Username string      `json:"username"`
+	Password string      `json:"password"`
+	Role     models.Role `json:"role"`
+}
+
+type setRoleRequest struct {
+	Role models.Role `json:"role"`
+}
+
+func (a *App) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.users.List(r.Context())
+	if err != nil {
+		log.Printf("list users: %v", err)
+		http.Error(w, "failed to list users", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (a *App) handleAdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	u, err := a.auth.CreateUser(r.Context(), req.Username, req.Password, req.Role)
+	switch {
+	case errors.Is(err, auth.ErrInvalidUsername), errors.Is(err, auth.ErrWeakPassword), errors.Is(err, models.ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("create user %q: %v", req.Username, err)
+		http.Error(w, "failed to create user", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user %s created %s user %q", auth.FromContext(r.Context()).Username, u.Role, u.Username)
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func (a *App) handleAdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p := auth.FromContext(r.Context())
+	if id == p.UserID {
+		// Otherwise the last super admin could lock everyone out of user management.
+		http.Error(w, "cannot change your own role", http.StatusConflict)
+		return
+	}
+	u, err := a.users.SetRole(r.Context(), id, req.Role)
+	switch {
+	case errors.Is(err, models.ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrUserNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("set role of user %s: %v", id, err)
+		http.Error(w, "failed to update user", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user %s set role of %q to %s", p.Username, u.Username, u.Role)
+	writeJSON(w, http.StatusOK, u)
+}
+
+// handleAdminRevokeUserSessions signs a user out everywhere.
+func (a *App) handleAdminRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	u, err := a.users.GetByID(r.Context(), id)
+	if errors.Is(err, models.ErrUserNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("load user %s: %v", id, err)
+		http.Error(w, "failed to load user", http.StatusInternalServerError)
+		return
+	}
+	if err := a.auth.RevokeSessions(r.Context(), u.ID); err != nil {
+		log.Printf("revoke sessions of user %s: %v", id, err)
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user %s revoked all sessions of %q", auth.FromContext(r.Context()).Username, u.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
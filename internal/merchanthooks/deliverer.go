@@ -0,0 +1,230 @@
+// Package merchanthooks sends merchant webhook events from the delivery
+// outbox to the endpoints merchants have registered, signed with each
+// endpoint's secret and retried with exponential backoff.
+package merchanthooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+// maxErrorBody is how much of a failed response's body is kept in the
+// delivery log.
+const maxErrorBody = 512
+
+// Config controls polling and retry behaviour of the Deliverer.
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Lease is how long a claimed delivery is reserved for one attempt; it
+	// must exceed Timeout.
+	Lease       time.Duration
+	Timeout     time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 5 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 20
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.Lease <= c.Timeout {
+		c.Lease = c.Timeout + time.Minute
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 12
+	}
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = 30 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 6 * time.Hour
+	}
+}
+
+// Deliverer sends pending webhook deliveries. A delivery succeeds when the
+// endpoint answers 2xx; anything else, including a redirect or timeout, is
+// retried with exponential backoff until MaxAttempts, after which the
+// delivery is failed and only sent again if redelivered by hand. Every
+// attempt is recorded in the delivery log. Deliveries are claimed with a
+// lease, so several replicas may run a Deliverer.
+type Deliverer struct {
+	webhooks   *models.MerchantWebhookStore
+	deliveries *models.WebhookDeliveryStore
+	client     *http.Client
+	cfg        Config
+
+	wake chan struct{}
+}
+
+func NewDeliverer(webhooks *models.MerchantWebhookStore, deliveries *models.WebhookDeliveryStore, cfg Config) *Deliverer {
+	cfg.setDefaults()
+	return &Deliverer{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Lease is how long a delivery must be leased for Deliver.
+func (d *Deliverer) Lease() time.Duration {
+	return d.cfg.Lease
+}
+
+// Notify asks the deliverer to poll for due deliveries immediately.
+func (d *Deliverer) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls for due deliveries until ctx is cancelled. In-flight attempts are
+// allowed to finish before Run returns.
+func (d *Deliverer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		due, err := d.deliveries.ClaimDue(ctx, d.cfg.BatchSize, d.cfg.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("merchant webhooks: claim due deliveries: %v", err)
+		}
+		for _, delivery := range due {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				if _, err := d.Deliver(ctx, delivery); err != nil && ctx.Err() == nil {
+					log.Printf("merchant webhook delivery %s: %v", delivery.ID, err)
+				}
+			}(delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Deliver makes one attempt to send a delivery the caller has leased, and
+// records its outcome. It returns the attempt as logged; an error means the
+// outcome could not be recorded.
+func (d *Deliverer) Deliver(ctx context.Context, delivery *models.WebhookDelivery) (*models.WebhookDeliveryAttempt, error) {
+	// Recording the outcome must survive shutdown of the polling context.
+	storeCtx := context.WithoutCancel(ctx)
+
+	wh, err := d.webhooks.GetByID(ctx, delivery.WebhookID)
+	if err != nil {
+		return nil, fmt.Errorf("load webhook %s: %w", delivery.WebhookID, err)
+	}
+
+	attempt := &models.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+	}
+	start := time.Now()
+	code, err := d.send(ctx, wh, delivery)
+	if ctx.Err() != nil {
+		// Shutting down: the attempt is not counted, and the delivery is
+		// retried once its lease expires.
+		return nil, ctx.Err()
+	}
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if code != 0 {
+		attempt.StatusCode = &code
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	status, next := models.DeliverySucceeded, time.Now()
+	switch {
+	case err == nil:
+		log.Printf("merchant webhook delivery %s (%s) sent to %s", delivery.ID, delivery.EventType, wh.URL)
+	case attempt.Attempt >= d.cfg.MaxAttempts:
+		status = models.DeliveryFailed
+		log.Printf("merchant webhook delivery %s (%s) to %s failed after %d attempts: %v",
+			delivery.ID, delivery.EventType, wh.URL, attempt.Attempt, err)
+	default:
+		status = models.DeliveryPending
+		delay := d.backoff(attempt.Attempt)
+		next = next.Add(delay)
+		log.Printf("merchant webhook delivery %s (%s) to %s attempt %d failed, retrying in %s: %v",
+			delivery.ID, delivery.EventType, wh.URL, attempt.Attempt, delay, err)
+	}
+	if err := d.deliveries.RecordAttempt(storeCtx, attempt, status, next); err != nil {
+		return nil, fmt.Errorf("record attempt: %w", err)
+	}
+	return attempt, nil
+}
+
+// send POSTs the delivery's payload, signed with the webhook's current
+// secret, and returns the response status code (0 if none was received).
+func (d *Deliverer) send(ctx context.Context, wh *models.MerchantWebhook, delivery *models.WebhookDelivery) (int, error) {
+	now := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mural-checkout-webhooks/1.0")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(wh.Secret, now, delivery.Payload))
+	req.Header.Set(EventIDHeader, delivery.EventID.String())
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(DeliveryIDHeader, delivery.ID.String())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := "endpoint returned " + resp.Status
+		if b := strings.TrimSpace(string(body)); b != "" {
+			msg += ": " + b
+		}
+		return resp.StatusCode, errors.New(msg)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Deliverer) backoff(attempt int) time.Duration {
+	b := d.cfg.BaseBackoff << (attempt - 1)
+	if b <= 0 || b > d.cfg.MaxBackoff {
+		b = d.cfg.MaxBackoff
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package merchanthooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	// SignatureHeader is the hex HMAC-SHA256, keyed with the webhook's
+	// secret, of the timestamp header, a ".", and the body.
+	SignatureHeader = "x-checkout-webhook-signature"
+	// TimestampHeader is when the attempt was signed, in Unix seconds.
+	TimestampHeader = "x-checkout-webhook-timestamp"
+	// EventIDHeader is the event's ID, the same in every delivery of it.
+	EventIDHeader   = "x-checkout-webhook-event-id"
+	EventTypeHeader = "x-checkout-webhook-event"
+	// DeliveryIDHeader identifies the delivery in the admin delivery log.
+	DeliveryIDHeader = "x-checkout-webhook-delivery"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing webhook signature headers")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp outside the accepted window")
+)
+
+// Sign returns the signature of body sent at t with secret.
+func Sign(secret string, t time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(t.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature as a receiver would: the signature
+// must match the body and timestamp, and the timestamp be within maxAge of
+// now.
+func Verify(secret string, h http.Header, body []byte, maxAge time.Duration, now time.Time) error {
+	sig, ts := h.Get(SignatureHeader), h.Get(TimestampHeader)
+	if sig == "" || ts == "" {
+		return ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	t := time.Unix(unix, 0)
+	if d := now.Sub(t); d > maxAge || d < -maxAge {
+		return ErrStaleTimestamp
+	}
+	if !hmac.Equal([]byte(sig), []byte(Sign(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
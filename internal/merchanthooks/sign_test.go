@@ -0,0 +1,140 @@
+package merchanthooks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedHeader(secret string, t time.Time, body []byte) http.Header {
+	h := http.Header{}
+	h.Set(TimestampHeader, strconv.FormatInt(t.Unix(), 10))
+	h.Set(SignatureHeader, Sign(secret, t, body))
+	return h
+}
+
+func TestVerify(t *testing.T) {
+	const (
+		secret = "whsec_current"
+		maxAge = 5 * time.Minute
+	)
+	sentAt := time.Unix(1_760_000_000, 0)
+	body := []byte(`{"id":"evt_1","type":"order.paid"}`)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		secret string
+		now    time.Time
+		want   error
+	}{
+		{
+			name:   "round trip",
+			header: signedHeader(secret, sentAt, body),
+			body:   body,
+			secret: secret,
+			now:    sentAt.Add(time.Minute),
+		},
+		{
+			name:   "tampered body",
+			header: signedHeader(secret, sentAt, body),
+			body:   []byte(`{"id":"evt_1","type":"order.refunded"}`),
+			secret: secret,
+			now:    sentAt,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name: "tampered timestamp",
+			header: func() http.Header {
+				h := signedHeader(secret, sentAt, body)
+				h.Set(TimestampHeader, strconv.FormatInt(sentAt.Unix()+1, 10))
+				return h
+			}(),
+			body:   body,
+			secret: secret,
+			now:    sentAt,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "stale timestamp",
+			header: signedHeader(secret, sentAt, body),
+			body:   body,
+			secret: secret,
+			now:    sentAt.Add(maxAge + time.Second),
+			want:   ErrStaleTimestamp,
+		},
+		{
+			name:   "timestamp in the future",
+			header: signedHeader(secret, sentAt, body),
+			body:   body,
+			secret: secret,
+			now:    sentAt.Add(-maxAge - time.Second),
+			want:   ErrStaleTimestamp,
+		},
+		{
+			name:   "signed before the secret was rotated",
+			header: signedHeader("whsec_previous", sentAt, body),
+			body:   body,
+			secret: secret,
+			now:    sentAt,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "signed after the secret was rotated",
+			header: signedHeader(secret, sentAt, body),
+			body:   body,
+			secret: "whsec_previous",
+			now:    sentAt,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "missing headers",
+			header: http.Header{},
+			body:   body,
+			secret: secret,
+			now:    sentAt,
+			want:   ErrMissingSignature,
+		},
+		{
+			name: "malformed timestamp",
+			header: func() http.Header {
+				h := signedHeader(secret, sentAt, body)
+				h.Set(TimestampHeader, "yesterday")
+				return h
+			}(),
+			body:   body,
+			secret: secret,
+			now:    sentAt,
+			want:   ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, maxAge, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignDependsOnEveryInput(t *testing.T) {
+	at := time.Unix(1_760_000_000, 0)
+	body := []byte(`{}`)
+	base := Sign("secret", at, body)
+	if got := Sign("secret", at, body); got != base {
+		t.Fatalf("Sign is not deterministic: %s != %s", got, base)
+	}
+	for name, sig := range map[string]string{
+		"secret": Sign("other", at, body),
+		"time":   Sign("secret", at.Add(time.Second), body),
+		"body":   Sign("secret", at, []byte(`{ }`)),
+	} {
+		if sig == base {
+			t.Errorf("changing the %s does not change the signature", name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// DepositKind is the Mural record a deposit was read from. Mural reports the
+// same transfer both as a Payin and as an account transaction, so only one
+// kind is counted towards orders (see payments.Ledger).
+type DepositKind string
+
+const (
+	DepositKindPayin       DepositKind = "payin"
+	DepositKindTransaction DepositKind = "transaction"
+)
+
+// DepositStatus is the normalized state of an incoming deposit.
+type DepositStatus string
+
+const (
+	DepositPending   DepositStatus = "pending"
+	DepositCompleted DepositStatus = "completed"
+	DepositFailed    DepositStatus = "failed"
+)
+
+// How a deposit was attributed to its order, recorded in matched_by.
+const (
+	MatchRemaining = "remaining" // exactly the amount still due
+	MatchTolerance = "tolerance" // within the payment tolerance of the amount still due
+	MatchReference = "reference" // carries the order's payment reference in its sub-cent digits
+	MatchLate      = "late"      // exactly the amount of a recently expired order
+	MatchAdmin     = "admin"     // assigned by an admin
+)
+
+var (
+	ErrDepositNotFound = errors.New("deposit not found")
+	// ErrDepositAssigned is returned by Assign when the deposit is already
+	// attributed to an order.
+	ErrDepositAssigned = errors.New("deposit already assigned to an order")
+)
+
+// Deposit is a transfer into the Mural account. Only completed deposits count
+// towards the order they are attributed to; a deposit no order could be
+// matched to has no OrderID until an admin assigns it.
+type Deposit struct {
+	ID          string        `json:"id"`
+	Kind        DepositKind   `json:"kind"`
+	OrderID     uuid.UUID     `json:"orderId,omitempty"`
+	AmountUSDC  money.Decimal `json:"amountUsdc"`
+	Status      DepositStatus `json:"status"`
+	PayinStatus string        `json:"payinStatus,omitempty"`
+	MatchedBy   string        `json:"matchedBy,omitempty"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	UpdatedAt   time.Time     `json:"updatedAt"`
+}
+
+// Amount returns the deposited amount in USDC.
+func (d *Deposit) Amount() money.Money {
+	return money.NewMoney(d.AmountUSDC, money.USDC)
+}
+
+type DepositStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewDepositStore(pool *pgxpool.Pool) *DepositStore {
+	return &DepositStore{pool: pool}
+}
+
+const depositColumns = `id, kind, order_id, amount_usdc, status, payin_status, matched_by, created_at, updated_at`
+
+// Record stores a deposit seen in a webhook or while polling Mural, or the
+// new status of one seen before. A deposit only moves on from pending, so a
+// stale report cannot undo a completion. changed reports whether anything was
+// written; d is filled in from the stored row, including its order.
+func (s *DepositStore) Record(ctx context.Context, d *Deposit) (changed bool, err error) {
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO deposits (id, kind, amount_usdc, status, payin_status)
+		VALUES ($1,$2,$3,$4,NULLIF($5, ''))
+		ON CONFLICT (id) DO UPDATE
+		SET status=EXCLUDED.status, payin_status=EXCLUDED.payin_status, updated_at=NOW()
+		WHERE deposits.status = 'pending'
+		  AND (EXCLUDED.status <> 'pending' OR EXCLUDED.payin_status IS DISTINCT FROM deposits.payin_status)
+		RETURNING `+depositColumns+`
+	`, d.ID, string(d.Kind), d.AmountUSDC.Round(money.USDC.Scale()), string(d.Status), d.PayinStatus)
+	stored, err := scanDeposit(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Already recorded with this status.
+		stored, err = s.Get(ctx, d.ID)
+		if err != nil {
+			return false, err
+		}
+		*d = *stored
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	*d = *stored
+	return true, nil
+}
+
+func (s *DepositStore) Get(ctx context.Context, id string) (*Deposit, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+depositColumns+` FROM deposits WHERE id=$1`, id)
+	d, err := scanDeposit(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDepositNotFound
+	}
+	return d, err
+}
+
+// Assign attributes an unassigned deposit to an order. It fails with
+// ErrDepositAssigned if the deposit already belongs to an order, so a deposit
+// can never count towards two orders.
+func (s *DepositStore) Assign(ctx context.Context, id string, orderID uuid.UUID, matchedBy string) (*Deposit, error) {
+	row := s.pool.QueryRow(ctx, `
+		UPDATE deposits SET order_id=$2, matched_by=$3, updated_at=NOW()
+		WHERE id=$1 AND order_id IS NULL
+		RETURNING `+depositColumns+`
+	`, id, orderID, matchedBy)
+	d, err := scanDeposit(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrDepositAssigned
+	}
+	return d, err
+}
+
+// ListByOrder returns the deposits attributed to an order, oldest first.
+func (s *DepositStore) ListByOrder(ctx context.Context, orderID uuid.UUID) ([]*Deposit, error) {
+	return s.list(ctx, `
+		SELECT `+depositColumns+`
+		FROM deposits WHERE order_id=$1 ORDER BY created_at
+	`, orderID)
+}
+
+// ListUnmatched returns the deposits that could not be attributed to an order
+// and have not failed, newest first.
+func (s *DepositStore) ListUnmatched(ctx context.Context) ([]*Deposit, error) {
+	return s.list(ctx, `
+		SELECT `+depositColumns+`
+		FROM deposits WHERE order_id IS NULL AND status <> 'failed' ORDER BY created_at DESC
+	`)
+}
+
+func (s *DepositStore) list(ctx context.Context, query string, args ...any) ([]*Deposit, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Deposit
+	for rows.Next() {
+		d, err := scanDeposit(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func scanDeposit(row pgx.Row) (*Deposit, error) {
+	var (
+		d           Deposit
+		kind        string
+		orderID     *uuid.UUID
+		status      string
+		payinStatus *string
+		matchedBy   *string
+	)
+	if err := row.Scan(&d.ID, &kind, &orderID, &d.AmountUSDC, &status, &payinStatus, &matchedBy,
+		&d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	d.Kind = DepositKind(kind)
+	d.Status = DepositStatus(status)
+	if orderID != nil {
+		d.OrderID = *orderID
+	}
+	if payinStatus != nil {
+		d.PayinStatus = *payinStatus
+	}
+	if matchedBy != nil {
+		d.MatchedBy = *matchedBy
+	}
+	return &d, nil
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+type DestinationStatus string
+
+const (
+	// DestinationPending destinations exist in Mural but have not been
+	// verified yet and cannot receive payouts.
+	DestinationPending  DestinationStatus = "pending_verification"
+	DestinationActive   DestinationStatus = "active"
+	DestinationDisabled DestinationStatus = "disabled"
+)
+
+// PayoutDestination is a merchant bank account payouts are sent to. The bank
+// details live in Mural as a Counterparty payout method; we only keep the IDs
+// and enough to recognise the account in the admin UI. Rail is the Mural
+// fiat-and-rail code (e.g. "cop", "mxn") and Currency the fiat currency the
+// merchant receives.
+type PayoutDestination struct {
+	ID             uuid.UUID         `json:"id"`
+	Name           string            `json:"name"`
+	CounterpartyID string            `json:"counterpartyId"`
+	PayoutMethodID string            `json:"payoutMethodId"`
+	BankName       string            `json:"bankName"`
+	AccountOwner   string            `json:"accountOwner"`
+	Rail           string            `json:"rail"`
+	Currency       money.Currency    `json:"currency"`
+	Status         DestinationStatus `json:"status"`
+	IsDefault      bool              `json:"isDefault"`
+	VerifiedAt     *time.Time        `json:"verifiedAt,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+}
+
+var (
+	ErrDestinationNotFound = errors.New("payout destination not found")
+	ErrDestinationExists   = errors.New("payout destination already exists")
+	// ErrDestinationInactive is returned when a destination that is not active
+	// is made the default or used for a payout.
+	ErrDestinationInactive = errors.New("payout destination is not active")
+	// ErrNoDefaultDestination is returned by Default when no active destination
+	// is marked as the default.
+	ErrNoDefaultDestination = errors.New("no default payout destination configured")
+)
+
+const destinationUniqueConstraint = "payout_destinations_counterparty_id_payout_method_id_key"
+
+type DestinationStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewDestinationStore(pool *pgxpool.Pool) *DestinationStore {
+	return &DestinationStore{pool: pool}
+}
+
+const destinationColumns = `id, name, counterparty_id, payout_method_id, bank_name, account_owner, rail, currency, status,
+		       is_default, verified_at, created_at, updated_at`
+
+// Create inserts a destination awaiting verification.
+func (s *DestinationStore) Create(ctx context.Context, d *PayoutDestination) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	d.Status = DestinationPending
+	d.IsDefault = false
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO payout_destinations (id, name, counterparty_id, payout_method_id, bank_name, account_owner,
+		                                 rail, currency, status)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		RETURNING created_at, updated_at
+	`, d.ID, d.Name, d.CounterpartyID, d.PayoutMethodID, d.BankName, d.AccountOwner,
+		d.Rail, string(d.Currency), string(d.Status)).
+		Scan(&d.CreatedAt, &d.UpdatedAt)
+	if isUniqueViolation(err, destinationUniqueConstraint) {
+		return ErrDestinationExists
+	}
+	return err
+}
+
+func (s *DestinationStore) GetByID(ctx context.Context, id uuid.UUID) (*PayoutDestination, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+destinationColumns+` FROM payout_destinations WHERE id=$1`, id)
+	d, err := scanDestination(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDestinationNotFound
+	}
+	return d, err
+}
+
+// List returns every destination, newest first.
+func (s *DestinationStore) List(ctx context.Context) ([]*PayoutDestination, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+destinationColumns+` FROM payout_destinations ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*PayoutDestination
+	for rows.Next() {
+		d, err := scanDestination(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Default returns the active destination new payouts are sent to.
+func (s *DestinationStore) Default(ctx context.Context) (*PayoutDestination, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+destinationColumns+`
+		FROM payout_destinations
+		WHERE is_default AND status = 'active'
+	`)
+	d, err := scanDestination(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoDefaultDestination
+	}
+	return d, err
+}
+
+// MarkVerified activates a destination once its Mural counterparty and payout
+// method have been confirmed. Disabled destinations stay disabled.
+func (s *DestinationStore) MarkVerified(ctx context.Context, id uuid.UUID) (*PayoutDestination, error) {
+	row := s.pool.QueryRow(ctx, `
+		UPDATE payout_destinations
+		SET status = CASE WHEN status = 'disabled' THEN status ELSE 'active' END,
+		    verified_at=NOW(),
+		    updated_at=NOW()
+		WHERE id=$1
+		RETURNING `+destinationColumns, id)
+	d, err := scanDestination(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDestinationNotFound
+	}
+	return d, err
+}
+
+// Disable stops a destination from receiving new payouts. A disabled default
+// destination stops being the default.
+func (s *DestinationStore) Disable(ctx context.Context, id uuid.UUID) (*PayoutDestination, error) {
+	row := s.pool.QueryRow(ctx, `
+		UPDATE payout_destinations
+		SET status='disabled',
+		    is_default=FALSE,
+		    updated_at=NOW()
+		WHERE id=$1
+		RETURNING `+destinationColumns, id)
+	d, err := scanDestination(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDestinationNotFound
+	}
+	return d, err
+}
+
+// SetDefault makes an active destination the default, replacing any other.
+func (s *DestinationStore) SetDefault(ctx context.Context, id uuid.UUID) (*PayoutDestination, error) {
+	var d *PayoutDestination
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		var status string
+		if err := tx.QueryRow(ctx, `SELECT status FROM payout_destinations WHERE id=$1 FOR UPDATE`, id).Scan(&status); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrDestinationNotFound
+			}
+			return err
+		}
+		if DestinationStatus(status) != DestinationActive {
+			return ErrDestinationInactive
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE payout_destinations SET is_default=FALSE, updated_at=NOW() WHERE is_default AND id<>$1
+		`, id); err != nil {
+			return err
+		}
+		row := tx.QueryRow(ctx, `
+			UPDATE payout_destinations SET is_default=TRUE, updated_at=NOW() WHERE id=$1
+			RETURNING `+destinationColumns, id)
+		var err error
+		d, err = scanDestination(row)
+		return err
+	})
+	return d, err
+}
+
+func scanDestination(row pgx.Row) (*PayoutDestination, error) {
+	var (
+		d        PayoutDestination
+		currency string
+		status   string
+	)
+	if err := row.Scan(
+		&d.ID,
+		&d.Name,
+		&d.CounterpartyID,
+		&d.PayoutMethodID,
+		&d.BankName,
+		&d.AccountOwner,
+		&d.Rail,
+		&currency,
+		&status,
+		&d.IsDefault,
+		&d.VerifiedAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Currency = money.Currency(currency)
+	d.Status = DestinationStatus(status)
+	return &d, nil
+}
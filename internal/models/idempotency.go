@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdempotencyKey is a client-chosen Idempotency-Key and what the request made
+// with it returned. Keys are scoped to the user that sent them. A key whose
+// request is still being handled has no response yet (Completed is false).
+type IdempotencyKey struct {
+	UserID       uuid.UUID
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// Completed reports whether the key's request has finished and its response
+// been stored.
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
+
+// ErrIdempotencyKeyNotFound is returned when a key is not (or no longer)
+// stored.
+var ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+type IdempotencyStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyStore(pool *pgxpool.Pool) *IdempotencyStore {
+	return &IdempotencyStore{pool: pool}
+}
+
+const idempotencyColumns = `user_id, key, request_hash, status_code, content_type, response_body, created_at, expires_at`
+
+// Begin claims a key for a new request with the given hash, kept until ttl
+// has passed. If the key is already held it returns the stored key and false:
+// the caller replays its response, or rejects the request if the hash
+// differs. An expired key, or one whose request was abandoned more than
+// staleAfter ago without a response, is claimed afresh.
+func (s *IdempotencyStore) Begin(ctx context.Context, userID uuid.UUID, key, requestHash string, ttl, staleAfter time.Duration) (*IdempotencyKey, bool, error) {
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at)
+		VALUES ($1,$2,$3,NOW() + make_interval(secs => $4))
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET request_hash=EXCLUDED.request_hash,
+		    status_code=NULL,
+		    content_type=NULL,
+		    response_body=NULL,
+		    created_at=NOW(),
+		    expires_at=EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		   OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at <= NOW() - make_interval(secs => $5))
+		RETURNING `+idempotencyColumns+`
+	`, userID, key, requestHash, ttl.Seconds(), staleAfter.Seconds())
+	k, err := scanIdempotencyKey(row)
+	if err == nil {
+		return k, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// The key is held by another request; return it as stored.
+	k, err = scanIdempotencyKey(s.pool.QueryRow(ctx, `
+		SELECT `+idempotencyColumns+`
+		FROM idempotency_keys WHERE user_id=$1 AND key=$2
+	`, userID, key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, ErrIdempotencyKeyNotFound
+	}
+	return k, false, err
+}
+
+// Complete stores the response to a key's request.
+func (s *IdempotencyStore) Complete(ctx context.Context, userID uuid.UUID, key string, statusCode int, contentType string, body []byte) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code=$3, content_type=$4, response_body=$5
+		WHERE user_id=$1 AND key=$2
+	`, userID, key, statusCode, contentType, body)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+	return nil
+}
+
+// Release forgets a key whose request failed, so a retry with it is handled
+// afresh.
+func (s *IdempotencyStore) Release(ctx context.Context, userID uuid.UUID, key string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id=$1 AND key=$2 AND status_code IS NULL
+	`, userID, key)
+	return err
+}
+
+// DeleteExpired removes keys whose TTL has passed and returns how many were
+// removed.
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanIdempotencyKey(row pgx.Row) (*IdempotencyKey, error) {
+	var (
+		k           IdempotencyKey
+		statusCode  *int
+		contentType *string
+	)
+	if err := row.Scan(
+		&k.UserID,
+		&k.Key,
+		&k.RequestHash,
+		&statusCode,
+		&contentType,
+		&k.ResponseBody,
+		&k.CreatedAt,
+		&k.ExpiresAt,
+	); err != nil {
+		return nil, err
+	}
+	if statusCode != nil {
+		k.StatusCode = *statusCode
+	}
+	if contentType != nil {
+		k.ContentType = *contentType
+	}
+	return &k, nil
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Merchant webhook event types.
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderUnderpaid = "order.underpaid"
+	EventOrderPaid      = "order.paid"
+	EventOrderExpired   = "order.expired"
+	EventOrderCancelled = "order.cancelled"
+	EventOrderRefunded  = "order.refunded"
+	EventPayoutExecuted = "payout.executed"
+	EventPayoutFailed   = "payout.failed"
+)
+
+// WebhookEventTypes lists every event type a merchant webhook can receive.
+var WebhookEventTypes = []string{
+	EventOrderCreated,
+	EventOrderUnderpaid,
+	EventOrderPaid,
+	EventOrderExpired,
+	EventOrderCancelled,
+	EventOrderRefunded,
+	EventPayoutExecuted,
+	EventPayoutFailed,
+}
+
+// webhookEventFor returns the event type announcing an order's move to
+// status to, if the move is one merchants are told about.
+func webhookEventFor(from, to OrderStatus) (string, bool) {
+	switch to {
+	case StatusPendingPayment:
+		return EventOrderCreated, from == ""
+	case StatusUnderpaid:
+		return EventOrderUnderpaid, true
+	case StatusPaid, StatusOverpaid:
+		return EventOrderPaid, true
+	case StatusExpired:
+		return EventOrderExpired, true
+	case StatusCancelled:
+		return EventOrderCancelled, true
+	case StatusRefunded:
+		return EventOrderRefunded, true
+	case StatusWithdrawn:
+		return EventPayoutExecuted, true
+	case StatusPayoutError:
+		return EventPayoutFailed, true
+	}
+	return "", false
+}
+
+// MerchantWebhook is an HTTPS endpoint of the merchant's that receives signed
+// order lifecycle events. Events lists the event types it is sent; empty
+// means all of them. The secret signing its deliveries is only shown when
+// the webhook is created or its secret rotated.
+type MerchantWebhook struct {
+	ID          uuid.UUID `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Secret      string    `json:"-"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+var ErrMerchantWebhookNotFound = errors.New("merchant webhook not found")
+
+type MerchantWebhookStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewMerchantWebhookStore(pool *pgxpool.Pool) *MerchantWebhookStore {
+	return &MerchantWebhookStore{pool: pool}
+}
+
+const merchantWebhookColumns = `id, url, description, events, secret, active, created_at, updated_at`
+
+// Create inserts an active webhook with a newly generated signing secret.
+func (s *MerchantWebhookStore) Create(ctx context.Context, wh *MerchantWebhook) error {
+	if wh.ID == uuid.Nil {
+		wh.ID = uuid.New()
+	}
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+	wh.Secret = secret
+	wh.Active = true
+	return s.pool.QueryRow(ctx, `
+		INSERT INTO merchant_webhooks (id, url, description, events, secret, active)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		RETURNING created_at, updated_at
+	`, wh.ID, wh.URL, wh.Description, wh.Events, wh.Secret, wh.Active).
+		Scan(&wh.CreatedAt, &wh.UpdatedAt)
+}
+
+func (s *MerchantWebhookStore) GetByID(ctx context.Context, id uuid.UUID) (*MerchantWebhook, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+merchantWebhookColumns+` FROM merchant_webhooks WHERE id=$1`, id)
+	wh, err := scanMerchantWebhook(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMerchantWebhookNotFound
+	}
+	return wh, err
+}
+
+// List returns every webhook, newest first.
+func (s *MerchantWebhookStore) List(ctx context.Context) ([]*MerchantWebhook, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+merchantWebhookColumns+` FROM merchant_webhooks ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*MerchantWebhook
+	for rows.Next() {
+		wh, err := scanMerchantWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, wh)
+	}
+	return out, rows.Err()
+}
+
+// Update changes a webhook's URL, description, event types and whether it is
+// active. Deliveries to an inactive webhook are held until it is activated
+// again.
+func (s *MerchantWebhookStore) Update(ctx context.Context, wh *MerchantWebhook) error {
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	row := s.pool.QueryRow(ctx, `
+		UPDATE merchant_webhooks
+		SET url=$2, description=$3, events=$4, active=$5, updated_at=NOW()
+		WHERE id=$1
+		RETURNING `+merchantWebhookColumns,
+		wh.ID, wh.URL, wh.Description, wh.Events, wh.Active)
+	updated, err := scanMerchantWebhook(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMerchantWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*wh = *updated
+	return nil
+}
+
+// RotateSecret gives a webhook a new signing secret, used from its next
+// delivery attempt on, and returns the webhook with it.
+func (s *MerchantWebhookStore) RotateSecret(ctx context.Context, id uuid.UUID) (*MerchantWebhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	row := s.pool.QueryRow(ctx, `
+		UPDATE merchant_webhooks SET secret=$2, updated_at=NOW() WHERE id=$1
+		RETURNING `+merchantWebhookColumns, id, secret)
+	wh, err := scanMerchantWebhook(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMerchantWebhookNotFound
+	}
+	return wh, err
+}
+
+// Delete removes a webhook together with its delivery log.
+func (s *MerchantWebhookStore) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM merchant_webhooks WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMerchantWebhookNotFound
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func scanMerchantWebhook(row pgx.Row) (*MerchantWebhook, error) {
+	var wh MerchantWebhook
+	if err := row.Scan(
+		&wh.ID,
+		&wh.URL,
+		&wh.Description,
+		&wh.Events,
+		&wh.Secret,
+		&wh.Active,
+		&wh.CreatedAt,
+		&wh.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	return &wh, nil
+}
+
+// WebhookEventPayload is the JSON body of a merchant webhook delivery.
+type WebhookEventPayload struct {
+	ID        uuid.UUID        `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookEventData is the order an event is about, as it was when the event
+// happened.
+type WebhookEventData struct {
+	Order          *Order      `json:"order"`
+	PreviousStatus OrderStatus `json:"previousStatus,omitempty"`
+}
+
+// enqueueWebhookEvent writes the merchant webhook event for an order's move
+// from status from to status to, if there is one, to the delivery outbox of
+// every active webhook subscribed to it. It runs in the transaction that
+// records the move, so the event is sent if and only if the move commits.
+func enqueueWebhookEvent(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, from, to OrderStatus) error {
+	eventType, ok := webhookEventFor(from, to)
+	if !ok {
+		return nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT id FROM merchant_webhooks
+		WHERE active AND (cardinality(events) = 0 OR $1 = ANY(events))
+	`, eventType)
+	if err != nil {
+		return err
+	}
+	webhookIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil || len(webhookIDs) == 0 {
+		return err
+	}
+
+	order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM orders WHERE id=$1`, orderID))
+	if err != nil {
+		return err
+	}
+	eventID := uuid.New()
+	payload, err := json.Marshal(WebhookEventPayload{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      WebhookEventData{Order: order, PreviousStatus: from},
+	})
+	if err != nil {
+		return err
+	}
+	for _, webhookID := range webhookIDs {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, order_id, payload)
+			VALUES ($1,$2,$3,$4,$5,$6)
+		`, uuid.New(), webhookID, eventID, eventType, orderID, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,52 +3,243 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
 )
 
 type OrderStatus string
 
 const (
 	StatusPendingPayment OrderStatus = "pending_payment"
+	StatusPaymentFailed  OrderStatus = "payment_failed"
+	StatusUnderpaid      OrderStatus = "underpaid"
 	StatusPaid           OrderStatus = "paid"
+	StatusOverpaid       OrderStatus = "overpaid"
+	StatusPayoutCreated  OrderStatus = "payout_created"
+	StatusPayoutPending  OrderStatus = "payout_pending"
 	StatusWithdrawn      OrderStatus = "withdrawn"
 	StatusPayoutError    OrderStatus = "payout_error"
+	StatusExpired        OrderStatus = "expired"
+	StatusLatePayment    OrderStatus = "late_payment"
+	StatusRefunded       OrderStatus = "refunded"
+	StatusCancelled      OrderStatus = "cancelled"
 )
 
+// OrderItem is a line of an order. Items of a fiat-priced order also keep
+// the catalog price in Currency; their PriceUSDC is that price at the
+// order's checkout rate.
 type OrderItem struct {
-	ProductID string  `json:"productId"`
-	Name      string  `json:"name"`
-	PriceUSDC float64 `json:"priceUsdc"`
-	Quantity  int     `json:"quantity"`
+	ProductID string         `json:"productId"`
+	Name      string         `json:"name"`
+	PriceUSDC money.Decimal  `json:"priceUsdc"`
+	PriceFiat *money.Decimal `json:"priceFiat,omitempty"`
+	Currency  money.Currency `json:"currency,omitempty"`
+	Quantity  int            `json:"quantity"`
+}
+
+// LineTotal returns the item's price times quantity in USDC.
+func (it OrderItem) LineTotal() money.Money {
+	return money.NewMoney(it.PriceUSDC, money.USDC).MulInt(int64(it.Quantity))
+}
+
+// FeeKind is what a line of an order's fee breakdown pays for.
+type FeeKind string
+
+const (
+	// FeeMarkup is the merchant's markup on the cart subtotal.
+	FeeMarkup FeeKind = "markup"
+	// FeeConversion passes Mural's fees for converting the payout to fiat on
+	// to the customer.
+	FeeConversion FeeKind = "conversion"
+	// FeePlatform is kept by the platform and not paid out to the merchant.
+	FeePlatform FeeKind = "platform"
+)
+
+// FeeLine is one fee charged on top of an order's subtotal.
+type FeeLine struct {
+	Kind        FeeKind       `json:"kind"`
+	Description string        `json:"description"`
+	AmountUSDC  money.Decimal `json:"amountUsdc"`
 }
 
 type Order struct {
-	ID                   uuid.UUID   `json:"id"`
-	CustomerName         string      `json:"customerName"`
-	CustomerEmail        string      `json:"customerEmail,omitempty"`
-	Items                []OrderItem `json:"items"`
-	AmountUSDC           float64     `json:"amountUsdc"`
-	AmountCOP            float64     `json:"amountCop"`
-	Status               OrderStatus `json:"status"`
-	MuralPayoutRequestID uuid.UUID   `json:"muralPayoutRequestId,omitempty"`
-	MuralPayoutStatus    string      `json:"muralPayoutStatus,omitempty"`
-	CreatedAt            time.Time   `json:"createdAt"`
-	UpdatedAt            time.Time   `json:"updatedAt"`
+	ID                   uuid.UUID     `json:"id"`
+	CustomerID           uuid.UUID     `json:"customerId,omitempty"`
+	CustomerName         string        `json:"customerName"`
+	CustomerEmail        string        `json:"customerEmail,omitempty"`
+	Items                []OrderItem   `json:"items"`
+	SubtotalUSDC         money.Decimal `json:"subtotalUsdc"`
+	FeesUSDC             money.Decimal `json:"feesUsdc"`
+	FeeBreakdown         []FeeLine     `json:"feeBreakdown"`
+	AmountUSDC           money.Decimal `json:"amountUsdc"`
+	AmountCOP            money.Decimal `json:"amountCop"`
+	PayoutAmount         money.Decimal `json:"payoutAmount"`
+	PayoutCurrency       string        `json:"payoutCurrency,omitempty"`
+	PaymentReference     string        `json:"paymentReference"`
+	PaymentDepositID     string        `json:"paymentDepositId,omitempty"`
+	PayinID              string        `json:"payinId,omitempty"`
+	PayinStatus          string        `json:"payinStatus,omitempty"`
+	Status               OrderStatus   `json:"status"`
+	PayoutDestinationID  uuid.UUID     `json:"payoutDestinationId,omitempty"`
+	MuralPayoutRequestID uuid.UUID     `json:"muralPayoutRequestId,omitempty"`
+	MuralPayoutStatus    string        `json:"muralPayoutStatus,omitempty"`
+	PayoutAttempt        int           `json:"payoutAttempt"`
+	ExpiresAt            *time.Time    `json:"expiresAt,omitempty"`
+	Quote                *FXQuote      `json:"quote,omitempty"`
+	FiatPricing          *FiatPricing  `json:"fiatPricing,omitempty"`
+	CreatedAt            time.Time     `json:"createdAt"`
+	UpdatedAt            time.Time     `json:"updatedAt"`
+
+	// ReceivedUSDC is the sum of the completed deposits attributed to the
+	// order and RefundedUSDC the sum of its refunds that have not failed.
+	// BalanceDueUSDC is what the customer still has to send and
+	// BalanceOwedUSDC what is owed back to them (see Balances).
+	ReceivedUSDC    money.Decimal `json:"receivedUsdc"`
+	RefundedUSDC    money.Decimal `json:"refundedUsdc"`
+	BalanceDueUSDC  money.Decimal `json:"balanceDueUsdc"`
+	BalanceOwedUSDC money.Decimal `json:"balanceOwedUsdc"`
+}
+
+// TotalUSDC returns the amount the customer owes.
+func (o *Order) TotalUSDC() money.Money {
+	return money.NewMoney(o.AmountUSDC, money.USDC)
+}
+
+// PayoutUSDC returns the part of the order's amount paid out to the
+// merchant: everything but the platform's fees, less what has been refunded
+// to the customer beyond any excess they paid.
+func (o *Order) PayoutUSDC() money.Money {
+	payout := o.AmountUSDC
+	for _, f := range o.FeeBreakdown {
+		if f.Kind == FeePlatform {
+			payout = payout.Sub(f.AmountUSDC)
+		}
+	}
+	excess := o.ReceivedUSDC.Sub(o.AmountUSDC)
+	if excess.Sign() < 0 {
+		excess = money.Decimal{}
+	}
+	if fromPayout := o.RefundedUSDC.Sub(excess); fromPayout.Sign() > 0 {
+		payout = payout.Sub(fromPayout)
+	}
+	return money.NewMoney(payout, money.USDC)
+}
+
+// TotalPayout returns the fiat estimate for the order's payout, in the
+// currency of its payout destination.
+func (o *Order) TotalPayout() money.Money {
+	return money.NewMoney(o.PayoutAmount, money.Currency(o.PayoutCurrency))
+}
+
+// Received returns the USDC received for the order so far.
+func (o *Order) Received() money.Money {
+	return money.NewMoney(o.ReceivedUSDC, money.USDC)
+}
+
+// Balances derives what is still due from the customer and what is owed back
+// to them from the amount received. While an order awaits payment the
+// shortfall is due; once it is paid (or accepted within tolerance) nothing is
+// due and any excess is owed. Money received for an order that will not be
+// fulfilled is owed in full. Refunds reduce what is owed.
+func (o *Order) Balances() (due, owed money.Money) {
+	due, owed = money.Zero(money.USDC), money.Zero(money.USDC)
+	diff := o.ReceivedUSDC.Sub(o.AmountUSDC)
+	switch o.Status {
+	case StatusPendingPayment, StatusUnderpaid:
+		if diff.Sign() < 0 {
+			due = money.NewMoney(diff.Neg(), money.USDC)
+		} else {
+			owed = money.NewMoney(diff, money.USDC)
+		}
+	case StatusPaid, StatusOverpaid, StatusPayoutCreated, StatusPayoutPending, StatusPayoutError, StatusWithdrawn:
+		if diff.Sign() > 0 {
+			owed = money.NewMoney(diff, money.USDC)
+		}
+	default:
+		owed = o.Received()
+	}
+	if rest := owed.Amount.Sub(o.RefundedUSDC); rest.Sign() > 0 {
+		owed = money.NewMoney(rest, money.USDC)
+	} else {
+		owed = money.Zero(money.USDC)
+	}
+	return due, owed
+}
+
+// Refundable returns how much may still be refunded to the customer: what is
+// owed back to them, except while the order awaits payment, when everything
+// received counts towards the order. An order that is paid but whose payout
+// has not been made can be refunded in part or in full; refunding more than
+// is owed reduces its payout, and refunding everything cancels it (see
+// RefundStore.Create).
+func (o *Order) Refundable() money.Money {
+	switch o.Status {
+	case StatusPendingPayment, StatusUnderpaid:
+		return money.Zero(money.USDC)
+	}
+	if o.awaitingPayout() {
+		if rest := o.ReceivedUSDC.Sub(o.RefundedUSDC); rest.Sign() > 0 {
+			return money.NewMoney(rest, money.USDC)
+		}
+		return money.Zero(money.USDC)
+	}
+	_, owed := o.Balances()
+	return owed
+}
+
+// awaitingPayout reports whether the order is paid but no payout of it is
+// under way or made.
+func (o *Order) awaitingPayout() bool {
+	switch o.Status {
+	case StatusPaid, StatusOverpaid, StatusPayoutError:
+		return true
+	}
+	return false
 }
 
 type OrderStore struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	onEvent func(orderID uuid.UUID)
 }
 
 func NewOrderStore(pool *pgxpool.Pool) *OrderStore {
 	return &OrderStore{pool: pool}
 }
 
-func (s *OrderStore) Create(ctx context.Context, o *Order) error {
+const orderColumns = `id, customer_id, customer_name, customer_email, items, subtotal_usdc, fees_usdc, fee_breakdown,
+		       amount_usdc, amount_cop,
+		       payout_amount, payout_currency,
+		       payment_reference, payment_deposit_id, payin_id, payin_status, status,
+		       payout_destination_id, mural_payout_request_id, mural_payout_status, payout_attempt,
+		       quote_rail, quote_rate, quote_fee_usdc, quoted_at, quote_expires_at,
+		       price_currency, subtotal_fiat, checkout_rail, checkout_rate, checkout_quoted_at, checkout_sell_rate,
+		       expires_at, created_at, updated_at, ` + receivedUSDC + `, ` + refundedUSDC
+
+// receivedUSDC sums the completed deposits attributed to an order and
+// refundedUSDC the refunds that have not failed. They are selected last in
+// orderColumns.
+const (
+	receivedUSDC = `(SELECT COALESCE(SUM(d.amount_usdc), 0) FROM deposits d
+		        WHERE d.order_id = orders.id AND d.status = 'completed')`
+	refundedUSDC = `(SELECT COALESCE(SUM(rf.amount_usdc), 0) FROM refunds rf
+		        WHERE rf.order_id = orders.id AND rf.status <> 'failed')`
+)
+
+// Create inserts a new order. The amount the customer must send is the
+// subtotal plus fees plus a unique sub-cent payment reference (see
+// payment.go), so o.SubtotalUSDC (and any o.FeeBreakdown) must be set and
+// o.FeesUSDC and o.AmountUSDC are filled in by Create. An order
+// with ExpiresAt set expires if it is not paid by then. The given workflow
+// runs are started for the order in the same transaction, so an order never
+// exists without them.
+func (s *OrderStore) Create(ctx context.Context, o *Order, runs ...*WorkflowRun) error {
 	if o.ID == uuid.Nil {
 		o.ID = uuid.New()
 	}
@@ -56,30 +247,78 @@ func (s *OrderStore) Create(ctx context.Context, o *Order) error {
 	if err != nil {
 		return err
 	}
+	if o.FeeBreakdown == nil {
+		o.FeeBreakdown = []FeeLine{}
+	}
+	o.FeesUSDC = money.Decimal{}
+	for _, f := range o.FeeBreakdown {
+		o.FeesUSDC = o.FeesUSDC.Add(f.AmountUSDC)
+	}
+	feesJSON, err := json.Marshal(o.FeeBreakdown)
+	if err != nil {
+		return err
+	}
+	// Orders priced in USDC leave the fiat pricing columns NULL.
+	var fp struct {
+		currency, rail           *string
+		subtotal, rate, sellRate *money.Decimal
+		quotedAt                 *time.Time
+	}
+	if p := o.FiatPricing; p != nil {
+		currency, subtotal := string(p.Currency), p.SubtotalFiat.Round(p.Currency.Scale())
+		fp.currency, fp.subtotal, fp.rail, fp.rate, fp.quotedAt = &currency, &subtotal, &p.Rail, &p.Rate, &p.QuotedAt
+		fp.sellRate = p.SellRate
+	}
 
-	return s.pool.QueryRow(ctx, `
-		INSERT INTO orders (id, customer_name, customer_email, items, amount_usdc, amount_cop, status)
-		VALUES ($1,$2,$3,$4,$5,$6,$7)
-		RETURNING created_at, updated_at
-	`, o.ID, o.CustomerName, o.CustomerEmail, itemsJSON, o.AmountUSDC, o.AmountCOP, string(o.Status)).
-		Scan(&o.CreatedAt, &o.UpdatedAt)
+	err = s.withPaymentReference(ctx, o, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO orders (id, customer_id, customer_name, customer_email, items, subtotal_usdc, fees_usdc, fee_breakdown,
+			                    amount_usdc, amount_cop, payment_reference, status, expires_at,
+			                    price_currency, subtotal_fiat, checkout_rail, checkout_rate, checkout_quoted_at, checkout_sell_rate)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19)
+			RETURNING created_at, updated_at
+		`, o.ID, nullableUUID(o.CustomerID), o.CustomerName, o.CustomerEmail, itemsJSON,
+			o.SubtotalUSDC.Round(money.USDC.Scale()), o.FeesUSDC.Round(money.USDC.Scale()), feesJSON,
+			o.AmountUSDC.Round(money.USDC.Scale()), o.AmountCOP.Round(money.COP.Scale()),
+			o.PaymentReference, string(o.Status), o.ExpiresAt,
+			fp.currency, fp.subtotal, fp.rail, fp.rate, fp.quotedAt, fp.sellRate).
+			Scan(&o.CreatedAt, &o.UpdatedAt); err != nil {
+			return err
+		}
+		if err := insertOrderEvent(ctx, tx, o.ID, "", o.Status, ActorCustomer, "order created"); err != nil {
+			return err
+		}
+		for _, run := range runs {
+			run.OrderID = o.ID
+			if err := insertWorkflowRun(ctx, tx, run); err != nil {
+				return fmt.Errorf("start %s workflow: %w", run.Kind, err)
+			}
+		}
+		return nil
+	})
+	return s.eventRecorded(o.ID, err)
 }
 
 func (s *OrderStore) GetByID(ctx context.Context, id uuid.UUID) (*Order, error) {
 	row := s.pool.QueryRow(ctx, `
-		SELECT id, customer_name, customer_email, items, amount_usdc, amount_cop, status,
-		       mural_payout_request_id, mural_payout_status,
-		       created_at, updated_at
+		SELECT `+orderColumns+`
 		FROM orders WHERE id=$1
 	`, id)
 	return scanOrder(row)
 }
 
+// GetByPayoutRequestID returns the order paid out by a Mural payout request.
+func (s *OrderStore) GetByPayoutRequestID(ctx context.Context, payoutRequestID uuid.UUID) (*Order, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders WHERE mural_payout_request_id=$1
+	`, payoutRequestID)
+	return scanOrder(row)
+}
+
 func (s *OrderStore) ListAll(ctx context.Context) ([]*Order, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, customer_name, customer_email, items, amount_usdc, amount_cop, status,
-		       mural_payout_request_id, mural_payout_status,
-		       created_at, updated_at
+		SELECT `+orderColumns+`
 		FROM orders ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -98,50 +337,252 @@ func (s *OrderStore) ListAll(ctx context.Context) ([]*Order, error) {
 	return out, rows.Err()
 }
 
-func (s *OrderStore) UpdateStatus(ctx context.Context, id uuid.UUID, status OrderStatus, amountCOP float64) error {
-	_, err := s.pool.Exec(ctx, `
-		UPDATE orders
-		SET status=$2,
-		    amount_cop=COALESCE($3, amount_cop),
-		    updated_at=NOW()
-		WHERE id=$1
-	`, id, string(status), amountCOP)
-	return err
+// ListByCustomer returns up to limit of a customer's orders, newest first.
+// When afterID is set, the page starts after that order, so a client pages
+// through history by passing the last ID it saw. more reports whether another
+// page follows.
+func (s *OrderStore) ListByCustomer(ctx context.Context, customerID uuid.UUID, afterID uuid.UUID, limit int) (orders []*Order, more bool, err error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE customer_id=$1
+		  AND ($2::uuid IS NULL OR (created_at, id) < (SELECT created_at, id FROM orders WHERE id=$2))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, customerID, nullableUUID(afterID), limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(orders) > limit {
+		return orders[:limit], true, nil
+	}
+	return orders, false, nil
+}
+
+// ListOverdue returns up to limit orders still awaiting (full) payment after
+// their expiry time, including those whose last payment attempt failed.
+func (s *OrderStore) ListOverdue(ctx context.Context, now time.Time, limit int) ([]*Order, error) {
+	return s.list(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE status IN ('pending_payment', 'underpaid', 'payment_failed') AND expires_at <= $1
+		ORDER BY expires_at
+		LIMIT $2
+	`, now, limit)
+}
+
+// OldestAwaitingPayment returns when the oldest order still accepting
+// payment was created; ok is false if there is none.
+func (s *OrderStore) OldestAwaitingPayment(ctx context.Context) (created time.Time, ok bool, err error) {
+	var t *time.Time
+	err = s.pool.QueryRow(ctx, `
+		SELECT MIN(created_at) FROM orders
+		WHERE status IN ('pending_payment', 'underpaid', 'payment_failed')
+	`).Scan(&t)
+	if err != nil || t == nil {
+		return time.Time{}, false, err
+	}
+	return *t, true, nil
+}
+
+// ListAwaitingLatePayment returns expired, unsettled orders that expired
+// after since, i.e. those whose amount is still held for a late deposit.
+func (s *OrderStore) ListAwaitingLatePayment(ctx context.Context, since time.Time) ([]*Order, error) {
+	return s.list(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE status = 'expired' AND payment_deposit_id IS NULL AND expires_at > $1
+		ORDER BY expires_at
+	`, since)
+}
+
+// ListWithBalance returns the orders that have received deposits and still
+// have a balance due from or owed to the customer, oldest first.
+func (s *OrderStore) ListWithBalance(ctx context.Context) ([]*Order, error) {
+	orders, err := s.list(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE EXISTS (SELECT 1 FROM deposits d WHERE d.order_id = orders.id AND d.status = 'completed')
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	out := orders[:0]
+	for _, o := range orders {
+		if !o.BalanceDueUSDC.IsZero() || !o.BalanceOwedUSDC.IsZero() {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *OrderStore) list(ctx context.Context, query string, args ...any) ([]*Order, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// ListCreatedBetween returns the orders created in [from, to), oldest first.
+func (s *OrderStore) ListCreatedBetween(ctx context.Context, from, to time.Time) ([]*Order, error) {
+	return s.list(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders WHERE created_at >= $1 AND created_at < $2
+		ORDER BY created_at
+	`, from, to)
 }
 
 func scanOrder(row pgx.Row) (*Order, error) {
 	var (
 		o            Order
+		customerID   *uuid.UUID
 		itemsRaw     []byte
+		feesRaw      []byte
+		payoutCcy    *string
+		paymentRef   *string
+		depositID    *string
+		payinID      *string
+		payinStatus  *string
 		status       string
+		destID       *uuid.UUID
 		payoutID     *uuid.UUID
 		payoutStatus *string
+		quoteRail    *string
+		quoteRate    *money.Decimal
+		quoteFee     *money.Decimal
+		quotedAt     *time.Time
+		quoteExpiry  *time.Time
+		priceCcy     *string
+		subtotalFiat *money.Decimal
+		checkoutRail *string
+		checkoutRate *money.Decimal
+		checkoutAt   *time.Time
+		sellRate     *money.Decimal
 	)
 	if err := row.Scan(
 		&o.ID,
+		&customerID,
 		&o.CustomerName,
 		&o.CustomerEmail,
 		&itemsRaw,
+		&o.SubtotalUSDC,
+		&o.FeesUSDC,
+		&feesRaw,
 		&o.AmountUSDC,
 		&o.AmountCOP,
+		&o.PayoutAmount,
+		&payoutCcy,
+		&paymentRef,
+		&depositID,
+		&payinID,
+		&payinStatus,
 		&status,
+		&destID,
 		&payoutID,
 		&payoutStatus,
+		&o.PayoutAttempt,
+		&quoteRail,
+		&quoteRate,
+		&quoteFee,
+		&quotedAt,
+		&quoteExpiry,
+		&priceCcy,
+		&subtotalFiat,
+		&checkoutRail,
+		&checkoutRate,
+		&checkoutAt,
+		&sellRate,
+		&o.ExpiresAt,
 		&o.CreatedAt,
 		&o.UpdatedAt,
+		&o.ReceivedUSDC,
+		&o.RefundedUSDC,
 	); err != nil {
 		return nil, err
 	}
 	if err := json.Unmarshal(itemsRaw, &o.Items); err != nil {
 		return nil, err
 	}
+	if err := json.Unmarshal(feesRaw, &o.FeeBreakdown); err != nil {
+		return nil, err
+	}
+	if customerID != nil {
+		o.CustomerID = *customerID
+	}
+	if payoutCcy != nil {
+		o.PayoutCurrency = *payoutCcy
+	}
+	if paymentRef != nil {
+		o.PaymentReference = *paymentRef
+	}
+	if depositID != nil {
+		o.PaymentDepositID = *depositID
+	}
+	if payinID != nil {
+		o.PayinID = *payinID
+	}
+	if payinStatus != nil {
+		o.PayinStatus = *payinStatus
+	}
 	o.Status = OrderStatus(status)
+	if destID != nil {
+		o.PayoutDestinationID = *destID
+	}
 	if payoutID != nil {
 		o.MuralPayoutRequestID = *payoutID
 	}
 	if payoutStatus != nil {
 		o.MuralPayoutStatus = *payoutStatus
 	}
+	if quoteRail != nil && quoteRate != nil && quotedAt != nil && quoteExpiry != nil {
+		o.Quote = &FXQuote{
+			Rail:       *quoteRail,
+			Currency:   money.Currency(o.PayoutCurrency),
+			Rate:       *quoteRate,
+			FiatAmount: o.PayoutAmount,
+			QuotedAt:   *quotedAt,
+			ExpiresAt:  *quoteExpiry,
+		}
+		if quoteFee != nil {
+			o.Quote.FeeUSDC = *quoteFee
+		}
+	}
+	if priceCcy != nil && subtotalFiat != nil && checkoutRail != nil && checkoutRate != nil && checkoutAt != nil {
+		o.FiatPricing = &FiatPricing{
+			Currency:     money.Currency(*priceCcy),
+			SubtotalFiat: *subtotalFiat,
+			Rail:         *checkoutRail,
+			Rate:         *checkoutRate,
+			SellRate:     sellRate,
+			QuotedAt:     *checkoutAt,
+		}
+	}
+	due, owed := o.Balances()
+	o.BalanceDueUSDC, o.BalanceOwedUSDC = due.Amount, owed.Amount
 	return &o, nil
 }
 
@@ -156,3 +597,94 @@ func (s *OrderStore) UpdatePayoutMetadata(ctx context.Context, id uuid.UUID, pay
 	`, id, payoutRequestID, payoutStatus)
 	return err
 }
+
+// ErrPayoutAmountChanged is returned by RecordPayoutRequest when the order's
+// payout amount changed (by a refund) while its payout request was created.
+var ErrPayoutAmountChanged = errors.New("order's payout amount changed")
+
+// RecordPayoutRequest stores the Mural payout request created to pay out
+// amount for an order. The order is locked while its payout amount is
+// checked, which serialises it with RefundStore.Create: if a refund changed
+// the amount meanwhile, the request is not recorded, the order moves on to
+// its next payout attempt and ErrPayoutAmountChanged is returned, so the
+// payout is requested again for the new amount.
+func (s *OrderStore) RecordPayoutRequest(ctx context.Context, id, payoutRequestID uuid.UUID, payoutStatus string, amount money.Money) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := lockOrderStatus(ctx, tx, id); err != nil {
+			return err
+		}
+		o, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM orders WHERE id=$1`, id))
+		if err != nil {
+			return err
+		}
+		cmp, err := o.PayoutUSDC().Cmp(amount)
+		if err != nil {
+			return err
+		}
+		if cmp != 0 {
+			if _, err := tx.Exec(ctx, `
+				UPDATE orders SET payout_attempt=payout_attempt+1, updated_at=NOW() WHERE id=$1
+			`, id); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: requested %s, now %s", ErrPayoutAmountChanged, amount, o.PayoutUSDC())
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE orders
+			SET mural_payout_request_id=$2,
+			    mural_payout_status=$3,
+			    updated_at=NOW()
+			WHERE id=$1
+		`, id, payoutRequestID, payoutStatus)
+		return err
+	})
+}
+
+// ReleasePayoutRequest detaches a failed payout request from an order in
+// payout_error and moves the order on to its next payout attempt, so the
+// payout can be retried with a new request. It does nothing if the order is
+// no longer paid out by that request; released reports whether it did.
+func (s *OrderStore) ReleasePayoutRequest(ctx context.Context, id, payoutRequestID uuid.UUID) (released bool, err error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE orders
+		SET mural_payout_request_id=NULL,
+		    payout_attempt=payout_attempt+1,
+		    updated_at=NOW()
+		WHERE id=$1 AND status='payout_error' AND mural_payout_request_id=$2
+	`, id, payoutRequestID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdatePayin links a Mural Payin to an order and records its latest status.
+func (s *OrderStore) UpdatePayin(ctx context.Context, id uuid.UUID, payinID, payinStatus string) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE orders
+		SET payin_id=$2,
+		    payin_status=$3,
+		    updated_at=NOW()
+		WHERE id=$1
+	`, id, payinID, payinStatus)
+	return err
+}
+
+// SetPayoutDestination records the destination an order's payout is sent to.
+func (s *OrderStore) SetPayoutDestination(ctx context.Context, id uuid.UUID, destinationID uuid.UUID) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE orders
+		SET payout_destination_id=$2,
+		    updated_at=NOW()
+		WHERE id=$1
+	`, id, destinationID)
+	return err
+}
+
+// nullableUUID maps the zero UUID to SQL NULL.
+func nullableUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// orderTransitions lists, for each status, the statuses an order may move to.
+// Statuses without an entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusPendingPayment: {StatusPaid, StatusUnderpaid, StatusOverpaid, StatusPaymentFailed, StatusExpired, StatusCancelled},
+	StatusPaymentFailed:  {StatusPaid, StatusUnderpaid, StatusOverpaid, StatusExpired, StatusCancelled},
+	// Part of the amount has arrived; the rest is still due.
+	StatusUnderpaid: {StatusPaid, StatusOverpaid, StatusExpired, StatusCancelled},
+	// Until its payout is created a paid order may still be cancelled, to
+	// refund the customer in full instead.
+	StatusPaid: {StatusPayoutCreated, StatusPayoutError, StatusRefunded, StatusCancelled},
+	// Paid with an excess that is owed back to the customer; the payout goes
+	// ahead as for a paid order.
+	StatusOverpaid:      {StatusPayoutCreated, StatusPayoutError, StatusRefunded, StatusCancelled},
+	StatusPayoutCreated: {StatusPayoutPending, StatusWithdrawn, StatusPayoutError},
+	StatusPayoutPending: {StatusWithdrawn, StatusPayoutError},
+	StatusPayoutError:   {StatusPayoutCreated, StatusRefunded, StatusCancelled},
+	StatusExpired:       {StatusLatePayment, StatusCancelled, StatusRefunded},
+	// A deposit arrived after the order expired; an admin either accepts it
+	// (paid) or returns it.
+	StatusLatePayment: {StatusPaid, StatusRefunded, StatusCancelled},
+	// Money received for a cancelled order is owed back; the order is
+	// refunded once all of it has been returned.
+	StatusCancelled: {StatusRefunded},
+}
+
+// Terminal reports whether an order in status s can no longer change status.
+func (s OrderStatus) Terminal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// CanTransitionTo reports whether an order in status s may move to status to.
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrInvalidTransition is matched (via errors.Is) by every *TransitionError.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// TransitionError is returned when an order cannot move between two statuses.
+type TransitionError struct {
+	OrderID uuid.UUID
+	From    OrderStatus
+	To      OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order %s: cannot transition from %s to %s", e.OrderID, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// Actors recorded on order events.
+const (
+	ActorSystem   = "system"
+	ActorWorkflow = "workflow"
+	ActorWebhook  = "webhook"
+	ActorAdmin    = "admin"
+	ActorCustomer = "customer"
+)
+
+// OrderEvent is one entry in an order's status history.
+type OrderEvent struct {
+	ID         int64       `json:"id"`
+	OrderID    uuid.UUID   `json:"orderId"`
+	FromStatus OrderStatus `json:"fromStatus,omitempty"`
+	ToStatus   OrderStatus `json:"toStatus"`
+	Actor      string      `json:"actor"`
+	Reason     string      `json:"reason,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+// Transition moves an order to status to if the state machine allows it and
+// records the change in order_events. Moving an order to the status it is
+// already in is a no-op, which keeps retried steps and duplicate webhooks
+// harmless.
+func (s *OrderStore) Transition(ctx context.Context, id uuid.UUID, to OrderStatus, actor, reason string) error {
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return transitionTx(ctx, tx, id, to, actor, reason)
+	})
+	return s.eventRecorded(id, err)
+}
+
+// TransitionFrom is Transition for actions that only make sense in one
+// status, such as accepting a late payment: it fails with a *TransitionError
+// unless the order is currently in status from.
+func (s *OrderStore) TransitionFrom(ctx context.Context, id uuid.UUID, from, to OrderStatus, actor, reason string) error {
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		current, err := lockOrderStatus(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current != from {
+			return &TransitionError{OrderID: id, From: current, To: to}
+		}
+		return transitionTx(ctx, tx, id, to, actor, reason)
+	})
+	return s.eventRecorded(id, err)
+}
+
+func lockOrderStatus(ctx context.Context, tx pgx.Tx, id uuid.UUID) (OrderStatus, error) {
+	var current string
+	err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, id).Scan(&current)
+	return OrderStatus(current), err
+}
+
+func transitionTx(ctx context.Context, tx pgx.Tx, id uuid.UUID, to OrderStatus, actor, reason string) error {
+	from, err := lockOrderStatus(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if !from.CanTransitionTo(to) {
+		return &TransitionError{OrderID: id, From: from, To: to}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE orders SET status=$2, updated_at=NOW() WHERE id=$1
+	`, id, string(to)); err != nil {
+		return err
+	}
+	return insertOrderEvent(ctx, tx, id, from, to, actor, reason)
+}
+
+// OrderEventsChannel is the Postgres NOTIFY channel every recorded order
+// event is announced on, with the order ID as payload, so that every replica
+// learns of status changes made by the others. Notifications are sent when
+// the recording transaction commits.
+const OrderEventsChannel = "order_events"
+
+func insertOrderEvent(ctx context.Context, tx pgx.Tx, id uuid.UUID, from, to OrderStatus, actor, reason string) error {
+	var fromStatus *string
+	if from != "" {
+		f := string(from)
+		fromStatus = &f
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO order_events (order_id, from_status, to_status, actor, reason)
+		VALUES ($1,$2,$3,$4,NULLIF($5, ''))
+	`, id, fromStatus, string(to), actor, reason); err != nil {
+		return err
+	}
+	if err := enqueueWebhookEvent(ctx, tx, id, from, to); err != nil {
+		return fmt.Errorf("enqueue merchant webhook event: %w", err)
+	}
+	_, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, OrderEventsChannel, id.String())
+	return err
+}
+
+// OnEvent registers fn to be called, in this process, after an order event
+// has been recorded through the store. It must be set before the store is
+// used.
+func (s *OrderStore) OnEvent(fn func(orderID uuid.UUID)) {
+	s.onEvent = fn
+}
+
+// eventRecorded reports a committed change to order id to the OnEvent hook and
+// passes err through.
+func (s *OrderStore) eventRecorded(id uuid.UUID, err error) error {
+	if err == nil && s.onEvent != nil {
+		s.onEvent(id)
+	}
+	return err
+}
+
+// ListEvents returns the status history of an order, oldest first.
+func (s *OrderStore) ListEvents(ctx context.Context, id uuid.UUID) ([]*OrderEvent, error) {
+	return s.ListEventsAfter(ctx, id, 0)
+}
+
+// ListEventsAfter returns the order's events with IDs above afterID, oldest
+// first.
+func (s *OrderStore) ListEventsAfter(ctx context.Context, id uuid.UUID, afterID int64) ([]*OrderEvent, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, order_id, from_status, to_status, actor, reason, created_at
+		FROM order_events WHERE order_id=$1 AND id > $2 ORDER BY id
+	`, id, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*OrderEvent
+	for rows.Next() {
+		var (
+			ev     OrderEvent
+			from   *string
+			to     string
+			reason *string
+		)
+		if err := rows.Scan(&ev.ID, &ev.OrderID, &from, &to, &ev.Actor, &reason, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if from != nil {
+			ev.FromStatus = OrderStatus(*from)
+		}
+		ev.ToStatus = OrderStatus(to)
+		if reason != nil {
+			ev.Reason = *reason
+		}
+		out = append(out, &ev)
+	}
+	return out, rows.Err()
+}
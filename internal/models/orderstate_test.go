@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var allOrderStatuses = []OrderStatus{
+	StatusPendingPayment, StatusPaymentFailed, StatusUnderpaid, StatusPaid, StatusOverpaid,
+	StatusPayoutCreated, StatusPayoutPending, StatusWithdrawn, StatusPayoutError,
+	StatusExpired, StatusLatePayment, StatusRefunded, StatusCancelled,
+}
+
+func TestTerminal(t *testing.T) {
+	terminal := map[OrderStatus]bool{StatusWithdrawn: true, StatusRefunded: true}
+	for _, s := range allOrderStatuses {
+		if got := s.Terminal(); got != terminal[s] {
+			t.Errorf("%s.Terminal() = %v, want %v", s, got, terminal[s])
+		}
+	}
+	if !OrderStatus("bogus").Terminal() {
+		t.Error("unknown status is not terminal")
+	}
+}
+
+func TestCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		want     bool
+	}{
+		{StatusPendingPayment, StatusPaid, true},
+		{StatusPendingPayment, StatusUnderpaid, true},
+		{StatusPendingPayment, StatusExpired, true},
+		{StatusPendingPayment, StatusPayoutCreated, false},
+		{StatusPendingPayment, StatusRefunded, false},
+		{StatusPaymentFailed, StatusPaid, true},
+		{StatusUnderpaid, StatusPaid, true},
+		{StatusUnderpaid, StatusPendingPayment, false},
+		{StatusPaid, StatusPayoutCreated, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusPaid, StatusPendingPayment, false},
+		{StatusPaid, StatusWithdrawn, false},
+		{StatusOverpaid, StatusPayoutCreated, true},
+		{StatusPayoutCreated, StatusPayoutPending, true},
+		{StatusPayoutCreated, StatusCancelled, false},
+		{StatusPayoutCreated, StatusRefunded, false},
+		{StatusPayoutPending, StatusWithdrawn, true},
+		{StatusPayoutPending, StatusPayoutCreated, false},
+		{StatusPayoutError, StatusPayoutCreated, true},
+		{StatusPayoutError, StatusRefunded, true},
+		{StatusExpired, StatusLatePayment, true},
+		{StatusExpired, StatusPaid, false},
+		{StatusLatePayment, StatusPaid, true},
+		{StatusCancelled, StatusRefunded, true},
+		{StatusCancelled, StatusPaid, false},
+		{StatusWithdrawn, StatusRefunded, false},
+		{StatusRefunded, StatusPaid, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionsTargetKnownStatuses(t *testing.T) {
+	known := map[OrderStatus]bool{}
+	for _, s := range allOrderStatuses {
+		known[s] = true
+	}
+	for from, targets := range orderTransitions {
+		if !known[from] {
+			t.Errorf("transitions listed for unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !known[to] {
+				t.Errorf("%s: transition to unknown status %q", from, to)
+			}
+			if to == from {
+				t.Errorf("%s: lists a transition to itself", from)
+			}
+		}
+	}
+}
+
+func TestTransitionErrorIsInvalidTransition(t *testing.T) {
+	err := error(&TransitionError{OrderID: uuid.New(), From: StatusRefunded, To: StatusPaid})
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("errors.Is(%v, ErrInvalidTransition) = false", err)
+	}
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// Payment references.
+//
+// All customers pay into the same Mural account, so an incoming deposit is
+// attributed to an order by its amount. Each order's amount is its
+// subtotal and fees plus a random "tag" of 1-9999 micro-USDC
+// (0.000001-0.009999), and the idx_orders_accepting_amount unique index
+// guarantees no two orders awaiting payment share an amount. The tag,
+// zero-padded, is the order's payment reference, and a deposit whose sub-cent
+// digits carry it is recognised even when its amount is off. Settling an
+// order records the deposit ID in the uniquely indexed payment_deposit_id
+// column, so a deposit can settle at most one order.
+//
+// When an order expires its amount stays reserved for LatePaymentWindow, so a
+// deposit that arrives late is still attributed to it (as a late payment)
+// rather than to a new order that happens to reuse the amount.
+//
+// Customers do not always send the exact amount. Every deposit is recorded in
+// the deposits table and linked to the order it pays, and an order's received
+// amount is the sum of its completed deposits; see payments.Ledger for how
+// deposits are matched and how underpaid and overpaid orders are settled.
+
+// LatePaymentWindow is how long after expiry a deposit for an order is still
+// recognised as a late payment for it.
+const LatePaymentWindow = 24 * time.Hour
+
+const (
+	maxPaymentTag          = 9999
+	paymentReferenceTries  = 20
+	maxDepositCandidates   = 100
+	openAmountConstraint   = "idx_orders_accepting_amount"
+	depositClaimConstraint = "idx_orders_payment_deposit"
+)
+
+var (
+	// ErrDepositAlreadyClaimed is returned by MarkPaid when the deposit has
+	// already settled a different order.
+	ErrDepositAlreadyClaimed = errors.New("deposit already settled another order")
+	// ErrOrderAlreadySettled is returned by MarkPaid when the order was already
+	// settled by a different deposit.
+	ErrOrderAlreadySettled = errors.New("order already settled by another deposit")
+	// errAmountHeld means an amount is reserved by a recently expired order.
+	errAmountHeld = errors.New("amount held by an expired order")
+	// ErrNoPaymentReference is returned when no free payment reference could be
+	// allocated for a subtotal.
+	ErrNoPaymentReference = errors.New("could not allocate a unique payment reference")
+)
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
+func randomPaymentTag() (int64, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(maxPaymentTag))
+	if err != nil {
+		return 0, err
+	}
+	return n.Int64() + 1, nil
+}
+
+// PaymentReferenceOf returns the payment reference carried by an amount: its
+// sub-cent digits, zero-padded like Order.PaymentReference. An amount in whole
+// cents carries "0000", which no order has.
+func PaymentReferenceOf(amount money.Decimal) string {
+	s := amount.Abs().StringFixed(money.USDC.Scale())
+	return s[len(s)-4:]
+}
+
+// heldSince returns the earliest expiry of an expired order whose amount is
+// still held for a late payment at now.
+func heldSince(now time.Time) time.Time {
+	return now.Add(-LatePaymentWindow)
+}
+
+// withPaymentReference assigns o a random payment reference and runs insert in
+// a transaction, retrying with a fresh reference if the resulting amount
+// collides with another order awaiting payment or is still held by an expired
+// one.
+func (s *OrderStore) withPaymentReference(ctx context.Context, o *Order, insert func(tx pgx.Tx) error) error {
+	return assignPaymentReference(o, randomPaymentTag, func() error {
+		return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			var held bool
+			if err := tx.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM orders
+					WHERE status = 'expired' AND amount_usdc = $1 AND expires_at > $2
+				)
+			`, o.AmountUSDC, heldSince(time.Now())).Scan(&held); err != nil {
+				return err
+			}
+			if held {
+				return errAmountHeld
+			}
+			return insert(tx)
+		})
+	})
+}
+
+// assignPaymentReference sets o's payment reference and amount from tags
+// drawn from nextTag and calls try for each, until try does not report the
+// amount as taken (by idx_orders_accepting_amount or errAmountHeld) or
+// paymentReferenceTries run out.
+func assignPaymentReference(o *Order, nextTag func() (int64, error), try func() error) error {
+	base := o.SubtotalUSDC.Add(o.FeesUSDC)
+	for range paymentReferenceTries {
+		tag, err := nextTag()
+		if err != nil {
+			return err
+		}
+		o.PaymentReference = fmt.Sprintf("%04d", tag)
+		o.AmountUSDC = base.Add(money.New(tag, -money.USDC.Scale()))
+
+		err = try()
+		if isUniqueViolation(err, openAmountConstraint) || errors.Is(err, errAmountHeld) {
+			continue
+		}
+		return err
+	}
+	return ErrNoPaymentReference
+}
+
+// FindDepositCandidates returns the orders awaiting payment (pending_payment,
+// underpaid or payment_failed) a deposit of amount may pay: those whose
+// balance still due is within tolerance of amount and those whose payment
+// reference is the one amount carries, oldest first.
+func (s *OrderStore) FindDepositCandidates(ctx context.Context, amount money.Money, tolerance money.Decimal) ([]*Order, error) {
+	if amount.Currency != money.USDC {
+		return nil, &money.ErrCurrencyMismatch{A: amount.Currency, B: money.USDC}
+	}
+	return s.list(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE status IN ('pending_payment', 'underpaid', 'payment_failed')
+		  AND (ABS(amount_usdc - `+receivedUSDC+` - $1) <= $2 OR payment_reference = $3)
+		ORDER BY created_at
+		LIMIT $4
+	`, amount.Amount, tolerance, PaymentReferenceOf(amount.Amount), maxDepositCandidates)
+}
+
+// FindLateByAmount returns the expired, unsettled order whose amount is still
+// held for a late deposit of exactly amount.
+func (s *OrderStore) FindLateByAmount(ctx context.Context, amount money.Money) (*Order, error) {
+	if amount.Currency != money.USDC {
+		return nil, &money.ErrCurrencyMismatch{A: amount.Currency, B: money.USDC}
+	}
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE status = 'expired' AND payment_deposit_id IS NULL AND amount_usdc = $1 AND expires_at > $2
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`, amount.Amount, heldSince(time.Now()))
+	return scanOrder(row)
+}
+
+// MarkPaid settles an order with the given deposit and moves it to paid in a
+// single transaction. Marking an order paid again with the same deposit is a
+// no-op.
+func (s *OrderStore) MarkPaid(ctx context.Context, id uuid.UUID, depositID, actor, reason string) error {
+	return s.settle(ctx, id, depositID, StatusPaid, actor, reason)
+}
+
+// MarkOverpaid is MarkPaid for an order that received more than its amount.
+// The order proceeds to payout like a paid one; the excess is owed back to
+// the customer.
+func (s *OrderStore) MarkOverpaid(ctx context.Context, id uuid.UUID, depositID, actor, reason string) error {
+	return s.settle(ctx, id, depositID, StatusOverpaid, actor, reason)
+}
+
+// MarkLatePayment records a deposit that arrived after the order expired and
+// moves the order to late_payment for an admin to resolve.
+func (s *OrderStore) MarkLatePayment(ctx context.Context, id uuid.UUID, depositID, actor, reason string) error {
+	return s.settle(ctx, id, depositID, StatusLatePayment, actor, reason)
+}
+
+// settle records depositID as the deposit that settled the order and moves it
+// to status to.
+func (s *OrderStore) settle(ctx context.Context, id uuid.UUID, depositID string, to OrderStatus, actor, reason string) error {
+	if depositID == "" {
+		return fmt.Errorf("settle order %s: deposit id is required", id)
+	}
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		var (
+			status   string
+			existing *string
+		)
+		if err := tx.QueryRow(ctx, `
+			SELECT status, payment_deposit_id FROM orders WHERE id=$1 FOR UPDATE
+		`, id).Scan(&status, &existing); err != nil {
+			return err
+		}
+		if existing != nil {
+			if *existing == depositID {
+				return nil
+			}
+			return ErrOrderAlreadySettled
+		}
+		if from := OrderStatus(status); !from.CanTransitionTo(to) {
+			return &TransitionError{OrderID: id, From: from, To: to}
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE orders SET payment_deposit_id=$2, updated_at=NOW() WHERE id=$1
+		`, id, depositID); err != nil {
+			return err
+		}
+		return transitionTx(ctx, tx, id, to, actor, reason)
+	})
+	if isUniqueViolation(err, depositClaimConstraint) {
+		return ErrDepositAlreadyClaimed
+	}
+	return s.eventRecorded(id, err)
+}
+
+// IsDepositClaimed reports whether a deposit has already settled an order.
+func (s *OrderStore) IsDepositClaimed(ctx context.Context, depositID string) (bool, error) {
+	var claimed bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM orders WHERE payment_deposit_id=$1)
+	`, depositID).Scan(&claimed)
+	return claimed, err
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+func TestRandomPaymentTagRange(t *testing.T) {
+	for range 20000 {
+		tag, err := randomPaymentTag()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag < 1 || tag > maxPaymentTag {
+			t.Fatalf("tag %d outside 1-%d", tag, maxPaymentTag)
+		}
+	}
+}
+
+func tags(values ...int64) func() (int64, error) {
+	return func() (int64, error) {
+		tag := values[0]
+		values = values[1:]
+		return tag, nil
+	}
+}
+
+func newPricedOrder() *Order {
+	return &Order{SubtotalUSDC: money.MustParse("12.5"), FeesUSDC: money.MustParse("0.37")}
+}
+
+func TestAssignPaymentReference(t *testing.T) {
+	tests := []struct {
+		tag           int64
+		wantRef       string
+		wantAmountStr string
+	}{
+		{1, "0001", "12.870001"},
+		{42, "0042", "12.870042"},
+		{9999, "9999", "12.879999"},
+	}
+	for _, tt := range tests {
+		o := newPricedOrder()
+		if err := assignPaymentReference(o, tags(tt.tag), func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if o.PaymentReference != tt.wantRef || o.AmountUSDC.String() != tt.wantAmountStr {
+			t.Errorf("tag %d: reference %q, amount %s; want %q, %s", tt.tag, o.PaymentReference, o.AmountUSDC,
+				tt.wantRef, tt.wantAmountStr)
+		}
+		if got := PaymentReferenceOf(o.AmountUSDC); got != o.PaymentReference {
+			t.Errorf("tag %d: amount %s carries reference %q", tt.tag, o.AmountUSDC, got)
+		}
+		// The reference stays below a cent, so it never changes the cents charged.
+		if cents := o.AmountUSDC.Truncate(2); !cents.Equal(money.MustParse("12.87")) {
+			t.Errorf("tag %d changed the cents: %s", tt.tag, o.AmountUSDC)
+		}
+	}
+}
+
+func TestAssignPaymentReferenceRetriesTakenAmounts(t *testing.T) {
+	taken := map[string]error{
+		"12.870007": &pgconn.PgError{Code: "23505", ConstraintName: openAmountConstraint},
+		"12.870008": errAmountHeld,
+	}
+	var tried []string
+	o := newPricedOrder()
+	err := assignPaymentReference(o, tags(7, 8, 9), func() error {
+		tried = append(tried, o.AmountUSDC.String())
+		return taken[o.AmountUSDC.String()]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tried) != 3 || o.PaymentReference != "0009" || o.AmountUSDC.String() != "12.870009" {
+		t.Errorf("tried %v, settled on %q (%s)", tried, o.PaymentReference, o.AmountUSDC)
+	}
+}
+
+func TestAssignPaymentReferenceGivesUp(t *testing.T) {
+	collision := &pgconn.PgError{Code: "23505", ConstraintName: openAmountConstraint}
+	tries := 0
+	err := assignPaymentReference(newPricedOrder(), randomPaymentTag, func() error {
+		tries++
+		return collision
+	})
+	if !errors.Is(err, ErrNoPaymentReference) || tries != paymentReferenceTries {
+		t.Errorf("err %v after %d tries", err, tries)
+	}
+}
+
+func TestAssignPaymentReferenceOtherErrors(t *testing.T) {
+	for _, cause := range []error{
+		&pgconn.PgError{Code: "23505", ConstraintName: "orders_pkey"},
+		&pgconn.PgError{Code: "23514", ConstraintName: openAmountConstraint},
+		errors.New("connection reset"),
+	} {
+		tries := 0
+		err := assignPaymentReference(newPricedOrder(), randomPaymentTag, func() error {
+			tries++
+			return cause
+		})
+		if !errors.Is(err, cause) || tries != 1 {
+			t.Errorf("%v: err %v after %d tries, want it returned at once", cause, err, tries)
+		}
+	}
+}
+
+func TestHeldSince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expiredAgo time.Duration
+		held       bool
+	}{
+		{time.Minute, true},
+		{LatePaymentWindow - time.Second, true},
+		{LatePaymentWindow, false},
+		{LatePaymentWindow + time.Hour, false},
+	}
+	for _, tt := range tests {
+		expiresAt := now.Add(-tt.expiredAgo)
+		// Mirrors the SQL: expires_at > heldSince(now).
+		if held := expiresAt.After(heldSince(now)); held != tt.held {
+			t.Errorf("expired %s ago: held %v, want %v", tt.expiredAgo, held, tt.held)
+		}
+	}
+}
+
+func TestPaymentReferenceOf(t *testing.T) {
+	tests := []struct{ amount, want string }{
+		{"12.870042", "0042"},
+		{"0.009999", "9999"},
+		{"12.87", "0000"},
+		{"100", "0000"},
+		{"5.0000015", "0002"},
+	}
+	for _, tt := range tests {
+		if got := PaymentReferenceOf(money.MustParse(tt.amount)); got != tt.want {
+			t.Errorf("PaymentReferenceOf(%s) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// Product is an entry in the authoritative catalog. Order prices are always
+// taken from here, never from the client.
+//
+// A product is priced either in USDC (PriceCurrency USDC, the default) or in
+// a fiat currency the merchant is paid out in, in which case PriceFiat is
+// authoritative and PriceUSDC is unused: the USDC amount is worked out at
+// checkout from a Mural quote.
+type Product struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	PriceUSDC     money.Decimal  `json:"priceUsdc"`
+	PriceCurrency money.Currency `json:"priceCurrency"`
+	PriceFiat     money.Decimal  `json:"priceFiat"`
+	ImageURL      string         `json:"imageUrl"`
+	Active        bool           `json:"active"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+// Price returns the product's unit price in the currency it is priced in.
+func (p *Product) Price() money.Money {
+	if c := p.priceCurrency(); c == money.USDC {
+		return money.NewMoney(p.PriceUSDC, c)
+	}
+	return money.NewMoney(p.PriceFiat, p.PriceCurrency)
+}
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrProductExists   = errors.New("product already exists")
+)
+
+type ProductStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewProductStore(pool *pgxpool.Pool) *ProductStore {
+	return &ProductStore{pool: pool}
+}
+
+const productColumns = `id, name, description, price_usdc, price_currency, price_fiat, image_url, active, created_at, updated_at`
+
+// List returns catalog products ordered by creation. Inactive products are
+// only included when includeInactive is set.
+func (s *ProductStore) List(ctx context.Context, includeInactive bool) ([]*Product, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+productColumns+`
+		FROM products
+		WHERE active OR $1
+		ORDER BY created_at, id
+	`, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Product
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GetByID returns a product regardless of whether it is active.
+func (s *ProductStore) GetByID(ctx context.Context, id string) (*Product, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+productColumns+` FROM products WHERE id=$1`, id)
+	p, err := scanProduct(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	return p, err
+}
+
+// GetMany returns the products with the given IDs keyed by ID. Missing IDs are
+// simply absent from the map.
+func (s *ProductStore) GetMany(ctx context.Context, ids []string) (map[string]*Product, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+productColumns+` FROM products WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]*Product, len(ids))
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[p.ID] = p
+	}
+	return out, rows.Err()
+}
+
+func (s *ProductStore) Create(ctx context.Context, p *Product) error {
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO products (id, name, description, price_usdc, price_currency, price_fiat, image_url, active)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING created_at, updated_at
+	`, p.ID, p.Name, p.Description, p.PriceUSDC.Round(money.USDC.Scale()), string(p.priceCurrency()),
+		p.PriceFiat.Round(p.priceCurrency().Scale()), p.ImageURL, p.Active).
+		Scan(&p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrProductExists
+	}
+	return err
+}
+
+// Update overwrites every editable field of an existing product.
+func (s *ProductStore) Update(ctx context.Context, p *Product) error {
+	err := s.pool.QueryRow(ctx, `
+		UPDATE products
+		SET name=$2,
+		    description=$3,
+		    price_usdc=$4,
+		    price_currency=$5,
+		    price_fiat=$6,
+		    image_url=$7,
+		    active=$8,
+		    updated_at=NOW()
+		WHERE id=$1
+		RETURNING created_at, updated_at
+	`, p.ID, p.Name, p.Description, p.PriceUSDC.Round(money.USDC.Scale()), string(p.priceCurrency()),
+		p.PriceFiat.Round(p.priceCurrency().Scale()), p.ImageURL, p.Active).
+		Scan(&p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrProductNotFound
+	}
+	return err
+}
+
+// Delete removes a product from the catalog. Existing orders keep their own
+// copy of the name and price, so they are unaffected.
+func (s *ProductStore) Delete(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM products WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+func (p *Product) priceCurrency() money.Currency {
+	if p.PriceCurrency == "" {
+		return money.USDC
+	}
+	return p.PriceCurrency
+}
+
+func scanProduct(row pgx.Row) (*Product, error) {
+	var (
+		p        Product
+		currency string
+	)
+	if err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Description,
+		&p.PriceUSDC,
+		&currency,
+		&p.PriceFiat,
+		&p.ImageURL,
+		&p.Active,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	p.PriceCurrency = money.Currency(currency)
+	return &p, nil
+}
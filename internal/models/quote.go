@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// FXQuote is the USDC→fiat quote locked on an order for its payout: Mural's
+// exchange rate and fees for sending the order's payout amount on Rail, and
+// the fiat amount the merchant receives. It is used until ExpiresAt and then
+// replaced by a fresh quote.
+type FXQuote struct {
+	Rail       string         `json:"rail"`
+	Currency   money.Currency `json:"currency"`
+	Rate       money.Decimal  `json:"rate"`
+	FeeUSDC    money.Decimal  `json:"feeUsdc"`
+	FiatAmount money.Decimal  `json:"fiatAmount"`
+	QuotedAt   time.Time      `json:"quotedAt"`
+	ExpiresAt  time.Time      `json:"expiresAt"`
+}
+
+// Fiat returns the quoted fiat amount.
+func (q *FXQuote) Fiat() money.Money {
+	return money.NewMoney(q.FiatAmount, q.Currency)
+}
+
+// Expired reports whether the quote may no longer be used at now.
+func (q *FXQuote) Expired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
+
+// FiatPricing records how the USDC subtotal of an order priced in fiat was
+// worked out at checkout: the catalog subtotal in Currency, converted with
+// Mural's fiat-to-token quote for Rail at Rate (fiat per USDC). SellRate is
+// Mural's token-to-fiat rate for that USDC subtotal at the same time, which
+// the payout's market rate is checked against; it is unset for orders from
+// before it was recorded.
+type FiatPricing struct {
+	Currency     money.Currency `json:"currency"`
+	SubtotalFiat money.Decimal  `json:"subtotalFiat"`
+	Rail         string         `json:"rail"`
+	Rate         money.Decimal  `json:"rate"`
+	SellRate     *money.Decimal `json:"sellRate,omitempty"`
+	QuotedAt     time.Time      `json:"quotedAt"`
+}
+
+// Subtotal returns the order's subtotal in its pricing currency.
+func (p *FiatPricing) Subtotal() money.Money {
+	return money.NewMoney(p.SubtotalFiat, p.Currency)
+}
+
+// SetQuote locks q on an order and makes its fiat amount the order's payout
+// estimate. COP amounts are also kept in amount_cop for existing clients.
+func (s *OrderStore) SetQuote(ctx context.Context, id uuid.UUID, q *FXQuote) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE orders
+		SET quote_rail=$2,
+		    quote_rate=$3,
+		    quote_fee_usdc=$4,
+		    quoted_at=$5,
+		    quote_expires_at=$6,
+		    payout_amount=$7,
+		    payout_currency=$8,
+		    amount_cop=CASE WHEN $8 = 'COP' THEN $7 ELSE amount_cop END,
+		    updated_at=NOW()
+		WHERE id=$1
+	`, id, q.Rail, q.Rate, q.FeeUSDC.Round(money.USDC.Scale()), q.QuotedAt, q.ExpiresAt,
+		q.FiatAmount.Round(q.Currency.Scale()), string(q.Currency))
+	return err
+}
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// RefundStatus is the state of a refund.
+type RefundStatus string
+
+const (
+	// RefundRequested refunds have no payout request executed yet.
+	RefundRequested RefundStatus = "requested"
+	// RefundProcessing refunds have an executed payout request that has not
+	// reached a final status.
+	RefundProcessing RefundStatus = "processing"
+	RefundCompleted  RefundStatus = "completed"
+	RefundFailed     RefundStatus = "failed"
+)
+
+var (
+	ErrRefundNotFound = errors.New("refund not found")
+	// ErrRefundExceedsRefundable is returned by Create when the refund is
+	// larger than what the order has left to refund.
+	ErrRefundExceedsRefundable = errors.New("refund exceeds the order's refundable amount")
+	// ErrRefundLeavesNoPayout is returned by Create for a partial refund that
+	// would leave nothing of the order to pay out; refund it in full instead.
+	ErrRefundLeavesNoPayout = errors.New("refund leaves nothing to pay out")
+	// ErrPayoutRequested is returned by Create for a refund of more than is
+	// owed once a payout request has been recorded for the order's payout.
+	ErrPayoutRequested = errors.New("order's payout already requested")
+)
+
+// Refund returns USDC from an order to a customer's wallet with a Mural
+// blockchain payout.
+type Refund struct {
+	ID                   uuid.UUID     `json:"id"`
+	OrderID              uuid.UUID     `json:"orderId"`
+	AmountUSDC           money.Decimal `json:"amountUsdc"`
+	WalletAddress        string        `json:"walletAddress"`
+	Blockchain           string        `json:"blockchain"`
+	Reason               string        `json:"reason,omitempty"`
+	Status               RefundStatus  `json:"status"`
+	MuralPayoutRequestID uuid.UUID     `json:"muralPayoutRequestId,omitempty"`
+	MuralPayoutStatus    string        `json:"muralPayoutStatus,omitempty"`
+	Error                string        `json:"error,omitempty"`
+	RequestedBy          string        `json:"requestedBy"`
+	CreatedAt            time.Time     `json:"createdAt"`
+	UpdatedAt            time.Time     `json:"updatedAt"`
+}
+
+// Amount returns the refunded amount in USDC.
+func (r *Refund) Amount() money.Money {
+	return money.NewMoney(r.AmountUSDC, money.USDC)
+}
+
+type RefundStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewRefundStore(pool *pgxpool.Pool) *RefundStore {
+	return &RefundStore{pool: pool}
+}
+
+const refundColumns = `id, order_id, amount_usdc, wallet_address, blockchain, reason, status,
+		       mural_payout_request_id, mural_payout_status, error, requested_by, created_at, updated_at`
+
+// Create records a refund request. The order is locked while its refundable
+// amount is checked, so concurrent refunds can never return more than the
+// order received. On an order awaiting its payout, a refund of more than is
+// owed back comes out of the payout, and a refund of everything refundable
+// cancels the order.
+func (s *RefundStore) Create(ctx context.Context, r *Refund) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	r.Status = RefundRequested
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := lockOrderStatus(ctx, tx, r.OrderID); err != nil {
+			return err
+		}
+		order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM orders WHERE id=$1`, r.OrderID))
+		if err != nil {
+			return err
+		}
+		cancel, err := checkRefund(order, r.Amount())
+		if err != nil {
+			return err
+		}
+		if cancel {
+			if err := transitionTx(ctx, tx, order.ID, StatusCancelled, ActorAdmin,
+				fmt.Sprintf("refund of %s requested by %s", r.Amount(), r.RequestedBy)); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRow(ctx, `
+			INSERT INTO refunds (id, order_id, amount_usdc, wallet_address, blockchain, reason, status, requested_by)
+			VALUES ($1,$2,$3,$4,$5,NULLIF($6, ''),$7,$8)
+			RETURNING created_at, updated_at
+		`, r.ID, r.OrderID, r.AmountUSDC.Round(money.USDC.Scale()), r.WalletAddress, r.Blockchain, r.Reason,
+			string(r.Status), r.RequestedBy).Scan(&r.CreatedAt, &r.UpdatedAt)
+	})
+}
+
+// checkRefund checks a refund of amount against what its order has left to
+// refund. On an order awaiting its payout, a refund of more than is owed back
+// comes out of the payout: refunding everything cancels the order (in the
+// same transaction as the refund, so the payout workflow stops and the USDC
+// cannot be both refunded and paid out), while a partial refund reduces the
+// payout (see Order.PayoutUSDC). That is only possible until a payout request
+// for the old amount has been recorded (see OrderStore.RecordPayoutRequest).
+func checkRefund(order *Order, amount money.Money) (cancel bool, err error) {
+	refundable := order.Refundable()
+	vsRefundable, err := amount.Cmp(refundable)
+	if err != nil {
+		return false, err
+	}
+	if vsRefundable > 0 {
+		return false, fmt.Errorf("%w (%s)", ErrRefundExceedsRefundable, refundable)
+	}
+	_, owed := order.Balances()
+	vsOwed, err := amount.Cmp(owed)
+	if err != nil {
+		return false, err
+	}
+	if vsOwed <= 0 || !order.awaitingPayout() {
+		return false, nil
+	}
+	if vsRefundable == 0 {
+		return true, nil
+	}
+	if order.MuralPayoutRequestID != uuid.Nil {
+		return false, fmt.Errorf("%w (payout request %s); refund at most %s or everything", ErrPayoutRequested,
+			order.MuralPayoutRequestID, owed)
+	}
+	after := *order
+	after.RefundedUSDC = after.RefundedUSDC.Add(amount.Amount)
+	if after.PayoutUSDC().Amount.Sign() <= 0 {
+		return false, fmt.Errorf("%w; refund everything instead", ErrRefundLeavesNoPayout)
+	}
+	return false, nil
+}
+
+func (s *RefundStore) GetByID(ctx context.Context, id uuid.UUID) (*Refund, error) {
+	r, err := scanRefund(s.pool.QueryRow(ctx, `SELECT `+refundColumns+` FROM refunds WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefundNotFound
+	}
+	return r, err
+}
+
+// GetByPayoutRequestID returns the refund paid out by a Mural payout request.
+func (s *RefundStore) GetByPayoutRequestID(ctx context.Context, payoutRequestID uuid.UUID) (*Refund, error) {
+	r, err := scanRefund(s.pool.QueryRow(ctx, `
+		SELECT `+refundColumns+` FROM refunds WHERE mural_payout_request_id=$1
+	`, payoutRequestID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefundNotFound
+	}
+	return r, err
+}
+
+// ListByOrder returns an order's refunds, oldest first.
+func (s *RefundStore) ListByOrder(ctx context.Context, orderID uuid.UUID) ([]*Refund, error) {
+	return s.list(ctx, `
+		SELECT `+refundColumns+` FROM refunds WHERE order_id=$1 ORDER BY created_at
+	`, orderID)
+}
+
+// ListOpen returns the refunds that have not reached a final status, oldest
+// first.
+func (s *RefundStore) ListOpen(ctx context.Context) ([]*Refund, error) {
+	return s.list(ctx, `
+		SELECT `+refundColumns+` FROM refunds WHERE status IN ('requested', 'processing') ORDER BY created_at
+	`)
+}
+
+// SetPayout records the Mural payout request created for a refund.
+func (s *RefundStore) SetPayout(ctx context.Context, id, payoutRequestID uuid.UUID, payoutStatus string) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE refunds SET mural_payout_request_id=$2, mural_payout_status=$3, updated_at=NOW() WHERE id=$1
+	`, id, payoutRequestID, payoutStatus)
+	return err
+}
+
+// UpdateStatus records a refund's status and the latest status of its payout
+// request. A refund in a final status is not changed; updated reports
+// whether the refund was.
+func (s *RefundStore) UpdateStatus(ctx context.Context, id uuid.UUID, status RefundStatus, payoutStatus, errMsg string) (updated bool, err error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE refunds
+		SET status=$2,
+		    mural_payout_status=COALESCE(NULLIF($3, ''), mural_payout_status),
+		    error=NULLIF($4, ''),
+		    updated_at=NOW()
+		WHERE id=$1 AND status IN ('requested', 'processing')
+	`, id, string(status), payoutStatus, errMsg)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *RefundStore) list(ctx context.Context, query string, args ...any) ([]*Refund, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Refund
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func scanRefund(row pgx.Row) (*Refund, error) {
+	var (
+		r            Refund
+		reason       *string
+		status       string
+		payoutID     *uuid.UUID
+		payoutStatus *string
+		errMsg       *string
+	)
+	if err := row.Scan(&r.ID, &r.OrderID, &r.AmountUSDC, &r.WalletAddress, &r.Blockchain, &reason, &status,
+		&payoutID, &payoutStatus, &errMsg, &r.RequestedBy, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	r.Status = RefundStatus(status)
+	if reason != nil {
+		r.Reason = *reason
+	}
+	if payoutID != nil {
+		r.MuralPayoutRequestID = *payoutID
+	}
+	if payoutStatus != nil {
+		r.MuralPayoutStatus = *payoutStatus
+	}
+	if errMsg != nil {
+		r.Error = *errMsg
+	}
+	return &r, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+func refundOrder(status OrderStatus, received, refunded string) *Order {
+	return &Order{
+		Status:       status,
+		AmountUSDC:   money.MustParse("10.004321"),
+		FeeBreakdown: []FeeLine{{Kind: FeePlatform, AmountUSDC: money.MustParse("0.5")}},
+		ReceivedUSDC: money.MustParse(received),
+		RefundedUSDC: money.MustParse(refunded),
+	}
+}
+
+func TestCheckRefund(t *testing.T) {
+	requested := refundOrder(StatusPaid, "10.004321", "0")
+	requested.MuralPayoutRequestID = uuid.New()
+
+	tests := []struct {
+		name       string
+		order      *Order
+		amount     string
+		wantCancel bool
+		wantErr    error
+		wantPayout string
+	}{
+		{"paid: partial", refundOrder(StatusPaid, "10.004321", "0"), "3", false, nil, "6.504321"},
+		{"paid: full", refundOrder(StatusPaid, "10.004321", "0"), "10.004321", true, nil, ""},
+		{"paid: more than received", refundOrder(StatusPaid, "10.004321", "0"), "10.004322", false, ErrRefundExceedsRefundable, ""},
+		{"paid: partial leaving no payout", refundOrder(StatusPaid, "10.004321", "0"), "9.6", false, ErrRefundLeavesNoPayout, ""},
+		{"paid: rest after a partial refund", refundOrder(StatusPaid, "10.004321", "3"), "7.004321", true, nil, ""},
+		{"paid: second partial", refundOrder(StatusPaid, "10.004321", "3"), "1", false, nil, "5.504321"},
+		{"paid, payout requested: partial", requested, "3", false, ErrPayoutRequested, ""},
+		{"paid, payout requested: full", requested, "10.004321", true, nil, ""},
+		{"overpaid: the excess", refundOrder(StatusOverpaid, "12.004321", "0"), "2", false, nil, "9.504321"},
+		{"overpaid: the excess and an item", refundOrder(StatusOverpaid, "12.004321", "0"), "5", false, nil, "6.504321"},
+		{"overpaid: full", refundOrder(StatusOverpaid, "12.004321", "0"), "12.004321", true, nil, ""},
+		{"payout error: partial", refundOrder(StatusPayoutError, "10.004321", "0"), "1", false, nil, "8.504321"},
+		{"withdrawn: the excess", refundOrder(StatusWithdrawn, "12.004321", "0"), "2", false, nil, "9.504321"},
+		{"withdrawn: more than the excess", refundOrder(StatusWithdrawn, "12.004321", "0"), "2.000001", false, ErrRefundExceedsRefundable, ""},
+		{"withdrawn: nothing owed", refundOrder(StatusWithdrawn, "10.004321", "0"), "0.01", false, ErrRefundExceedsRefundable, ""},
+		{"awaiting payment", refundOrder(StatusUnderpaid, "5", "0"), "1", false, ErrRefundExceedsRefundable, ""},
+		{"expired: part of what was received", refundOrder(StatusExpired, "5", "0"), "2", false, nil, ""},
+		{"expired: everything received", refundOrder(StatusExpired, "5", "0"), "5", false, nil, ""},
+	}
+	for _, tt := range tests {
+		amount := money.NewMoney(money.MustParse(tt.amount), money.USDC)
+		cancel, err := checkRefund(tt.order, amount)
+		if cancel != tt.wantCancel || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: cancel %v, err %v; want %v, %v", tt.name, cancel, err, tt.wantCancel, tt.wantErr)
+			continue
+		}
+		if err != nil || tt.wantPayout == "" {
+			continue
+		}
+		after := *tt.order
+		after.RefundedUSDC = after.RefundedUSDC.Add(amount.Amount)
+		if got := after.PayoutUSDC().Amount; !got.Equal(money.MustParse(tt.wantPayout)) {
+			t.Errorf("%s: payout after the refund %s, want %s", tt.name, got, tt.wantPayout)
+		}
+	}
+}
+
+func TestCheckRefundCurrencyMismatch(t *testing.T) {
+	_, err := checkRefund(refundOrder(StatusPaid, "10.004321", "0"), money.NewMoney(money.NewFromInt(1), money.COP))
+	var mismatch *money.ErrCurrencyMismatch
+	if !errors.As(err, &mismatch) {
+		t.Errorf("err = %v, want a currency mismatch", err)
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Session is a signed-in user's login. The access and refresh tokens are
+// opaque random strings; only their hashes are stored, so a database leak
+// does not leak usable tokens.
+type Session struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"userId"`
+	AccessExpiresAt  time.Time  `json:"accessExpiresAt"`
+	RefreshExpiresAt time.Time  `json:"refreshExpiresAt"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// ErrSessionNotFound is returned when a token matches no live session: it is
+// unknown, expired or revoked.
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewSessionStore(pool *pgxpool.Pool) *SessionStore {
+	return &SessionStore{pool: pool}
+}
+
+const sessionColumns = `id, user_id, access_expires_at, refresh_expires_at, revoked_at, created_at, updated_at`
+
+// Create stores a new session identified by the given token hashes.
+func (s *SessionStore) Create(ctx context.Context, sess *Session, accessHash, refreshHash string) error {
+	if sess.ID == uuid.Nil {
+		sess.ID = uuid.New()
+	}
+	return s.pool.QueryRow(ctx, `
+		INSERT INTO sessions (id, user_id, access_token_hash, refresh_token_hash, access_expires_at, refresh_expires_at)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		RETURNING created_at, updated_at
+	`, sess.ID, sess.UserID, accessHash, refreshHash, sess.AccessExpiresAt, sess.RefreshExpiresAt).
+		Scan(&sess.CreatedAt, &sess.UpdatedAt)
+}
+
+// GetByAccessHash returns the live session for an access token hash together
+// with its user.
+func (s *SessionStore) GetByAccessHash(ctx context.Context, accessHash string) (*Session, *User, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT s.id, s.user_id, s.access_expires_at, s.refresh_expires_at, s.revoked_at, s.created_at, s.updated_at,
+		       u.id, u.username, u.password_hash, u.role, u.created_at, u.updated_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.access_token_hash=$1 AND s.revoked_at IS NULL AND s.access_expires_at > NOW()
+	`, accessHash)
+	var (
+		sess Session
+		u    User
+		role string
+	)
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.AccessExpiresAt, &sess.RefreshExpiresAt, &sess.RevokedAt,
+		&sess.CreatedAt, &sess.UpdatedAt,
+		&u.ID, &u.Username, &u.PasswordHash, &role, &u.CreatedAt, &u.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Role = Role(role)
+	return &sess, &u, nil
+}
+
+// Rotate replaces both tokens of the live session holding refreshHash. The
+// old refresh token stops working, so each one can be used only once.
+func (s *SessionStore) Rotate(ctx context.Context, refreshHash, newAccessHash, newRefreshHash string, accessExpiresAt, refreshExpiresAt time.Time) (*Session, error) {
+	row := s.pool.QueryRow(ctx, `
+		UPDATE sessions
+		SET access_token_hash=$2,
+		    refresh_token_hash=$3,
+		    access_expires_at=$4,
+		    refresh_expires_at=$5,
+		    updated_at=NOW()
+		WHERE refresh_token_hash=$1 AND revoked_at IS NULL AND refresh_expires_at > NOW()
+		RETURNING `+sessionColumns, refreshHash, newAccessHash, newRefreshHash, accessExpiresAt, refreshExpiresAt)
+	sess, err := scanSession(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	return sess, err
+}
+
+// Revoke ends a session. Revoking an already revoked session is a no-op.
+func (s *SessionStore) Revoke(ctx context.Context, id uuid.UUID) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at=NOW(), updated_at=NOW() WHERE id=$1 AND revoked_at IS NULL
+	`, id)
+	return err
+}
+
+// RevokeAllForUser ends every live session of a user.
+func (s *SessionStore) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at=NOW(), updated_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+func scanSession(row pgx.Row) (*Session, error) {
+	var sess Session
+	if err := row.Scan(&sess.ID, &sess.UserID, &sess.AccessExpiresAt, &sess.RefreshExpiresAt, &sess.RevokedAt,
+		&sess.CreatedAt, &sess.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	// Staff roles. What each may do is defined in internal/auth.
+	RoleSupport    Role = "support"
+	RoleFinance    Role = "finance"
+	RoleOperator   Role = "operator"
+	RoleSuperAdmin Role = "super_admin"
+)
+
+// Roles lists every valid role.
+var Roles = []Role{RoleCustomer, RoleSupport, RoleFinance, RoleOperator, RoleSuperAdmin}
+
+// Valid reports whether r is one of Roles.
+func (r Role) Valid() bool {
+	return slices.Contains(Roles, r)
+}
+
+// IsStaff reports whether r is a merchant-side role rather than a customer.
+func (r Role) IsStaff() bool {
+	return r.Valid() && r != RoleCustomer
+}
+
+// User is an account that can sign in. Usernames are stored lower-cased and
+// compared case-insensitively.
+type User struct {
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         Role      `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("username already taken")
+	ErrInvalidRole  = errors.New("invalid role")
+)
+
+const userUniqueConstraint = "users_username_key"
+
+type UserStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewUserStore(pool *pgxpool.Pool) *UserStore {
+	return &UserStore{pool: pool}
+}
+
+const userColumns = `id, username, password_hash, role, created_at, updated_at`
+
+// NormalizeUsername returns the form usernames are stored and looked up in.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func (s *UserStore) Create(ctx context.Context, u *User) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if !u.Role.Valid() {
+		return ErrInvalidRole
+	}
+	u.Username = NormalizeUsername(u.Username)
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO users (id, username, password_hash, role)
+		VALUES ($1,$2,$3,$4)
+		RETURNING created_at, updated_at
+	`, u.ID, u.Username, u.PasswordHash, string(u.Role)).Scan(&u.CreatedAt, &u.UpdatedAt)
+	if isUniqueViolation(err, userUniqueConstraint) {
+		return ErrUserExists
+	}
+	return err
+}
+
+func (s *UserStore) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id=$1`, id)
+	u, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return u, err
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE username=$1`, NormalizeUsername(username))
+	u, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return u, err
+}
+
+// List returns all users, oldest first.
+func (s *UserStore) List(ctx context.Context) ([]*User, error) {
+	rows, err := s.pool.Query(ctx, `SELECT `+userColumns+` FROM users ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// SetRole changes a user's role. Sessions read the role on every request, so
+// the change applies to signed-in users immediately.
+func (s *UserStore) SetRole(ctx context.Context, id uuid.UUID, role Role) (*User, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	row := s.pool.QueryRow(ctx, `
+		UPDATE users SET role=$2, updated_at=NOW() WHERE id=$1
+		RETURNING `+userColumns, id, string(role))
+	u, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return u, err
+}
+
+func scanUser(row pgx.Row) (*User, error) {
+	var (
+		u    User
+		role string
+	)
+	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &role, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	u.Role = Role(role)
+	return &u, nil
+}
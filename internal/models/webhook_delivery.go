@@ -0,0 +1,257 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting for their next attempt.
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "delivered"
+	// DeliveryFailed deliveries ran out of attempts; only a manual
+	// redelivery sends them again.
+	DeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one merchant webhook event to be sent to one endpoint:
+// an entry in the outbox while pending, and in the delivery log afterwards.
+// Payload is the exact body sent.
+type WebhookDelivery struct {
+	ID             uuid.UUID             `json:"id"`
+	WebhookID      uuid.UUID             `json:"webhookId"`
+	EventID        uuid.UUID             `json:"eventId"`
+	EventType      string                `json:"eventType"`
+	OrderID        *uuid.UUID            `json:"orderId,omitempty"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"nextAttemptAt"`
+	LockedUntil    *time.Time            `json:"lockedUntil,omitempty"`
+	LastStatusCode *int                  `json:"lastStatusCode,omitempty"`
+	LastError      string                `json:"lastError,omitempty"`
+	DeliveredAt    *time.Time            `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt"`
+}
+
+// WebhookDeliveryAttempt is one attempt to send a delivery. StatusCode is
+// unset if no response was received.
+type WebhookDeliveryAttempt struct {
+	ID          int64     `json:"id"`
+	DeliveryID  uuid.UUID `json:"deliveryId"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  *int      `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"durationMs"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+var (
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrWebhookDeliveryInFlight is returned when a delivery that is being
+	// sent is redelivered.
+	ErrWebhookDeliveryInFlight = errors.New("webhook delivery is being sent")
+)
+
+type WebhookDeliveryStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookDeliveryStore(pool *pgxpool.Pool) *WebhookDeliveryStore {
+	return &WebhookDeliveryStore{pool: pool}
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, order_id, payload, status, attempts, next_attempt_at,
+		       locked_until, last_status_code, last_error, delivered_at, created_at, updated_at`
+
+// ClaimDue locks up to limit pending deliveries to active webhooks whose next
+// attempt is due and whose lease (if any) has expired. Claimed deliveries are
+// leased for the given duration so concurrent workers, including other
+// replicas, skip them.
+func (s *WebhookDeliveryStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, `
+		UPDATE webhook_deliveries
+		SET locked_until = NOW() + make_interval(secs => $2),
+		    updated_at = NOW()
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN merchant_webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending'
+			  AND w.active
+			  AND d.next_attempt_at <= NOW()
+			  AND (d.locked_until IS NULL OR d.locked_until < NOW())
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+func (s *WebhookDeliveryStore) GetByID(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id=$1`, id)
+	d, err := scanWebhookDelivery(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return d, err
+}
+
+// ListByWebhook returns up to limit of a webhook's deliveries, newest first,
+// optionally only those in status.
+func (s *WebhookDeliveryStore) ListByWebhook(ctx context.Context, webhookID uuid.UUID, status WebhookDeliveryStatus, limit int) ([]*WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id=$1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, webhookID, string(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// ListAttempts returns a delivery's attempts, oldest first.
+func (s *WebhookDeliveryStore) ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]*WebhookDeliveryAttempt, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, delivery_id, attempt, status_code, error, duration_ms, attempted_at
+		FROM webhook_delivery_attempts WHERE delivery_id=$1 ORDER BY id
+	`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*WebhookDeliveryAttempt
+	for rows.Next() {
+		var (
+			a       WebhookDeliveryAttempt
+			errText *string
+		)
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &errText, &a.DurationMS, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		if errText != nil {
+			a.Error = *errText
+		}
+		out = append(out, &a)
+	}
+	return out, rows.Err()
+}
+
+// RecordAttempt logs an attempt to send a delivery and releases its lease.
+// The delivery moves to status; a pending delivery is retried at
+// nextAttemptAt.
+func (s *WebhookDeliveryStore) RecordAttempt(ctx context.Context, a *WebhookDeliveryAttempt, status WebhookDeliveryStatus, nextAttemptAt time.Time) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms)
+			VALUES ($1,$2,$3,NULLIF($4, ''),$5)
+			RETURNING id, attempted_at
+		`, a.DeliveryID, a.Attempt, a.StatusCode, a.Error, a.DurationMS).Scan(&a.ID, &a.AttemptedAt); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE webhook_deliveries
+			SET status=$2,
+			    attempts=$3,
+			    next_attempt_at=$4,
+			    locked_until=NULL,
+			    last_status_code=$5,
+			    last_error=NULLIF($6, ''),
+			    delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE delivered_at END,
+			    updated_at=NOW()
+			WHERE id=$1
+		`, a.DeliveryID, string(status), a.Attempt, nextAttemptAt, a.StatusCode, a.Error)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrWebhookDeliveryNotFound
+		}
+		return nil
+	})
+}
+
+// Redeliver puts a delivery back in the outbox with a fresh set of attempts,
+// whatever its status, and leases it to the caller for its first attempt.
+// It fails with ErrWebhookDeliveryInFlight while the delivery is being sent.
+func (s *WebhookDeliveryStore) Redeliver(ctx context.Context, id uuid.UUID, lease time.Duration) (*WebhookDelivery, error) {
+	row := s.pool.QueryRow(ctx, `
+		UPDATE webhook_deliveries
+		SET status='pending',
+		    attempts=0,
+		    next_attempt_at=NOW(),
+		    locked_until=NOW() + make_interval(secs => $2),
+		    updated_at=NOW()
+		WHERE id=$1 AND (locked_until IS NULL OR locked_until < NOW())
+		RETURNING `+webhookDeliveryColumns, id, lease.Seconds())
+	d, err := scanWebhookDelivery(row)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return d, err
+	}
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrWebhookDeliveryInFlight
+}
+
+func collectWebhookDeliveries(rows pgx.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+	var out []*WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func scanWebhookDelivery(row pgx.Row) (*WebhookDelivery, error) {
+	var (
+		d         WebhookDelivery
+		status    string
+		lastError *string
+	)
+	if err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.EventID,
+		&d.EventType,
+		&d.OrderID,
+		&d.Payload,
+		&status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LockedUntil,
+		&d.LastStatusCode,
+		&lastError,
+		&d.DeliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Status = WebhookDeliveryStatus(status)
+	if lastError != nil {
+		d.LastError = *lastError
+	}
+	return &d, nil
+}
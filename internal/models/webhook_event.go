@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WebhookEventStore records the IDs of processed Mural webhook events.
+type WebhookEventStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookEventStore(pool *pgxpool.Pool) *WebhookEventStore {
+	return &WebhookEventStore{pool: pool}
+}
+
+// Claim records an event, reporting false if it was already recorded.
+func (s *WebhookEventStore) Claim(ctx context.Context, eventID, category, payloadType string, occurredAt time.Time) (bool, error) {
+	var occurred *time.Time
+	if !occurredAt.IsZero() {
+		occurred = &occurredAt
+	}
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO webhook_events (event_id, event_category, payload_type, occurred_at)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventID, category, payloadType, occurred)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Release forgets a claimed event so it is processed again when redelivered.
+func (s *WebhookEventStore) Release(ctx context.Context, eventID string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM webhook_events WHERE event_id=$1`, eventID)
+	return err
+}
@@ -0,0 +1,273 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WorkflowStatus string
+
+const (
+	WorkflowRunning   WorkflowStatus = "running"
+	WorkflowCompleted WorkflowStatus = "completed"
+	WorkflowFailed    WorkflowStatus = "failed"
+)
+
+// WorkflowRun is a persisted, resumable pipeline for a single order. The
+// current step, attempt counter and next-run-at are stored so a restarted
+// process can pick up exactly where the previous one left off.
+type WorkflowRun struct {
+	ID          uuid.UUID      `json:"id"`
+	Kind        string         `json:"kind"`
+	OrderID     uuid.UUID      `json:"orderId"`
+	Step        string         `json:"step"`
+	Status      WorkflowStatus `json:"status"`
+	Attempts    int            `json:"attempts"`
+	NextRunAt   time.Time      `json:"nextRunAt"`
+	LockedUntil *time.Time     `json:"lockedUntil,omitempty"`
+	LeaseToken  uuid.UUID      `json:"-"` // set by ClaimDue; required to record the outcome
+	LastError   string         `json:"lastError,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+var (
+	// ErrWorkflowExists is returned by Create when a run of the same kind
+	// already exists for the order.
+	ErrWorkflowExists = errors.New("workflow already exists for order")
+	// ErrLeaseLost is returned by Advance, Retry and Finish when the run's
+	// lease expired and it was claimed again (or reopened) since it was
+	// claimed; the new holder records the outcome instead.
+	ErrLeaseLost = errors.New("workflow run lease lost")
+)
+
+type WorkflowStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewWorkflowStore(pool *pgxpool.Pool) *WorkflowStore {
+	return &WorkflowStore{pool: pool}
+}
+
+const workflowColumns = `id, kind, order_id, step, status, attempts, next_run_at, locked_until, lease_token, last_error,
+		created_at, updated_at`
+
+// Create persists a new run that is immediately due.
+func (s *WorkflowStore) Create(ctx context.Context, run *WorkflowRun) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return insertWorkflowRun(ctx, tx, run)
+	})
+}
+
+// insertWorkflowRun persists a new run that is immediately due within tx, so
+// OrderStore.Create can start an order's workflow together with the order.
+func insertWorkflowRun(ctx context.Context, tx pgx.Tx, run *WorkflowRun) error {
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+	if run.Status == "" {
+		run.Status = WorkflowRunning
+	}
+	err := tx.QueryRow(ctx, `
+		INSERT INTO workflow_runs (id, kind, order_id, step, status, next_run_at)
+		VALUES ($1,$2,$3,$4,$5,NOW())
+		ON CONFLICT (kind, order_id) DO NOTHING
+		RETURNING next_run_at, created_at, updated_at
+	`, run.ID, run.Kind, run.OrderID, run.Step, string(run.Status)).
+		Scan(&run.NextRunAt, &run.CreatedAt, &run.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWorkflowExists
+	}
+	return err
+}
+
+// ClaimDue locks up to limit running workflows whose next_run_at has passed
+// and whose lease (if any) has expired. Claimed runs are leased for the given
+// duration so concurrent workers, including other replicas, skip them, and
+// carry a new LeaseToken that recording their outcome requires.
+func (s *WorkflowStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*WorkflowRun, error) {
+	rows, err := s.pool.Query(ctx, `
+		UPDATE workflow_runs
+		SET locked_until = NOW() + make_interval(secs => $2),
+		    lease_token = $3,
+		    updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM workflow_runs
+			WHERE status = 'running'
+			  AND next_run_at <= NOW()
+			  AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY next_run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+workflowColumns,
+		limit, lease.Seconds(), uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*WorkflowRun
+	for rows.Next() {
+		run, err := scanWorkflowRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+// Advance records a successful step of a claimed run: it moves the run to
+// the given step, resets the attempt counter and schedules the next
+// execution.
+func (s *WorkflowStore) Advance(ctx context.Context, run *WorkflowRun, step string, nextRunAt time.Time) error {
+	return s.release(ctx, run, `
+		UPDATE workflow_runs
+		SET step=$3,
+		    attempts=0,
+		    next_run_at=$4,
+		    locked_until=NULL,
+		    lease_token=NULL,
+		    last_error=NULL,
+		    updated_at=NOW()
+		WHERE id=$1 AND lease_token=$2
+	`, step, nextRunAt)
+}
+
+// Retry records a failed attempt of a claimed run's current step and
+// schedules another.
+func (s *WorkflowStore) Retry(ctx context.Context, run *WorkflowRun, lastError string, nextRunAt time.Time) error {
+	return s.release(ctx, run, `
+		UPDATE workflow_runs
+		SET attempts=attempts+1,
+		    next_run_at=$4,
+		    locked_until=NULL,
+		    lease_token=NULL,
+		    last_error=$3,
+		    updated_at=NOW()
+		WHERE id=$1 AND lease_token=$2
+	`, lastError, nextRunAt)
+}
+
+// Finish moves a claimed run to a terminal status.
+func (s *WorkflowStore) Finish(ctx context.Context, run *WorkflowRun, status WorkflowStatus, lastError string) error {
+	return s.release(ctx, run, `
+		UPDATE workflow_runs
+		SET status=$3,
+		    locked_until=NULL,
+		    lease_token=NULL,
+		    last_error=NULLIF($4, ''),
+		    updated_at=NOW()
+		WHERE id=$1 AND lease_token=$2
+	`, string(status), lastError)
+}
+
+// release runs an update of a claimed run, given the run's ID and lease token
+// as $1 and $2, and returns ErrLeaseLost if the run no longer holds that
+// lease.
+func (s *WorkflowStore) release(ctx context.Context, run *WorkflowRun, query string, args ...any) error {
+	tag, err := s.pool.Exec(ctx, query, append([]any{run.ID, run.LeaseToken}, args...)...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ErrWorkflowRunning is returned by Reopen when the run has not finished.
+var ErrWorkflowRunning = errors.New("workflow is still running")
+
+// Reopen puts a finished run of kind for the order back to running at step,
+// due immediately. It returns pgx.ErrNoRows if the order has no such run.
+func (s *WorkflowStore) Reopen(ctx context.Context, kind string, orderID uuid.UUID, step string) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		var (
+			id     uuid.UUID
+			status string
+		)
+		if err := tx.QueryRow(ctx, `
+			SELECT id, status FROM workflow_runs WHERE kind=$1 AND order_id=$2 FOR UPDATE
+		`, kind, orderID).Scan(&id, &status); err != nil {
+			return err
+		}
+		if WorkflowStatus(status) == WorkflowRunning {
+			return ErrWorkflowRunning
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE workflow_runs
+			SET step=$2,
+			    status=$3,
+			    attempts=0,
+			    next_run_at=NOW(),
+			    locked_until=NULL,
+			    lease_token=NULL,
+			    last_error=NULL,
+			    updated_at=NOW()
+			WHERE id=$1
+		`, id, step, string(WorkflowRunning))
+		return err
+	})
+}
+
+// ListByOrder returns every workflow run recorded for an order.
+func (s *WorkflowStore) ListByOrder(ctx context.Context, orderID uuid.UUID) ([]*WorkflowRun, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+workflowColumns+`
+		FROM workflow_runs WHERE order_id=$1 ORDER BY created_at
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*WorkflowRun
+	for rows.Next() {
+		run, err := scanWorkflowRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func scanWorkflowRun(row pgx.Row) (*WorkflowRun, error) {
+	var (
+		run        WorkflowRun
+		status     string
+		leaseToken *uuid.UUID
+		lastError  *string
+	)
+	if err := row.Scan(
+		&run.ID,
+		&run.Kind,
+		&run.OrderID,
+		&run.Step,
+		&status,
+		&run.Attempts,
+		&run.NextRunAt,
+		&run.LockedUntil,
+		&leaseToken,
+		&lastError,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	run.Status = WorkflowStatus(status)
+	if leaseToken != nil {
+		run.LeaseToken = *leaseToken
+	}
+	if lastError != nil {
+		run.LastError = *lastError
+	}
+	return &run, nil
+}
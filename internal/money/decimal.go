@@ -0,0 +1,289 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Decimal is an exact, immutable base-10 number: coef * 10^exp. The zero
+// value is 0. Unlike float64 it represents NUMERIC(18,6) and NUMERIC(18,2)
+// values from Postgres and token amounts from Mural without rounding error.
+type Decimal struct {
+	coef *big.Int // nil means zero
+	exp  int32
+}
+
+var (
+	bigOne = big.NewInt(1)
+	bigTen = big.NewInt(10)
+)
+
+// New returns coef * 10^exp, e.g. New(125, -2) is 1.25.
+func New(coef int64, exp int32) Decimal {
+	return Decimal{coef: big.NewInt(coef), exp: exp}
+}
+
+// NewFromInt returns the integer v as a Decimal.
+func NewFromInt(v int64) Decimal {
+	return New(v, 0)
+}
+
+// Parse parses a decimal string such as "12", "-0.000001" or "1.5e-3".
+func Parse(s string) (Decimal, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("money: empty decimal")
+	}
+
+	var exp int64
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("money: invalid exponent in %q", orig)
+		}
+		exp = e
+		s = s[:i]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" || digits == "-" || digits == "+" {
+		return Decimal{}, fmt.Errorf("money: invalid decimal %q", orig)
+	}
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok || strings.ContainsAny(digits[1:], "+-") {
+		return Decimal{}, fmt.Errorf("money: invalid decimal %q", orig)
+	}
+	exp -= int64(len(fracPart))
+	if exp < -1<<31 || exp > 1<<31-1 {
+		return Decimal{}, fmt.Errorf("money: exponent out of range in %q", orig)
+	}
+	return Decimal{coef: coef, exp: int32(exp)}, nil
+}
+
+// MustParse is like Parse but panics on error. It is intended for constants.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// rescale returns the coefficient of d expressed with exponent exp, which must
+// not be greater than d.exp.
+func (d Decimal) rescale(exp int32) *big.Int {
+	c := new(big.Int).Set(d.int())
+	if d.exp > exp {
+		c.Mul(c, pow10(d.exp-exp))
+	}
+	return c
+}
+
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	exp := min(a.exp, b.exp)
+	return a.rescale(exp), b.rescale(exp), exp
+}
+
+// Add returns d + o.
+func (d Decimal) Add(o Decimal) Decimal {
+	x, y, exp := align(d, o)
+	return Decimal{coef: x.Add(x, y), exp: exp}
+}
+
+// Sub returns d - o.
+func (d Decimal) Sub(o Decimal) Decimal {
+	x, y, exp := align(d, o)
+	return Decimal{coef: x.Sub(x, y), exp: exp}
+}
+
+// Mul returns d * o.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), o.int()), exp: d.exp + o.exp}
+}
+
+// MulInt returns d * n.
+func (d Decimal) MulInt(n int64) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), big.NewInt(n)), exp: d.exp}
+}
+
+// Div returns d / o rounded half away from zero to places fractional digits.
+// It panics if o is zero.
+func (d Decimal) Div(o Decimal, places int32) Decimal {
+	if o.IsZero() {
+		panic("money: division by zero")
+	}
+	// Compute with one extra digit and let Round do the rounding.
+	num := d.rescale(min(d.exp, o.exp-places-1))
+	numExp := min(d.exp, o.exp-places-1)
+	q := new(big.Int).Quo(num, o.int())
+	return Decimal{coef: q, exp: numExp - o.exp}.Round(places)
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.int()), exp: d.exp}
+}
+
+// Abs returns |d|.
+func (d Decimal) Abs() Decimal {
+	return Decimal{coef: new(big.Int).Abs(d.int()), exp: d.exp}
+}
+
+// Round returns d rounded half away from zero to places fractional digits.
+func (d Decimal) Round(places int32) Decimal {
+	target := -places
+	if d.exp >= target {
+		return Decimal{coef: d.rescale(target), exp: target}
+	}
+	div := pow10(target - d.exp)
+	q, r := new(big.Int).QuoRem(d.int(), div, new(big.Int))
+	r.Abs(r).Lsh(r, 1)
+	if r.Cmp(div) >= 0 {
+		if d.Sign() < 0 {
+			q.Sub(q, bigOne)
+		} else {
+			q.Add(q, bigOne)
+		}
+	}
+	return Decimal{coef: q, exp: target}
+}
+
+// Truncate returns d with any digits beyond places fractional digits dropped.
+func (d Decimal) Truncate(places int32) Decimal {
+	target := -places
+	if d.exp >= target {
+		return Decimal{coef: d.rescale(target), exp: target}
+	}
+	q := new(big.Int).Quo(d.int(), pow10(target-d.exp))
+	return Decimal{coef: q, exp: target}
+}
+
+// Cmp returns -1, 0 or +1 depending on whether d is less than, equal to or
+// greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	x, y, _ := align(d, o)
+	return x.Cmp(y)
+}
+
+// Equal reports whether d and o are numerically equal regardless of scale.
+func (d Decimal) Equal(o Decimal) bool { return d.Cmp(o) == 0 }
+
+// LessThan reports whether d < o.
+func (d Decimal) LessThan(o Decimal) bool { return d.Cmp(o) < 0 }
+
+// GreaterThan reports whether d > o.
+func (d Decimal) GreaterThan(o Decimal) bool { return d.Cmp(o) > 0 }
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int { return d.int().Sign() }
+
+// IsZero reports whether d == 0.
+func (d Decimal) IsZero() bool { return d.Sign() == 0 }
+
+// Float64 returns the nearest float64. It is only meant for logging and
+// display; never use it for arithmetic on money.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String formats d in plain notation, keeping its scale ("1.500000").
+func (d Decimal) String() string {
+	c := d.int()
+	if d.exp >= 0 {
+		return new(big.Int).Mul(c, pow10(d.exp)).String()
+	}
+
+	digits := new(big.Int).Abs(c).String()
+	scale := int(-d.exp)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	point := len(digits) - scale
+	s := digits[:point] + "." + digits[point:]
+	if c.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// StringFixed formats d rounded to places fractional digits.
+func (d Decimal) StringFixed(places int32) string {
+	return d.Round(places).String()
+}
+
+// MarshalJSON encodes d as a JSON number so existing clients that expect
+// numeric amounts keep working.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, a quoted decimal string or null.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner so Decimal can be scanned
+// directly from NUMERIC columns. NULL scans as zero.
+func (d *Decimal) ScanNumeric(n pgtype.Numeric) error {
+	if !n.Valid {
+		*d = Decimal{}
+		return nil
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("money: cannot scan non-finite numeric")
+	}
+	*d = Decimal{coef: new(big.Int).Set(n.Int), exp: n.Exp}
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer.
+func (d Decimal) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: new(big.Int).Set(d.int()), Exp: d.exp, Valid: true}, nil
+}
+
+// Value implements driver.Valuer for contexts where pgx falls back to
+// database/sql semantics (e.g. untyped parameters).
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
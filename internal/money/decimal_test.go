@@ -0,0 +1,198 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"12", "12"},
+		{"-0.000001", "-0.000001"},
+		{"1.500000", "1.500000"},
+		{"  7.25 ", "7.25"},
+		{"+3.1", "3.1"},
+		{".5", "0.5"},
+		{"5.", "5"},
+		{"1.5e-3", "0.0015"},
+		{"1.5E2", "150"},
+		{"0", "0"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", " ", "-", "+", ".", "abc", "1.2.3", "1-2", "--1", "1e", "1ex", "0x10", "1e99999999999"} {
+		if d, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %s, want error", in, d)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int32
+		want   string
+	}{
+		{"1.005", 2, "1.01"},
+		{"1.004999", 2, "1.00"},
+		{"-1.005", 2, "-1.01"},
+		{"-1.004", 2, "-1.00"},
+		{"2.5", 0, "3"},
+		{"-2.5", 0, "-3"},
+		{"1.2", 4, "1.2000"},
+		{"125", -1, "130"},
+		{"0.0000005", 6, "0.000001"},
+		{"0", 2, "0.00"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).Round(tt.places); got.String() != tt.want {
+			t.Errorf("%s.Round(%d) = %s, want %s", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int32
+		want   string
+	}{
+		{"1.999", 2, "1.99"},
+		{"-1.999", 2, "-1.99"},
+		{"1.5", 3, "1.500"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).Truncate(tt.places); got.String() != tt.want {
+			t.Errorf("%s.Truncate(%d) = %s, want %s", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		places int32
+		want   string
+	}{
+		{"1", "3", 6, "0.333333"},
+		{"2", "3", 6, "0.666667"},
+		{"-2", "3", 2, "-0.67"},
+		{"10", "4", 1, "2.5"},
+		{"4000000", "4000.5", 2, "999.88"},
+		{"0.000001", "2", 6, "0.000001"},
+		{"1.50", "0.5", 0, "3"},
+		{"0", "7", 2, "0.00"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.a).Div(MustParse(tt.b), tt.places); got.String() != tt.want {
+			t.Errorf("%s / %s to %d places = %s, want %s", tt.a, tt.b, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestDivByZeroPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Div by zero did not panic")
+		}
+	}()
+	NewFromInt(1).Div(Decimal{}, 2)
+}
+
+func TestArithmeticAcrossScales(t *testing.T) {
+	a, b := MustParse("1.5"), MustParse("0.000001")
+	if got := a.Add(b).String(); got != "1.500001" {
+		t.Errorf("Add = %s", got)
+	}
+	if got := a.Sub(b).String(); got != "1.499999" {
+		t.Errorf("Sub = %s", got)
+	}
+	if got := a.Mul(b).String(); got != "0.0000015" {
+		t.Errorf("Mul = %s", got)
+	}
+	if got := a.MulInt(-3).String(); got != "-4.5" {
+		t.Errorf("MulInt = %s", got)
+	}
+	if got := (Decimal{}).Add(a).String(); got != "1.5" {
+		t.Errorf("zero value Add = %s", got)
+	}
+}
+
+func TestCmpAcrossScales(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.5", "1.500000", 0},
+		{"1.5", "1.500001", -1},
+		{"150", "1.5e2", 0},
+		{"-0.01", "0", -1},
+		{"0", "0.000000", 0},
+		{"10", "9.999999", 1},
+	}
+	for _, tt := range tests {
+		a, b := MustParse(tt.a), MustParse(tt.b)
+		if got := a.Cmp(b); got != tt.want {
+			t.Errorf("Cmp(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Cmp(a); got != -tt.want {
+			t.Errorf("Cmp(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+		if got := a.Equal(b); got != (tt.want == 0) {
+			t.Errorf("Equal(%s, %s) = %v", tt.a, tt.b, got)
+		}
+	}
+	if !(Decimal{}).Equal(MustParse("0.00")) {
+		t.Error("zero value is not equal to 0.00")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, in := range []string{"0", "12", "1.500000", "-0.000001", "123456789012345678.123456"} {
+		d := MustParse(in)
+		b, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("Marshal(%s): %v", in, err)
+		}
+		if string(b) != in {
+			t.Errorf("Marshal(%s) = %s", in, b)
+		}
+		var back Decimal
+		if err := json.Unmarshal(b, &back); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", b, err)
+		}
+		if back.String() != in {
+			t.Errorf("round trip of %s = %s", in, back)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var v struct {
+		Number, Quoted, Null Decimal
+	}
+	v.Null = MustParse("9")
+	if err := json.Unmarshal([]byte(`{"Number": 1.25, "Quoted": "0.000001", "Null": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Number.String() != "1.25" || v.Quoted.String() != "0.000001" || !v.Null.IsZero() {
+		t.Errorf("got %s, %s, %s", v.Number, v.Quoted, v.Null)
+	}
+	if err := json.Unmarshal([]byte(`{"Number": "one"}`), &v); err == nil {
+		t.Error("Unmarshal of a non-decimal string succeeded")
+	}
+}
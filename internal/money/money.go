@@ -0,0 +1,104 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is an ISO 4217 code or token symbol, always upper case.
+type Currency string
+
+const (
+	USDC Currency = "USDC"
+	USD  Currency = "USD"
+	COP  Currency = "COP"
+	MXN  Currency = "MXN"
+	BRL  Currency = "BRL"
+	ARS  Currency = "ARS"
+	EUR  Currency = "EUR"
+)
+
+// ParseCurrency normalizes a currency code such as "cop" or "usdc".
+func ParseCurrency(code string) Currency {
+	return Currency(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// Scale is the number of fractional digits amounts in c are stored with. It
+// matches the NUMERIC scale of the columns holding them.
+func (c Currency) Scale() int32 {
+	switch c {
+	case USDC:
+		return 6
+	default:
+		return 2
+	}
+}
+
+// Money is an exact amount of a specific currency.
+type Money struct {
+	Amount   Decimal  `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+// NewMoney returns amount in currency c, rounded to the currency's scale.
+func NewMoney(amount Decimal, c Currency) Money {
+	return Money{Amount: amount.Round(c.Scale()), Currency: c}
+}
+
+// Zero returns a zero amount of currency c.
+func Zero(c Currency) Money {
+	return NewMoney(Decimal{}, c)
+}
+
+// ErrCurrencyMismatch is returned when combining amounts of different currencies.
+type ErrCurrencyMismatch struct {
+	A, B Currency
+}
+
+func (e *ErrCurrencyMismatch) Error() string {
+	return fmt.Sprintf("money: currency mismatch %s vs %s", e.A, e.B)
+}
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, &ErrCurrencyMismatch{A: m.Currency, B: o.Currency}
+	}
+	return NewMoney(m.Amount.Add(o.Amount), m.Currency), nil
+}
+
+// Sub returns m - o. Both must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, &ErrCurrencyMismatch{A: m.Currency, B: o.Currency}
+	}
+	return NewMoney(m.Amount.Sub(o.Amount), m.Currency), nil
+}
+
+// MulInt returns m * n, e.g. a unit price times a quantity.
+func (m Money) MulInt(n int64) Money {
+	return NewMoney(m.Amount.MulInt(n), m.Currency)
+}
+
+// Convert converts m into currency to at rate (units of to per unit of m),
+// rounding to the target currency's scale.
+func (m Money) Convert(rate Decimal, to Currency) Money {
+	return NewMoney(m.Amount.Mul(rate), to)
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or
+// greater than o. Both must be in the same currency.
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, &ErrCurrencyMismatch{A: m.Currency, B: o.Currency}
+	}
+	return m.Amount.Cmp(o.Amount), nil
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool { return m.Amount.IsZero() }
+
+// String formats m as "12.50 COP".
+func (m Money) String() string {
+	return m.Amount.StringFixed(m.Currency.Scale()) + " " + string(m.Currency)
+}
@@ -0,0 +1,54 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewMoneyRoundsToScale(t *testing.T) {
+	if got := NewMoney(MustParse("1.0000005"), USDC).String(); got != "1.000001 USDC" {
+		t.Errorf("USDC: %s", got)
+	}
+	if got := NewMoney(MustParse("1999.995"), COP).String(); got != "2000.00 COP" {
+		t.Errorf("COP: %s", got)
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	usdc, cop := NewMoney(NewFromInt(1), USDC), NewMoney(NewFromInt(1), COP)
+	var mismatch *ErrCurrencyMismatch
+
+	if _, err := usdc.Add(cop); !errors.As(err, &mismatch) {
+		t.Errorf("Add: %v", err)
+	}
+	if _, err := usdc.Sub(cop); !errors.As(err, &mismatch) {
+		t.Errorf("Sub: %v", err)
+	}
+	if _, err := usdc.Cmp(cop); !errors.As(err, &mismatch) {
+		t.Errorf("Cmp: %v", err)
+	}
+}
+
+func TestCmp(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "1.000000", 0},
+		{"1.000001", "1", 1},
+		{"0.999999", "1", -1},
+	}
+	for _, tt := range tests {
+		got, err := NewMoney(MustParse(tt.a), USDC).Cmp(NewMoney(MustParse(tt.b), USDC))
+		if err != nil || got != tt.want {
+			t.Errorf("Cmp(%s, %s) = %d, %v; want %d", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	got := NewMoney(MustParse("10.5"), USDC).Convert(MustParse("4000.123"), COP)
+	if got.String() != "42001.29 COP" {
+		t.Errorf("Convert = %s", got)
+	}
+}
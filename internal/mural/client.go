@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
 )
 
 // Config holds configuration for the Mural API client.
@@ -19,12 +22,18 @@ type Config struct {
 	TransferKey    string
 	OrganizationID string
 	AccountID      string
+
+	// Timeout bounds each individual attempt; it defaults to 15s.
+	Timeout time.Duration
+	// Retry controls retries of failed calls; see RetryPolicy.
+	Retry RetryPolicy
 }
 
 // Client is a minimal typed client for the Mural API tailored to this app.
 type Client struct {
 	httpClient *http.Client
 	baseURL    *url.URL
+	retry      RetryPolicy
 
 	apiKey      string
 	transferKey string
@@ -47,11 +56,16 @@ func NewClient(cfg Config) (*Client, error) {
 		return nil, fmt.Errorf("invalid mural base url: %w", err)
 	}
 
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 15 * time.Second
+	}
+
 	return &Client{
 		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
+			Timeout: cfg.Timeout,
 		},
 		baseURL:        u,
+		retry:          cfg.Retry.withDefaults(),
 		apiKey:         cfg.APIKey,
 		transferKey:    cfg.TransferKey,
 		organizationID: cfg.OrganizationID,
@@ -72,6 +86,11 @@ func (c *Client) SetAccountID(accountID string) {
 	c.accountID = accountID
 }
 
+// AccountID returns the Account used for deposits and account-scoped searches.
+func (c *Client) AccountID() string {
+	return c.accountID
+}
+
 // ServiceError represents a MuralServiceException response.
 type ServiceError struct {
 	ErrorInstanceID string                 `json:"errorInstanceId"`
@@ -118,8 +137,8 @@ type AccountDetails struct {
 }
 
 type TokenBalance struct {
-	TokenAmount float64 `json:"tokenAmount"`
-	TokenSymbol string  `json:"tokenSymbol"`
+	TokenAmount money.Decimal `json:"tokenAmount"`
+	TokenSymbol string        `json:"tokenSymbol"`
 }
 
 type WalletDetails struct {
@@ -129,8 +148,29 @@ type WalletDetails struct {
 
 // TokenAmount is reused across several endpoints (amount + symbol).
 type TokenAmount struct {
-	TokenAmount float64 `json:"tokenAmount"`
-	TokenSymbol string  `json:"tokenSymbol"`
+	TokenAmount money.Decimal `json:"tokenAmount"`
+	TokenSymbol string        `json:"tokenSymbol"`
+}
+
+// NewTokenAmount converts m into the Mural amount + symbol representation.
+func NewTokenAmount(m money.Money) TokenAmount {
+	return TokenAmount{TokenAmount: m.Amount, TokenSymbol: string(m.Currency)}
+}
+
+// Money returns the amount in its token currency, rounded to that currency's scale.
+func (t TokenAmount) Money() money.Money {
+	return money.NewMoney(t.TokenAmount, money.ParseCurrency(t.TokenSymbol))
+}
+
+// FiatAmount is the amount + currency code pair used in fee and quote responses.
+type FiatAmount struct {
+	Amount       money.Decimal `json:"amount"`
+	CurrencyCode string        `json:"currencyCode"`
+}
+
+// Money returns the amount in its fiat currency, rounded to that currency's scale.
+func (f FiatAmount) Money() money.Money {
+	return money.NewMoney(f.Amount, money.ParseCurrency(f.CurrencyCode))
 }
 
 // Transaction represents a subset of the Transaction schema returned by the
@@ -141,6 +181,8 @@ type Transaction struct {
 	Memo string `json:"memo,omitempty"`
 	// Direction is typically "DEPOSIT" or "PAYOUT".
 	Direction string `json:"direction,omitempty"`
+	// Status is one of the TransactionStatus values.
+	Status string `json:"status,omitempty"`
 	// ExecutedAt is the time the transaction was executed/settled on-chain.
 	ExecutedAt time.Time `json:"executedAt,omitempty"`
 	// We only capture the token amount/symbol we care about; other fields are omitted.
@@ -155,13 +197,28 @@ type SearchTransactionsForAccountResponse struct {
 	Transactions []Transaction `json:"transactions"`
 }
 
+// Transaction statuses reported in Transaction.Status.
+const (
+	TransactionStatusPending   = "PENDING"
+	TransactionStatusCompleted = "COMPLETED"
+	TransactionStatusFailed    = "FAILED"
+)
+
+// Payin statuses reported in Payin.Status.
+const (
+	PayinStatusPending   = "PENDING"
+	PayinStatusCompleted = "COMPLETED"
+	PayinStatusFailed    = "FAILED"
+)
+
 // Payin represents a subset of the Payin schema (deposits into an Account).
 type Payin struct {
-	ID                   string    `json:"id"`
-	DestinationAccountID string    `json:"destinationAccountId"`
-	Status               string    `json:"payinStatus"`
-	CreatedAt            time.Time `json:"createdAt"`
-	UpdatedAt            time.Time `json:"updatedAt"`
+	ID                   string      `json:"id"`
+	DestinationAccountID string      `json:"destinationAccountId"`
+	Status               string      `json:"payinStatus"`
+	TokenAmount          TokenAmount `json:"tokenAmount"`
+	CreatedAt            time.Time   `json:"createdAt"`
+	UpdatedAt            time.Time   `json:"updatedAt"`
 }
 
 // SearchPayinsResponse is returned by POST /api/payins/search.
@@ -173,8 +230,9 @@ type SearchPayinsResponse struct {
 
 // Organization represents a subset of the Organization schema.
 type Organization struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status,omitempty"`
 }
 
 // SearchOrganizationsResponse is returned by POST /api/organizations/search.
@@ -186,40 +244,33 @@ type SearchOrganizationsResponse struct {
 
 // TokenToFiatQuoteRequest is a minimal request for /api/payouts/fees/token-to-fiat.
 type TokenToFiatQuoteRequest struct {
-	TokenFeeRequests []struct {
-		Amount struct {
-			TokenAmount float64 `json:"tokenAmount"`
-			TokenSymbol string  `json:"tokenSymbol"`
-		} `json:"amount"`
-		FiatAndRailCode string `json:"fiatAndRailCode"`
-	} `json:"tokenFeeRequests"`
+	TokenFeeRequests []TokenFeeRequest `json:"tokenFeeRequests"`
+}
+
+// TokenFeeRequest asks for the fees of converting one token amount to a fiat rail.
+type TokenFeeRequest struct {
+	Amount          TokenAmount `json:"amount"`
+	FiatAndRailCode string      `json:"fiatAndRailCode"`
 }
 
+// TokenToFiatQuoteResult is one entry of the token-to-fiat fees response. A
+// result of Type "error" carries only Message.
 type TokenToFiatQuoteResult struct {
-	EstimatedFiatAmount struct {
-		Amount       float64 `json:"amount"`
-		CurrencyCode string  `json:"currencyCode"`
-	} `json:"estimatedFiatAmount"`
+	Type                string        `json:"type"` // "success" or "error"
+	FiatAndRailCode     string        `json:"fiatAndRailCode"`
+	TokenAmount         TokenAmount   `json:"tokenAmount"`
+	ExchangeRate        money.Decimal `json:"exchangeRate"`
+	FeeTotal            *TokenAmount  `json:"feeTotal,omitempty"`
+	EstimatedFiatAmount FiatAmount    `json:"estimatedFiatAmount"`
+	Message             string        `json:"message,omitempty"`
 }
 
 // QuoteTokenToFiat calls the token-to-fiat fees endpoint and returns the result list.
-func (c *Client) QuoteTokenToFiat(ctx context.Context, tokenAmount float64, tokenSymbol, fiatAndRail string) ([]TokenToFiatQuoteResult, error) {
+func (c *Client) QuoteTokenToFiat(ctx context.Context, amount money.Money, fiatAndRail string) ([]TokenToFiatQuoteResult, error) {
 	req := TokenToFiatQuoteRequest{
-		TokenFeeRequests: []struct {
-			Amount struct {
-				TokenAmount float64 `json:"tokenAmount"`
-				TokenSymbol string  `json:"tokenSymbol"`
-			} `json:"amount"`
-			FiatAndRailCode string `json:"fiatAndRailCode"`
-		}{
+		TokenFeeRequests: []TokenFeeRequest{
 			{
-				Amount: struct {
-					TokenAmount float64 `json:"tokenAmount"`
-					TokenSymbol string  `json:"tokenSymbol"`
-				}{
-					TokenAmount: tokenAmount,
-					TokenSymbol: tokenSymbol,
-				},
+				Amount:          NewTokenAmount(amount),
 				FiatAndRailCode: fiatAndRail,
 			},
 		},
@@ -232,42 +283,49 @@ func (c *Client) QuoteTokenToFiat(ctx context.Context, tokenAmount float64, toke
 	return out, nil
 }
 
-// SearchTransactionsForAccount searches Transactions for the configured Account.
-// For this demo we rely on the default result ordering and do client-side filtering.
-func (c *Client) SearchTransactionsForAccount(ctx context.Context, limit int) (*SearchTransactionsForAccountResponse, error) {
-	// The OpenAPI spec defines limit/nextId as query parameters; for simplicity
-	// we rely on default server-side pagination here and just request the first page.
-	body := map[string]any{}
-	var out SearchTransactionsForAccountResponse
-	if err := c.do(ctx, http.MethodPost, "/api/transactions/search/account/"+c.accountID, nil, body, &out); err != nil {
-		return nil, err
-	}
-	return &out, nil
+// FiatToTokenQuoteRequest is a minimal request for /api/payouts/fees/fiat-to-token.
+type FiatToTokenQuoteRequest struct {
+	FiatFeeRequests []FiatFeeRequest `json:"fiatFeeRequests"`
 }
 
-// SearchPayins searches Payins associated with the current Organization.
-// For this demo we request the first page and perform client-side filtering.
-func (c *Client) SearchPayins(ctx context.Context, limit int) (*SearchPayinsResponse, error) {
-	body := map[string]any{} // no server-side filters for now
-	var out SearchPayinsResponse
-	if err := c.do(ctx, http.MethodPost, "/api/payins/search", nil, body, &out); err != nil {
-		return nil, err
-	}
-	return &out, nil
+// FiatFeeRequest asks what token amount must be paid out on a fiat rail for
+// the recipient to receive FiatAmount.
+type FiatFeeRequest struct {
+	FiatAmount      money.Decimal `json:"fiatAmount"`
+	TokenSymbol     string        `json:"tokenSymbol"`
+	FiatAndRailCode string        `json:"fiatAndRailCode"`
 }
 
-// SearchOrganizations searches Organizations visible to the current API key.
-// For this demo we request the first page and pick the first organization.
-func (c *Client) SearchOrganizations(ctx context.Context, nameFilter string) (*SearchOrganizationsResponse, error) {
-	body := map[string]any{}
-	if nameFilter != "" {
-		body["name"] = nameFilter
+// FiatToTokenQuoteResult is one entry of the fiat-to-token fees response. A
+// result of Type "error" carries only Message.
+type FiatToTokenQuoteResult struct {
+	Type                         string        `json:"type"` // "success" or "error"
+	FiatAndRailCode              string        `json:"fiatAndRailCode"`
+	FiatAmount                   FiatAmount    `json:"fiatAmount"`
+	ExchangeRate                 money.Decimal `json:"exchangeRate"`
+	FeeTotal                     *TokenAmount  `json:"feeTotal,omitempty"`
+	EstimatedTokenAmountRequired TokenAmount   `json:"estimatedTokenAmountRequired"`
+	Message                      string        `json:"message,omitempty"`
+}
+
+// QuoteFiatToToken calls the fiat-to-token fees endpoint, the inverse of
+// QuoteTokenToFiat: it returns the USDC needed for fiat to arrive on the rail.
+func (c *Client) QuoteFiatToToken(ctx context.Context, fiat money.Money, fiatAndRail string) ([]FiatToTokenQuoteResult, error) {
+	req := FiatToTokenQuoteRequest{
+		FiatFeeRequests: []FiatFeeRequest{
+			{
+				FiatAmount:      fiat.Amount,
+				TokenSymbol:     string(money.USDC),
+				FiatAndRailCode: fiatAndRail,
+			},
+		},
 	}
-	var out SearchOrganizationsResponse
-	if err := c.do(ctx, http.MethodPost, "/api/organizations/search", nil, body, &out); err != nil {
+
+	var out []FiatToTokenQuoteResult
+	if err := c.do(ctx, http.MethodPost, "/api/payouts/fees/fiat-to-token", nil, req, &out); err != nil {
 		return nil, err
 	}
-	return &out, nil
+	return out, nil
 }
 
 // CreatePayoutRequestRequest models NewPayoutRequestInput for a simple inline COP fiat payout.
@@ -277,30 +335,17 @@ type CreatePayoutRequestRequest struct {
 	Payouts         []PayoutInfoInput `json:"payouts"`
 }
 
-// PayoutInfoInput corresponds to the PayoutInfoInput schema for inline fiat payouts.
+// PayoutInfoInput corresponds to the PayoutInfoInput schema. A payout either
+// references a saved Counterparty payout method or carries inline details
+// (see payouts.go).
 type PayoutInfoInput struct {
-	Amount        TokenAmount           `json:"amount"`
-	PayoutDetails FiatPayoutDetails     `json:"payoutDetails"`
-	RecipientInfo BusinessRecipientInfo `json:"recipientInfo"`
-}
+	Amount TokenAmount `json:"amount"`
 
-// FiatPayoutDetails corresponds to the FiatPayoutDetails schema, specialized to CopDetails.
-type FiatPayoutDetails struct {
-	Type               string     `json:"type"` // "fiat"
-	BankName           string     `json:"bankName"`
-	BankAccountOwner   string     `json:"bankAccountOwner"`
-	FiatAndRailDetails CopDetails `json:"fiatAndRailDetails"`
-}
+	CounterpartyID string `json:"counterpartyId,omitempty"`
+	PayoutMethodID string `json:"payoutMethodId,omitempty"`
 
-// CopDetails corresponds to the CopDetails schema.
-type CopDetails struct {
-	Type              string `json:"type"` // "cop"
-	Symbol            string `json:"symbol"`
-	PhoneNumber       string `json:"phoneNumber"`
-	AccountType       string `json:"accountType"` // "CHECKING" or "SAVINGS"
-	BankAccountNumber string `json:"bankAccountNumber"`
-	DocumentNumber    string `json:"documentNumber"`
-	DocumentType      string `json:"documentType"`
+	PayoutDetails PayoutDetails `json:"payoutDetails,omitempty"`
+	RecipientInfo RecipientInfo `json:"recipientInfo,omitempty"`
 }
 
 // BusinessRecipientInfo corresponds to BusinessRecipientInfo schema.
@@ -339,6 +384,14 @@ func (c *Client) CreatePayoutRequest(ctx context.Context, req CreatePayoutReques
 	return &out, nil
 }
 
+// Exchange rate tolerance modes for ExecutePayoutRequest. FLEXIBLE executes
+// at the rate when the payout settles; STRICT fails the payout if the rate
+// has moved from the one quoted when it was created.
+const (
+	ExchangeRateFlexible = "FLEXIBLE"
+	ExchangeRateStrict   = "STRICT"
+)
+
 // ExecutePayoutRequest executes an existing payout request by ID.
 func (c *Client) ExecutePayoutRequest(ctx context.Context, payoutRequestID string, exchangeRateMode string) (*CreatePayoutRequestResponse, error) {
 	if c.transferKey == "" {
@@ -358,6 +411,16 @@ func (c *Client) ExecutePayoutRequest(ctx context.Context, payoutRequestID strin
 	return &out, nil
 }
 
+// Payout request statuses reported in PayoutRequest.Status. EXECUTED,
+// FAILED and CANCELED are final.
+const (
+	PayoutStatusAwaitingExecution = "AWAITING_EXECUTION"
+	PayoutStatusPending           = "PENDING"
+	PayoutStatusExecuted          = "EXECUTED"
+	PayoutStatusFailed            = "FAILED"
+	PayoutStatusCanceled          = "CANCELED"
+)
+
 // PayoutRequest represents a subset of the PayoutRequest schema.
 type PayoutRequest struct {
 	ID              string    `json:"id"`
@@ -449,26 +512,77 @@ func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
 
 // do is a small HTTP helper that encodes body as JSON and decodes JSON responses.
 func (c *Client) do(ctx context.Context, method, p string, headers map[string]string, body any, out any) error {
+	return c.doQuery(ctx, method, p, nil, headers, body, out)
+}
+
+// doQuery is do with query parameters appended to the request URL. Retryable
+// failures (see IsRetryable) are retried according to the client's
+// RetryPolicy, honoring Retry-After up to its MaxDelay. Mutating requests carry an idempotency
+// key that stays the same across those retries.
+func (c *Client) doQuery(ctx context.Context, method, p string, query url.Values, headers map[string]string, body any, out any) error {
 	u := *c.baseURL
 	u.Path = path.Join(u.Path, p)
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
 
-	var buf io.ReadWriter
+	var payload []byte
 	if body != nil {
-		buf = &bytes.Buffer{}
-		if err := json.NewEncoder(buf).Encode(body); err != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
 			return fmt.Errorf("encode request body: %w", err)
 		}
 	}
+	var idemKey string
+	if method != http.MethodGet && method != http.MethodHead {
+		idemKey = idempotencyKey(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		wait, err := c.attempt(ctx, method, u.String(), headers, payload, idemKey, out)
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.retry.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if wait > c.retry.MaxDelay {
+			log.Printf("mural %s %s failed and asked to retry in %s, longer than we wait; giving up: %v", method, p, wait.Round(time.Second), err)
+			return err
+		}
+		if backoff := c.retry.backoff(attempt); backoff > wait {
+			wait = backoff
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		log.Printf("mural %s %s failed (attempt %d/%d), retrying in %s: %v", method, p, attempt, c.retry.MaxAttempts, wait.Round(time.Millisecond), err)
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// attempt performs a single request. On failure it also returns how long the
+// server asked us to wait via Retry-After, if at all.
+func (c *Client) attempt(ctx context.Context, method, u string, headers map[string]string, payload []byte, idemKey string, out any) (time.Duration, error) {
+	var buf io.Reader
+	if payload != nil {
+		buf = bytes.NewReader(payload)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
+	req, err := http.NewRequestWithContext(ctx, method, u, buf)
 	if err != nil {
-		return fmt.Errorf("new request: %w", err)
+		return 0, fmt.Errorf("new request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Accept", "application/json")
-	if body != nil {
+	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if idemKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idemKey)
+	}
 	// Attach on-behalf-of by default when we have an org ID.
 	if c.organizationID != "" {
 		req.Header.Set("on-behalf-of", c.organizationID)
@@ -479,12 +593,16 @@ func (c *Client) do(ctx context.Context, method, p string, headers map[string]st
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("request failed: %w", err)
+		}
+		return 0, &networkError{err: err}
 	}
 	defer resp.Body.Close()
 
 	// Handle non-2xx as potential MuralServiceException.
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		wait := retryAfter(resp.Header.Get("Retry-After"))
 		var svcErr ServiceError
 		data, readErr := io.ReadAll(resp.Body)
 		if readErr == nil && len(data) > 0 {
@@ -492,19 +610,16 @@ func (c *Client) do(ctx context.Context, method, p string, headers map[string]st
 		}
 		if svcErr.Name != "" {
 			svcErr.StatusCode = resp.StatusCode
-			return &svcErr
-		}
-		if len(data) == 0 {
-			return fmt.Errorf("mural http %d with empty body", resp.StatusCode)
+			return wait, &svcErr
 		}
-		return fmt.Errorf("mural http %d: %s", resp.StatusCode, string(data))
+		return wait, &HTTPError{StatusCode: resp.StatusCode, Body: string(data)}
 	}
 
 	if out == nil {
-		return nil
+		return 0, nil
 	}
 	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
-		return fmt.Errorf("decode response: %w", err)
+		return 0, fmt.Errorf("decode response: %w", err)
 	}
-	return nil
+	return 0, nil
 }
@@ -0,0 +1,83 @@
+package mural
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Counterparty is a saved payout recipient.
+type Counterparty struct {
+	ID              string                `json:"id"`
+	Type            string                `json:"type"`
+	Name            string                `json:"name"`
+	Email           string                `json:"email"`
+	Status          string                `json:"status,omitempty"`
+	PhysicalAddress *PhysicalAddressInput `json:"physicalAddress,omitempty"`
+	CreatedAt       time.Time             `json:"createdAt"`
+	UpdatedAt       time.Time             `json:"updatedAt"`
+}
+
+// CreateCounterpartyRequest is the body for POST /api/counterparties.
+type CreateCounterpartyRequest struct {
+	Counterparty BusinessRecipientInfo `json:"counterparty"`
+}
+
+// PayoutMethod is a bank account (or other rail) saved on a Counterparty.
+type PayoutMethod struct {
+	ID             string            `json:"id"`
+	CounterpartyID string            `json:"counterpartyId"`
+	Alias          string            `json:"alias"`
+	Status         string            `json:"status,omitempty"`
+	PayoutDetails  FiatPayoutDetails `json:"payoutMethod"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+}
+
+// CreatePayoutMethodRequest is the body for
+// POST /api/counterparties/{counterpartyId}/payout-methods.
+type CreatePayoutMethodRequest struct {
+	Alias         string            `json:"alias"`
+	PayoutDetails FiatPayoutDetails `json:"payoutMethod"`
+}
+
+// CreateCounterparty registers a payout recipient.
+func (c *Client) CreateCounterparty(ctx context.Context, info BusinessRecipientInfo) (*Counterparty, error) {
+	var out Counterparty
+	if err := c.do(ctx, http.MethodPost, "/api/counterparties", nil, CreateCounterpartyRequest{Counterparty: info}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCounterparty fetches a Counterparty by ID.
+func (c *Client) GetCounterparty(ctx context.Context, id string) (*Counterparty, error) {
+	var out Counterparty
+	if err := c.do(ctx, http.MethodGet, "/api/counterparties/"+id, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePayoutMethod saves a payout method on a Counterparty.
+func (c *Client) CreatePayoutMethod(ctx context.Context, counterpartyID string, req CreatePayoutMethodRequest) (*PayoutMethod, error) {
+	var out PayoutMethod
+	if err := c.do(ctx, http.MethodPost, "/api/counterparties/"+counterpartyID+"/payout-methods", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPayoutMethod fetches one payout method of a Counterparty.
+func (c *Client) GetPayoutMethod(ctx context.Context, counterpartyID, payoutMethodID string) (*PayoutMethod, error) {
+	var out PayoutMethod
+	if err := c.do(ctx, http.MethodGet, "/api/counterparties/"+counterpartyID+"/payout-methods/"+payoutMethodID, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeletePayoutMethod removes a payout method from a Counterparty.
+func (c *Client) DeletePayoutMethod(ctx context.Context, counterpartyID, payoutMethodID string) error {
+	return c.do(ctx, http.MethodDelete, "/api/counterparties/"+counterpartyID+"/payout-methods/"+payoutMethodID, nil, nil, nil)
+}
@@ -0,0 +1,141 @@
+package mural
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PayoutDetails is the payoutDetails of an inline payout: a
+// *FiatPayoutDetails to a bank account or a *BlockchainPayoutDetails to a
+// wallet.
+type PayoutDetails interface {
+	Validate() error
+}
+
+// RecipientInfo is the recipientInfo of an inline payout: a
+// *BusinessRecipientInfo or an *IndividualRecipientInfo.
+type RecipientInfo interface {
+	RecipientType() string
+}
+
+func (*BusinessRecipientInfo) RecipientType() string { return "business" }
+
+// IndividualRecipientInfo corresponds to the IndividualRecipientInfo schema.
+type IndividualRecipientInfo struct {
+	Type            string                `json:"type"` // "individual"
+	FirstName       string                `json:"firstName"`
+	LastName        string                `json:"lastName"`
+	Email           string                `json:"email"`
+	PhysicalAddress *PhysicalAddressInput `json:"physicalAddress,omitempty"`
+}
+
+func (*IndividualRecipientInfo) RecipientType() string { return "individual" }
+
+// Blockchains USDC can be paid out on.
+const (
+	BlockchainEthereum = "ETHEREUM"
+	BlockchainPolygon  = "POLYGON"
+	BlockchainBase     = "BASE"
+	BlockchainCelo     = "CELO"
+)
+
+var evmAddress = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// BlockchainPayoutDetails corresponds to the BlockchainPayoutDetails schema:
+// tokens sent straight to a wallet.
+type BlockchainPayoutDetails struct {
+	Type          string        `json:"type"` // "blockchain"
+	WalletDetails WalletDetails `json:"walletDetails"`
+}
+
+// Validate checks the wallet address has the format of the blockchain's
+// addresses.
+func (d BlockchainPayoutDetails) Validate() error {
+	switch strings.ToUpper(d.WalletDetails.Blockchain) {
+	case BlockchainEthereum, BlockchainPolygon, BlockchainBase, BlockchainCelo:
+	case "":
+		return errors.New("walletDetails.blockchain is required")
+	default:
+		return fmt.Errorf("unsupported blockchain %q", d.WalletDetails.Blockchain)
+	}
+	if !evmAddress.MatchString(d.WalletDetails.WalletAddress) {
+		return fmt.Errorf("walletDetails.walletAddress must be a 0x-prefixed %s address", d.WalletDetails.Blockchain)
+	}
+	return nil
+}
+
+func (d BlockchainPayoutDetails) MarshalJSON() ([]byte, error) {
+	type plain BlockchainPayoutDetails
+	if d.Type == "" {
+		d.Type = "blockchain"
+	}
+	return json.Marshal(plain(d))
+}
+
+func (p *PayoutInfoInput) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Amount         TokenAmount     `json:"amount"`
+		CounterpartyID string          `json:"counterpartyId"`
+		PayoutMethodID string          `json:"payoutMethodId"`
+		PayoutDetails  json.RawMessage `json:"payoutDetails"`
+		RecipientInfo  json.RawMessage `json:"recipientInfo"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*p = PayoutInfoInput{Amount: raw.Amount, CounterpartyID: raw.CounterpartyID, PayoutMethodID: raw.PayoutMethodID}
+
+	if present(raw.PayoutDetails) {
+		switch typeOf(raw.PayoutDetails) {
+		case "fiat", "":
+			var d FiatPayoutDetails
+			if err := json.Unmarshal(raw.PayoutDetails, &d); err != nil {
+				return err
+			}
+			p.PayoutDetails = &d
+		case "blockchain":
+			var d BlockchainPayoutDetails
+			if err := json.Unmarshal(raw.PayoutDetails, &d); err != nil {
+				return err
+			}
+			p.PayoutDetails = &d
+		default:
+			return fmt.Errorf("unsupported payoutDetails type %q", typeOf(raw.PayoutDetails))
+		}
+	}
+	if present(raw.RecipientInfo) {
+		switch typeOf(raw.RecipientInfo) {
+		case "business":
+			var r BusinessRecipientInfo
+			if err := json.Unmarshal(raw.RecipientInfo, &r); err != nil {
+				return err
+			}
+			p.RecipientInfo = &r
+		case "individual":
+			var r IndividualRecipientInfo
+			if err := json.Unmarshal(raw.RecipientInfo, &r); err != nil {
+				return err
+			}
+			p.RecipientInfo = &r
+		default:
+			return fmt.Errorf("unsupported recipientInfo type %q", typeOf(raw.RecipientInfo))
+		}
+	}
+	return nil
+}
+
+func present(b json.RawMessage) bool {
+	return len(b) > 0 && string(b) != "null"
+}
+
+// typeOf returns the lower-cased "type" discriminator of a JSON object.
+func typeOf(b json.RawMessage) string {
+	var head struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(b, &head)
+	return strings.ToLower(head.Type)
+}
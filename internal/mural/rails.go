@@ -0,0 +1,382 @@
+package mural
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// FiatPayoutDetails corresponds to the FiatPayoutDetails schema. The
+// rail-specific part is one of the RailDetails implementations below.
+type FiatPayoutDetails struct {
+	Type               string      `json:"type"` // "fiat"
+	BankName           string      `json:"bankName"`
+	BankAccountOwner   string      `json:"bankAccountOwner"`
+	FiatAndRailDetails RailDetails `json:"fiatAndRailDetails"`
+}
+
+// Validate checks the fields Mural requires for the payout's rail.
+func (d FiatPayoutDetails) Validate() error {
+	switch {
+	case strings.TrimSpace(d.BankName) == "":
+		return errors.New("bankName is required")
+	case strings.TrimSpace(d.BankAccountOwner) == "":
+		return errors.New("bankAccountOwner is required")
+	case d.FiatAndRailDetails == nil:
+		return errors.New("fiatAndRailDetails is required")
+	}
+	return d.FiatAndRailDetails.Validate()
+}
+
+func (d FiatPayoutDetails) MarshalJSON() ([]byte, error) {
+	type plain FiatPayoutDetails
+	if d.Type == "" {
+		d.Type = "fiat"
+	}
+	return json.Marshal(plain(d))
+}
+
+func (d *FiatPayoutDetails) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Type               string          `json:"type"`
+		BankName           string          `json:"bankName"`
+		BankAccountOwner   string          `json:"bankAccountOwner"`
+		FiatAndRailDetails json.RawMessage `json:"fiatAndRailDetails"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*d = FiatPayoutDetails{Type: raw.Type, BankName: raw.BankName, BankAccountOwner: raw.BankAccountOwner}
+	if len(raw.FiatAndRailDetails) == 0 || string(raw.FiatAndRailDetails) == "null" {
+		return nil
+	}
+	details, err := DecodeRailDetails(raw.FiatAndRailDetails)
+	if err != nil {
+		return err
+	}
+	d.FiatAndRailDetails = details
+	return nil
+}
+
+// RailDetails is the fiatAndRailDetails of a fiat payout: the bank details
+// for one fiat currency and payment rail. Each implementation marshals with
+// its Rail as the "type" discriminator.
+type RailDetails interface {
+	// Rail is the fiat-and-rail code, used both as the JSON discriminator and
+	// for token-to-fiat quotes.
+	Rail() string
+	Currency() money.Currency
+	Validate() error
+}
+
+// Rail codes.
+const (
+	RailCOP = "cop"
+	RailMXN = "mxn"
+	RailBRL = "brl"
+	RailARS = "ars"
+	RailUSD = "usd"
+	RailEUR = "eur"
+)
+
+// Values shared by several rails.
+const (
+	AccountTypeChecking = "CHECKING"
+	AccountTypeSavings  = "SAVINGS"
+
+	TransferTypeACH  = "ACH"
+	TransferTypeWire = "WIRE"
+)
+
+var railDecoders = map[string]func(json.RawMessage) (RailDetails, error){
+	RailCOP: decodeRail[CopDetails],
+	RailMXN: decodeRail[MxnDetails],
+	RailBRL: decodeRail[BrlDetails],
+	RailARS: decodeRail[ArsDetails],
+	RailUSD: decodeRail[UsdDetails],
+	RailEUR: decodeRail[EurDetails],
+}
+
+// RailForCurrency returns the rail that pays out fiat currency c. Each
+// supported currency has a single rail, named after it.
+func RailForCurrency(c money.Currency) (string, bool) {
+	rail := strings.ToLower(string(c))
+	_, ok := railDecoders[rail]
+	return rail, ok
+}
+
+// DecodeRailDetails decodes fiatAndRailDetails into the type named by its
+// "type" discriminator.
+func DecodeRailDetails(b []byte) (RailDetails, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return nil, err
+	}
+	decode, ok := railDecoders[strings.ToLower(head.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported fiat rail %q", head.Type)
+	}
+	return decode(b)
+}
+
+func decodeRail[T RailDetails](b json.RawMessage) (RailDetails, error) {
+	var d T
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// marshalRail encodes fields (a method-less copy of d) with the type and
+// symbol Mural expects on every rail.
+func marshalRail(d RailDetails, fields any) ([]byte, error) {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	m["type"] = d.Rail()
+	m["symbol"] = string(d.Currency())
+	return json.Marshal(m)
+}
+
+// railError is a validation failure for one rail's details.
+func railError(rail, format string, args ...any) error {
+	return fmt.Errorf("%s payout details: "+format, append([]any{rail}, args...)...)
+}
+
+func requireFields(rail string, fields ...[2]string) error {
+	for _, f := range fields {
+		if strings.TrimSpace(f[1]) == "" {
+			return railError(rail, "%s is required", f[0])
+		}
+	}
+	return nil
+}
+
+func isDigits(s string, n int) bool {
+	if n > 0 && len(s) != n {
+		return false
+	}
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validAccountType(t string) bool {
+	return t == AccountTypeChecking || t == AccountTypeSavings
+}
+
+// CopDetails corresponds to the CopDetails schema (Colombian bank transfer).
+type CopDetails struct {
+	PhoneNumber       string `json:"phoneNumber"`
+	AccountType       string `json:"accountType"` // "CHECKING" or "SAVINGS"
+	BankAccountNumber string `json:"bankAccountNumber"`
+	DocumentNumber    string `json:"documentNumber"`
+	DocumentType      string `json:"documentType"`
+}
+
+func (CopDetails) Rail() string             { return RailCOP }
+func (CopDetails) Currency() money.Currency { return money.COP }
+
+func (d CopDetails) Validate() error {
+	if err := requireFields(RailCOP,
+		[2]string{"phoneNumber", d.PhoneNumber},
+		[2]string{"documentNumber", d.DocumentNumber},
+		[2]string{"documentType", d.DocumentType},
+	); err != nil {
+		return err
+	}
+	if !validAccountType(d.AccountType) {
+		return railError(RailCOP, "accountType must be CHECKING or SAVINGS")
+	}
+	if !isDigits(d.BankAccountNumber, 0) {
+		return railError(RailCOP, "bankAccountNumber must be numeric")
+	}
+	return nil
+}
+
+func (d CopDetails) MarshalJSON() ([]byte, error) {
+	type plain CopDetails
+	return marshalRail(d, plain(d))
+}
+
+// MxnDetails is a Mexican SPEI transfer to an 18-digit CLABE.
+type MxnDetails struct {
+	BankAccountNumber string `json:"bankAccountNumber"` // CLABE
+}
+
+func (MxnDetails) Rail() string             { return RailMXN }
+func (MxnDetails) Currency() money.Currency { return money.MXN }
+
+func (d MxnDetails) Validate() error {
+	if !isDigits(d.BankAccountNumber, 18) {
+		return railError(RailMXN, "bankAccountNumber must be an 18-digit CLABE")
+	}
+	return nil
+}
+
+func (d MxnDetails) MarshalJSON() ([]byte, error) {
+	type plain MxnDetails
+	return marshalRail(d, plain(d))
+}
+
+// PIX key types for BrlDetails.PixAccountType.
+const (
+	PixPhone       = "PHONE"
+	PixEmail       = "EMAIL"
+	PixDocument    = "DOCUMENT"
+	PixBankAccount = "BANK_ACCOUNT"
+)
+
+// BrlDetails is a Brazilian PIX transfer, either to a PIX key or, with
+// PixAccountType BANK_ACCOUNT, to a branch and account number.
+type BrlDetails struct {
+	PixAccountType    string `json:"pixAccountType"`
+	PixKey            string `json:"pixKey,omitempty"`
+	BranchCode        string `json:"branchCode,omitempty"`
+	BankAccountNumber string `json:"bankAccountNumber,omitempty"`
+	DocumentNumber    string `json:"documentNumber"` // CPF or CNPJ
+}
+
+func (BrlDetails) Rail() string             { return RailBRL }
+func (BrlDetails) Currency() money.Currency { return money.BRL }
+
+func (d BrlDetails) Validate() error {
+	if err := requireFields(RailBRL, [2]string{"documentNumber", d.DocumentNumber}); err != nil {
+		return err
+	}
+	switch d.PixAccountType {
+	case PixPhone, PixEmail, PixDocument:
+		return requireFields(RailBRL, [2]string{"pixKey", d.PixKey})
+	case PixBankAccount:
+		return requireFields(RailBRL,
+			[2]string{"branchCode", d.BranchCode},
+			[2]string{"bankAccountNumber", d.BankAccountNumber},
+		)
+	}
+	return railError(RailBRL, "pixAccountType must be PHONE, EMAIL, DOCUMENT or BANK_ACCOUNT")
+}
+
+func (d BrlDetails) MarshalJSON() ([]byte, error) {
+	type plain BrlDetails
+	return marshalRail(d, plain(d))
+}
+
+// ArsDetails is an Argentine transfer to a 22-digit CBU or CVU.
+type ArsDetails struct {
+	BankAccountNumber     string `json:"bankAccountNumber"`
+	BankAccountNumberType string `json:"bankAccountNumberType"` // "CBU" or "CVU"
+	DocumentNumber        string `json:"documentNumber"`        // CUIT/CUIL
+}
+
+func (ArsDetails) Rail() string             { return RailARS }
+func (ArsDetails) Currency() money.Currency { return money.ARS }
+
+func (d ArsDetails) Validate() error {
+	if d.BankAccountNumberType != "CBU" && d.BankAccountNumberType != "CVU" {
+		return railError(RailARS, "bankAccountNumberType must be CBU or CVU")
+	}
+	if !isDigits(d.BankAccountNumber, 22) {
+		return railError(RailARS, "bankAccountNumber must be a 22-digit %s", d.BankAccountNumberType)
+	}
+	return requireFields(RailARS, [2]string{"documentNumber", d.DocumentNumber})
+}
+
+func (d ArsDetails) MarshalJSON() ([]byte, error) {
+	type plain ArsDetails
+	return marshalRail(d, plain(d))
+}
+
+// UsdDetails is a US domestic transfer by ACH or wire.
+type UsdDetails struct {
+	TransferType      string `json:"transferType"` // "ACH" or "WIRE"
+	AccountType       string `json:"accountType"`
+	BankRoutingNumber string `json:"bankRoutingNumber"`
+	BankAccountNumber string `json:"bankAccountNumber"`
+}
+
+func (UsdDetails) Rail() string             { return RailUSD }
+func (UsdDetails) Currency() money.Currency { return money.USD }
+
+func (d UsdDetails) Validate() error {
+	if d.TransferType != TransferTypeACH && d.TransferType != TransferTypeWire {
+		return railError(RailUSD, "transferType must be ACH or WIRE")
+	}
+	if !validAccountType(d.AccountType) {
+		return railError(RailUSD, "accountType must be CHECKING or SAVINGS")
+	}
+	if !isDigits(d.BankRoutingNumber, 9) {
+		return railError(RailUSD, "bankRoutingNumber must be a 9-digit ABA routing number")
+	}
+	if !isDigits(d.BankAccountNumber, 0) {
+		return railError(RailUSD, "bankAccountNumber must be numeric")
+	}
+	return nil
+}
+
+func (d UsdDetails) MarshalJSON() ([]byte, error) {
+	type plain UsdDetails
+	return marshalRail(d, plain(d))
+}
+
+// EurDetails is a SEPA transfer to an IBAN.
+type EurDetails struct {
+	IBAN     string `json:"iban"`
+	SwiftBIC string `json:"swiftBic,omitempty"`
+	Country  string `json:"country"`
+}
+
+func (EurDetails) Rail() string             { return RailEUR }
+func (EurDetails) Currency() money.Currency { return money.EUR }
+
+func (d EurDetails) Validate() error {
+	iban := strings.ReplaceAll(d.IBAN, " ", "")
+	if len(iban) < 15 || len(iban) > 34 || !isAlnum(iban) || !isLetters(iban[:2]) {
+		return railError(RailEUR, "iban is not a valid IBAN")
+	}
+	if d.SwiftBIC != "" && (len(d.SwiftBIC) != 8 && len(d.SwiftBIC) != 11 || !isAlnum(d.SwiftBIC)) {
+		return railError(RailEUR, "swiftBic must have 8 or 11 characters")
+	}
+	if len(d.Country) != 2 || !isLetters(d.Country) {
+		return railError(RailEUR, "country must be a 2-letter ISO code")
+	}
+	return nil
+}
+
+func (d EurDetails) MarshalJSON() ([]byte, error) {
+	type plain EurDetails
+	return marshalRail(d, plain(d))
+}
+
+func isAlnum(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package mural
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+func TestRailValidate(t *testing.T) {
+	validCOP := CopDetails{PhoneNumber: "+573001234567", AccountType: AccountTypeSavings,
+		BankAccountNumber: "1234567890", DocumentNumber: "1020304050", DocumentType: "NATIONAL_ID"}
+	validUSD := UsdDetails{TransferType: TransferTypeACH, AccountType: AccountTypeChecking,
+		BankRoutingNumber: "021000021", BankAccountNumber: "000123456789"}
+
+	tests := []struct {
+		name    string
+		details RailDetails
+		wantErr string // substring; empty for valid details
+	}{
+		{"cop", validCOP, ""},
+		{"cop: missing phone", func() CopDetails { d := validCOP; d.PhoneNumber = " "; return d }(), "phoneNumber is required"},
+		{"cop: bad account type", func() CopDetails { d := validCOP; d.AccountType = "BROKERAGE"; return d }(), "accountType"},
+		{"cop: non-numeric account", func() CopDetails { d := validCOP; d.BankAccountNumber = "12-34"; return d }(), "bankAccountNumber"},
+
+		{"mxn", MxnDetails{BankAccountNumber: "012180001234567897"}, ""},
+		{"mxn: short clabe", MxnDetails{BankAccountNumber: "01218000123456789"}, "18-digit CLABE"},
+		{"mxn: letters", MxnDetails{BankAccountNumber: "01218000123456789X"}, "18-digit CLABE"},
+
+		{"brl: pix key", BrlDetails{PixAccountType: PixEmail, PixKey: "a@b.br", DocumentNumber: "12345678909"}, ""},
+		{"brl: pix without key", BrlDetails{PixAccountType: PixPhone, DocumentNumber: "12345678909"}, "pixKey is required"},
+		{"brl: bank account", BrlDetails{PixAccountType: PixBankAccount, BranchCode: "0001",
+			BankAccountNumber: "123456", DocumentNumber: "12345678909"}, ""},
+		{"brl: bank account without branch", BrlDetails{PixAccountType: PixBankAccount,
+			BankAccountNumber: "123456", DocumentNumber: "12345678909"}, "branchCode is required"},
+		{"brl: unknown pix type", BrlDetails{PixAccountType: "CARRIER_PIGEON", DocumentNumber: "12345678909"}, "pixAccountType"},
+		{"brl: missing document", BrlDetails{PixAccountType: PixEmail, PixKey: "a@b.br"}, "documentNumber is required"},
+
+		{"ars", ArsDetails{BankAccountNumber: strings.Repeat("1", 22), BankAccountNumberType: "CVU",
+			DocumentNumber: "20123456789"}, ""},
+		{"ars: bad number type", ArsDetails{BankAccountNumber: strings.Repeat("1", 22), BankAccountNumberType: "IBAN",
+			DocumentNumber: "20123456789"}, "CBU or CVU"},
+		{"ars: short cbu", ArsDetails{BankAccountNumber: strings.Repeat("1", 21), BankAccountNumberType: "CBU",
+			DocumentNumber: "20123456789"}, "22-digit CBU"},
+		{"ars: missing document", ArsDetails{BankAccountNumber: strings.Repeat("1", 22), BankAccountNumberType: "CBU"}, "documentNumber is required"},
+
+		{"usd", validUSD, ""},
+		{"usd: wire", func() UsdDetails { d := validUSD; d.TransferType = TransferTypeWire; return d }(), ""},
+		{"usd: bad transfer type", func() UsdDetails { d := validUSD; d.TransferType = "CHECK"; return d }(), "transferType"},
+		{"usd: short routing number", func() UsdDetails { d := validUSD; d.BankRoutingNumber = "02100002"; return d }(), "routing number"},
+		{"usd: non-numeric account", func() UsdDetails { d := validUSD; d.BankAccountNumber = ""; return d }(), "bankAccountNumber"},
+
+		{"eur", EurDetails{IBAN: "DE89 3704 0044 0532 0130 00", SwiftBIC: "COBADEFFXXX", Country: "DE"}, ""},
+		{"eur: no bic", EurDetails{IBAN: "DE89370400440532013000", Country: "DE"}, ""},
+		{"eur: short iban", EurDetails{IBAN: "DE89370400", Country: "DE"}, "iban"},
+		{"eur: iban without country prefix", EurDetails{IBAN: "1289370400440532013000", Country: "DE"}, "iban"},
+		{"eur: bad bic", EurDetails{IBAN: "DE89370400440532013000", SwiftBIC: "COBADEF", Country: "DE"}, "swiftBic"},
+		{"eur: bad country", EurDetails{IBAN: "DE89370400440532013000", Country: "DEU"}, "country"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.details.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("Validate() = nil, want error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFiatPayoutDetailsValidate(t *testing.T) {
+	valid := FiatPayoutDetails{BankName: "BBVA", BankAccountOwner: "Ana", FiatAndRailDetails: MxnDetails{BankAccountNumber: "012180001234567897"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	noOwner := valid
+	noOwner.BankAccountOwner = ""
+	noRail := valid
+	noRail.FiatAndRailDetails = nil
+	badRail := valid
+	badRail.FiatAndRailDetails = MxnDetails{BankAccountNumber: "123"}
+	for name, d := range map[string]FiatPayoutDetails{"no owner": noOwner, "no rail": noRail, "bad rail": badRail} {
+		if err := d.Validate(); err == nil {
+			t.Errorf("%s: Validate() = nil, want error", name)
+		}
+	}
+}
+
+func TestRailForCurrency(t *testing.T) {
+	for _, c := range []money.Currency{money.COP, money.MXN, money.BRL, money.ARS, money.USD, money.EUR} {
+		rail, ok := RailForCurrency(c)
+		if !ok || rail != strings.ToLower(string(c)) {
+			t.Errorf("RailForCurrency(%s) = %q, %v", c, rail, ok)
+		}
+	}
+	if _, ok := RailForCurrency(money.USDC); ok {
+		t.Error("RailForCurrency(USDC) is supported")
+	}
+}
+
+func TestFiatPayoutDetailsRoundTrip(t *testing.T) {
+	in := FiatPayoutDetails{BankName: "Itaú", BankAccountOwner: "João", FiatAndRailDetails: BrlDetails{
+		PixAccountType: PixEmail, PixKey: "joao@example.com", DocumentNumber: "12345678909"}}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire struct {
+		Type    string         `json:"type"`
+		Details map[string]any `json:"fiatAndRailDetails"`
+	}
+	if err := json.Unmarshal(b, &wire); err != nil {
+		t.Fatal(err)
+	}
+	if wire.Type != "fiat" || wire.Details["type"] != RailBRL || wire.Details["symbol"] != "BRL" {
+		t.Errorf("marshalled as %s", b)
+	}
+
+	var out FiatPayoutDetails
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := out.FiatAndRailDetails.(BrlDetails); !ok || got != in.FiatAndRailDetails {
+		t.Errorf("round trip = %#v, want %#v", out.FiatAndRailDetails, in.FiatAndRailDetails)
+	}
+}
+
+func TestDecodeRailDetailsUnsupported(t *testing.T) {
+	if _, err := DecodeRailDetails([]byte(`{"type":"gbp"}`)); err == nil {
+		t.Error("DecodeRailDetails(gbp) = nil error")
+	}
+}
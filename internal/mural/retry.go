@@ -0,0 +1,164 @@
+package mural
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RetryPolicy controls how Client retries failed requests. Zero fields take
+// the defaults from DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per call; 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry. It doubles for every
+	// further attempt, up to MaxDelay, and is jittered by up to ±50%.
+	BaseDelay time.Duration
+	// MaxDelay also bounds Retry-After: a call asked to wait longer fails
+	// instead, leaving the retry to the caller.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used for any zero field of Config.Retry.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return p
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d/2 + rand.N(d)
+}
+
+// HTTPError is returned for non-2xx responses whose body is not a
+// MuralServiceException.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return "mural http " + strconv.Itoa(e.StatusCode) + " with empty body"
+	}
+	return "mural http " + strconv.Itoa(e.StatusCode) + ": " + e.Body
+}
+
+// networkError wraps transport failures, which are always worth retrying.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string { return "request failed: " + e.err.Error() }
+func (e *networkError) Unwrap() error { return e.err }
+
+// StatusCode returns the HTTP status of a failed Mural call, or 0 if err did
+// not come from a Mural response.
+func StatusCode(err error) int {
+	var svcErr *ServiceError
+	if errors.As(err, &svcErr) {
+		return svcErr.StatusCode
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+	return 0
+}
+
+// IsRetryable reports whether a failed call may succeed if repeated: network
+// errors, timeouts, rate limiting and 5xx responses. Other 4xx responses are
+// terminal and callers should not retry them.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr *networkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return retryableStatus(StatusCode(err))
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// A date in the past means no wait.
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+type idempotencyKeyCtx struct{}
+
+// IdempotencyKeyHeader carries the idempotency key on mutating requests.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey returns a context whose mutating Mural calls carry key.
+// Callers that may repeat an operation across process restarts or workflow
+// retries should derive key from their own state (e.g. the order ID) so Mural
+// treats every repetition as the same request.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// idempotencyKey returns the key set with WithIdempotencyKey, or a fresh one
+// so that at least the retries of a single call are deduplicated.
+func idempotencyKey(ctx context.Context) string {
+	if key, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok && key != "" {
+		return key
+	}
+	return uuid.NewString()
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,294 @@
+package mural
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPageSize is the page size the iterators request when walking a search.
+const DefaultPageSize = 100
+
+// ErrRepeatedCursor is yielded by the search iterators when the server hands
+// back a nextId it has already returned, which would otherwise loop forever.
+var ErrRepeatedCursor = errors.New("mural: search returned a nextId it already returned")
+
+// Transaction directions reported in Transaction.Direction.
+const (
+	DirectionDeposit = "DEPOSIT"
+	DirectionPayout  = "PAYOUT"
+)
+
+// Page selects one page of a search. The zero value requests the first page
+// at the server's default size.
+type Page struct {
+	Limit  int
+	NextID string
+}
+
+func (p Page) query() url.Values {
+	q := url.Values{}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.NextID != "" {
+		q.Set("nextId", p.NextID)
+	}
+	return q
+}
+
+// TimeRange bounds a search by time. From is inclusive, To is exclusive, and
+// a zero bound is open.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t falls within the range. A zero t (the server did
+// not report a time) is always contained.
+func (r TimeRange) Contains(t time.Time) bool {
+	if t.IsZero() {
+		return true
+	}
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && !t.Before(r.To) {
+		return false
+	}
+	return true
+}
+
+func (r TimeRange) addTo(f map[string]any) {
+	if !r.From.IsZero() {
+		f["startDate"] = r.From.UTC()
+	}
+	if !r.To.IsZero() {
+		f["endDate"] = r.To.UTC()
+	}
+}
+
+// TransactionFilter narrows a transactions search. Zero fields do not filter.
+type TransactionFilter struct {
+	// Executed bounds Transaction.ExecutedAt.
+	Executed TimeRange
+	// Direction is DirectionDeposit or DirectionPayout.
+	Direction string
+	// Status is one of the TransactionStatus values.
+	Status      string
+	TokenSymbol string
+}
+
+func (f TransactionFilter) body() map[string]any {
+	filter := map[string]any{}
+	f.Executed.addTo(filter)
+	if f.Direction != "" {
+		filter["direction"] = f.Direction
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.TokenSymbol != "" {
+		filter["tokenSymbol"] = f.TokenSymbol
+	}
+	return map[string]any{"filter": filter}
+}
+
+// Matches reports whether tx satisfies the filter.
+func (f TransactionFilter) Matches(tx Transaction) bool {
+	if !f.Executed.Contains(tx.ExecutedAt) {
+		return false
+	}
+	if f.Direction != "" && tx.Direction != "" && !strings.EqualFold(tx.Direction, f.Direction) {
+		return false
+	}
+	if f.Status != "" && tx.Status != "" && !strings.EqualFold(tx.Status, f.Status) {
+		return false
+	}
+	if f.TokenSymbol != "" && !strings.EqualFold(tx.TokenAmount.TokenSymbol, f.TokenSymbol) {
+		return false
+	}
+	return true
+}
+
+// PayinFilter narrows a payins search. Zero fields do not filter.
+type PayinFilter struct {
+	// Created bounds Payin.CreatedAt.
+	Created              TimeRange
+	DestinationAccountID string
+	// Statuses keeps payins in any of the given PayinStatus values.
+	Statuses    []string
+	TokenSymbol string
+}
+
+func (f PayinFilter) body() map[string]any {
+	filter := map[string]any{}
+	f.Created.addTo(filter)
+	if f.DestinationAccountID != "" {
+		filter["destinationAccountIds"] = []string{f.DestinationAccountID}
+	}
+	if len(f.Statuses) > 0 {
+		filter["statuses"] = f.Statuses
+	}
+	if f.TokenSymbol != "" {
+		filter["tokenSymbol"] = f.TokenSymbol
+	}
+	return map[string]any{"filter": filter}
+}
+
+// Matches reports whether p satisfies the filter.
+func (f PayinFilter) Matches(p Payin) bool {
+	if !f.Created.Contains(p.CreatedAt) {
+		return false
+	}
+	if f.DestinationAccountID != "" && p.DestinationAccountID != f.DestinationAccountID {
+		return false
+	}
+	if len(f.Statuses) > 0 {
+		ok := false
+		for _, s := range f.Statuses {
+			if strings.EqualFold(p.Status, s) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.TokenSymbol != "" && !strings.EqualFold(p.TokenAmount.TokenSymbol, f.TokenSymbol) {
+		return false
+	}
+	return true
+}
+
+// OrganizationFilter narrows an organizations search. Zero fields do not filter.
+type OrganizationFilter struct {
+	// Name matches organizations whose name contains it, ignoring case.
+	Name   string
+	Status string
+}
+
+func (f OrganizationFilter) body() map[string]any {
+	filter := map[string]any{}
+	if f.Name != "" {
+		filter["name"] = f.Name
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	return map[string]any{"filter": filter}
+}
+
+// Matches reports whether o satisfies the filter.
+func (f OrganizationFilter) Matches(o Organization) bool {
+	if f.Name != "" && !strings.Contains(strings.ToLower(o.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+	if f.Status != "" && o.Status != "" && !strings.EqualFold(o.Status, f.Status) {
+		return false
+	}
+	return true
+}
+
+// SearchTransactionsForAccount returns one page of Transactions for the
+// configured Account.
+func (c *Client) SearchTransactionsForAccount(ctx context.Context, filter TransactionFilter, page Page) (*SearchTransactionsForAccountResponse, error) {
+	var out SearchTransactionsForAccountResponse
+	if err := c.doQuery(ctx, http.MethodPost, "/api/transactions/search/account/"+c.accountID, page.query(), nil, filter.body(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchPayins returns one page of Payins for the current Organization.
+func (c *Client) SearchPayins(ctx context.Context, filter PayinFilter, page Page) (*SearchPayinsResponse, error) {
+	var out SearchPayinsResponse
+	if err := c.doQuery(ctx, http.MethodPost, "/api/payins/search", page.query(), nil, filter.body(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchOrganizations returns one page of Organizations visible to the API key.
+func (c *Client) SearchOrganizations(ctx context.Context, filter OrganizationFilter, page Page) (*SearchOrganizationsResponse, error) {
+	var out SearchOrganizationsResponse
+	if err := c.doQuery(ctx, http.MethodPost, "/api/organizations/search", page.query(), nil, filter.body(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Transactions walks every page of a transactions search. Items are re-checked
+// against the filter, so fields the server does not support still apply.
+// Iteration stops at the first error, which is yielded with a zero item.
+func (c *Client) Transactions(ctx context.Context, filter TransactionFilter) iter.Seq2[Transaction, error] {
+	return paginate(func(page Page) ([]Transaction, *string, error) {
+		resp, err := c.SearchTransactionsForAccount(ctx, filter, page)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.Transactions, resp.NextID, nil
+	}, filter.Matches)
+}
+
+// Payins walks every page of a payins search; see Transactions.
+func (c *Client) Payins(ctx context.Context, filter PayinFilter) iter.Seq2[Payin, error] {
+	return paginate(func(page Page) ([]Payin, *string, error) {
+		resp, err := c.SearchPayins(ctx, filter, page)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.Payins, resp.NextID, nil
+	}, filter.Matches)
+}
+
+// Organizations walks every page of an organizations search; see Transactions.
+func (c *Client) Organizations(ctx context.Context, filter OrganizationFilter) iter.Seq2[Organization, error] {
+	return paginate(func(page Page) ([]Organization, *string, error) {
+		resp, err := c.SearchOrganizations(ctx, filter, page)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.Organizations, resp.NextID, nil
+	}, filter.Matches)
+}
+
+// paginate follows nextId until the server stops returning one. A cursor that
+// repeats yields ErrRepeatedCursor rather than looping forever, or ending as
+// if every page had been read.
+func paginate[T any](fetch func(Page) ([]T, *string, error), keep func(T) bool) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		page := Page{Limit: DefaultPageSize}
+		seen := map[string]bool{}
+		for {
+			items, next, err := fetch(page)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if keep(item) && !yield(item, nil) {
+					return
+				}
+			}
+			if next == nil || *next == "" {
+				return
+			}
+			if seen[*next] {
+				var zero T
+				yield(zero, fmt.Errorf("%w: %q", ErrRepeatedCursor, *next))
+				return
+			}
+			seen[*next] = true
+			page.NextID = *next
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package mural
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func pages(ids ...string) func(Page) ([]int, *string, error) {
+	n := 0
+	return func(Page) ([]int, *string, error) {
+		n++
+		if n > len(ids) {
+			return []int{n}, nil, nil
+		}
+		return []int{n}, &ids[n-1], nil
+	}
+}
+
+func TestPaginateFollowsNextID(t *testing.T) {
+	var got []int
+	for v, err := range paginate(pages("a", "b"), func(int) bool { return true }) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestPaginateRepeatedNextID(t *testing.T) {
+	var got []int
+	var last error
+	for v, err := range paginate(pages("a", "b", "a"), func(int) bool { return true }) {
+		if err != nil {
+			last = err
+			continue
+		}
+		got = append(got, v)
+	}
+	if !errors.Is(last, ErrRepeatedCursor) {
+		t.Errorf("err = %v, want ErrRepeatedCursor", last)
+	}
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestTransactionFilterMatchesStatus(t *testing.T) {
+	f := TransactionFilter{Status: TransactionStatusCompleted}
+	if !f.Matches(Transaction{Status: "completed"}) || !f.Matches(Transaction{}) {
+		t.Error("completed or unreported status rejected")
+	}
+	if f.Matches(Transaction{Status: TransactionStatusPending}) {
+		t.Error("pending transaction matched a completed filter")
+	}
+	if f.body()["filter"].(map[string]any)["status"] != TransactionStatusCompleted {
+		t.Errorf("status not sent: %v", f.body())
+	}
+}
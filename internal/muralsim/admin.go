@@ -0,0 +1,394 @@
+package muralsim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrInvalidStatus = errors.New("invalid status")
+)
+
+// Fault makes matching Mural requests fail with Status. Method and Path are
+// optional; Path matches by prefix. Count limits how many requests fail (0
+// means until cleared) and RetryAfter, when set, is sent as Retry-After.
+type Fault struct {
+	Method     string        `json:"method,omitempty"`
+	Path       string        `json:"path,omitempty"`
+	Status     int           `json:"status"`
+	Count      int           `json:"count,omitempty"`
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	return (f.Method == "" || strings.EqualFold(f.Method, r.Method)) &&
+		strings.HasPrefix(r.URL.Path, f.Path)
+}
+
+// InjectDeposit credits the account with a USDC deposit: it records a
+// DEPOSIT transaction and a payin with the given status (COMPLETED if
+// empty), and sends the matching webhooks. Only completed payins credit the
+// balance.
+func (s *Server) InjectDeposit(amount money.Money, status string) (*mural.Payin, error) {
+	if amount.Currency != money.USDC || amount.Amount.Sign() <= 0 {
+		return nil, fmt.Errorf("deposit must be a positive USDC amount, got %s", amount)
+	}
+	if status == "" {
+		status = mural.PayinStatusCompleted
+	}
+	if !validPayinStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+
+	now := time.Now().UTC()
+	p := &mural.Payin{
+		ID:                   newID(),
+		DestinationAccountID: s.cfg.AccountID,
+		Status:               status,
+		TokenAmount:          mural.NewTokenAmount(amount),
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	s.mu.Lock()
+	s.payins = append(s.payins, p)
+	tx, credited := s.creditLocked(p)
+	payin := *p
+	s.mu.Unlock()
+
+	logf("deposit of %s (payin %s, %s)", amount, p.ID, status)
+	s.emitPayinStatus(payin)
+	if credited {
+		s.emitAccountCredited(tx)
+	}
+	return &payin, nil
+}
+
+// SetPayinStatus moves a payin to status, crediting the account when it
+// completes.
+func (s *Server) SetPayinStatus(id, status string) (*mural.Payin, error) {
+	if !validPayinStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+	s.mu.Lock()
+	var p *mural.Payin
+	for _, cand := range s.payins {
+		if cand.ID == id {
+			p = cand
+			break
+		}
+	}
+	if p == nil {
+		s.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	if p.Status == status {
+		payin := *p
+		s.mu.Unlock()
+		return &payin, nil
+	}
+	p.Status = status
+	p.UpdatedAt = time.Now().UTC()
+	tx, credited := s.creditLocked(p)
+	payin := *p
+	s.mu.Unlock()
+
+	s.emitPayinStatus(payin)
+	if credited {
+		s.emitAccountCredited(tx)
+	}
+	return &payin, nil
+}
+
+// creditLocked records the deposit transaction for a completed payin. It must
+// be called with s.mu held.
+func (s *Server) creditLocked(p *mural.Payin) (mural.Transaction, bool) {
+	if p.Status != mural.PayinStatusCompleted {
+		return mural.Transaction{}, false
+	}
+	tx := mural.Transaction{
+		ID:          newID(),
+		Direction:   mural.DirectionDeposit,
+		Status:      mural.TransactionStatusCompleted,
+		ExecutedAt:  p.UpdatedAt,
+		TokenAmount: p.TokenAmount,
+	}
+	s.transactions = append(s.transactions, tx)
+	s.balance = s.balance.Add(p.TokenAmount.TokenAmount)
+	return tx, true
+}
+
+func validPayinStatus(status string) bool {
+	switch status {
+	case mural.PayinStatusPending, mural.PayinStatusCompleted, mural.PayinStatusFailed:
+		return true
+	}
+	return false
+}
+
+// QueuePayoutOutcomes sets the final statuses of the next executed payouts,
+// in order. Payouts executed once the queue is empty settle as EXECUTED.
+func (s *Server) QueuePayoutOutcomes(statuses ...string) error {
+	for _, st := range statuses {
+		if !finalPayoutStatus(st) {
+			return fmt.Errorf("%w: %q", ErrInvalidStatus, st)
+		}
+	}
+	s.mu.Lock()
+	s.outcomes = append(s.outcomes, statuses...)
+	s.mu.Unlock()
+	return nil
+}
+
+// SetPayoutStatus moves a payout to status and sends a PAYOUT_REQUEST
+// webhook. A pending payout that fails or is canceled returns its funds to
+// the account.
+func (s *Server) SetPayoutStatus(id, status string) (*mural.PayoutRequest, error) {
+	if status != mural.PayoutStatusPending && !finalPayoutStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+	s.mu.Lock()
+	p := s.findPayout(id)
+	if p == nil {
+		s.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	if p.Status == status || finalPayoutStatus(p.Status) {
+		pr := p.PayoutRequest
+		s.mu.Unlock()
+		return &pr, nil
+	}
+	if p.Status == mural.PayoutStatusPending && (status == mural.PayoutStatusFailed || status == mural.PayoutStatusCanceled) {
+		s.balance = s.balance.Add(p.Amount.Amount)
+	}
+	p.Status = status
+	p.UpdatedAt = time.Now().UTC()
+	pr := p.PayoutRequest
+	s.mu.Unlock()
+
+	logf("payout %s is now %s", id, status)
+	s.emitPayoutStatus(pr.ID, pr.Status)
+	return &pr, nil
+}
+
+func finalPayoutStatus(status string) bool {
+	switch status {
+	case mural.PayoutStatusExecuted, mural.PayoutStatusFailed, mural.PayoutStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// InjectFault makes upcoming Mural requests fail; see Fault.
+func (s *Server) InjectFault(f Fault) error {
+	if f.Status < 400 || f.Status > 599 {
+		return fmt.Errorf("fault status must be 4xx or 5xx, got %d", f.Status)
+	}
+	s.mu.Lock()
+	s.faults = append(s.faults, &f)
+	s.mu.Unlock()
+	return nil
+}
+
+// ClearFaults removes every injected fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	s.faults = nil
+	s.mu.Unlock()
+}
+
+// SetRate sets the fiat-per-USDC rate quoted for a fiat-and-rail code.
+func (s *Server) SetRate(rail string, rate money.Decimal) error {
+	rail = strings.ToLower(rail)
+	if _, ok := railCurrencies[rail]; !ok {
+		return fmt.Errorf("unsupported fiat-and-rail code %q", rail)
+	}
+	if rate.Sign() <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	s.mu.Lock()
+	s.rates[rail] = rate
+	s.mu.Unlock()
+	return nil
+}
+
+// Deliveries returns every webhook delivery attempt so far.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// injectFault fails r with the first matching fault, if any.
+func (s *Server) injectFault(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.Lock()
+	var hit *Fault
+	for i, f := range s.faults {
+		if !f.matches(r) {
+			continue
+		}
+		hit = f
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		break
+	}
+	s.mu.Unlock()
+
+	if hit == nil {
+		return false
+	}
+	if hit.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(hit.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	logf("injected %d for %s %s", hit.Status, r.Method, r.URL.Path)
+	writeError(w, hit.Status, "SimulatedFaultException", "fault injected by simulator")
+	return true
+}
+
+func (s *Server) handleSimState(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"account":        s.accountSnapshot(),
+		"rates":          s.rates,
+		"transactions":   nonNil(s.transactions),
+		"payins":         nonNil(s.payins),
+		"payouts":        nonNil(s.payouts),
+		"counterparties": s.counterparties,
+		"payoutMethods":  s.payoutMethods,
+		"webhooks":       nonNil(s.webhooks),
+		"outcomes":       nonNil(s.outcomes),
+		"faults":         nonNil(s.faults),
+		"deliveries":     nonNil(s.deliveries),
+	})
+}
+
+func (s *Server) handleSimPublicKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write([]byte(s.PublicKeyPEM()))
+}
+
+func (s *Server) handleSimDeposit(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Amount money.Decimal `json:"amount"`
+		Status string        `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := s.InjectDeposit(money.NewMoney(body.Amount, money.USDC), body.Status)
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) handleSimPayinStatus(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := s.SetPayinStatus(r.PathValue("id"), body.Status)
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleSimPayoutOutcomes(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Outcomes []string `json:"outcomes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := s.QueuePayoutOutcomes(body.Outcomes...); err != nil {
+		writeSimError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSimPayoutStatus(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := s.SetPayoutStatus(r.PathValue("id"), body.Status)
+	if err != nil {
+		writeSimError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// handleSimFault adds a fault, or clears them all when the body is
+// {"clear": true}. retryAfterSeconds sets Fault.RetryAfter.
+func (s *Server) handleSimFault(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Fault
+		RetryAfterSeconds int  `json:"retryAfterSeconds"`
+		Clear             bool `json:"clear"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.Clear {
+		s.ClearFaults()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	f := body.Fault
+	f.RetryAfter = time.Duration(body.RetryAfterSeconds) * time.Second
+	if err := s.InjectFault(f); err != nil {
+		writeSimError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSimRates(w http.ResponseWriter, r *http.Request) {
+	var rates map[string]money.Decimal
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	for rail, rate := range rates {
+		if err := s.SetRate(rail, rate); err != nil {
+			writeSimError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSimError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,599 @@
+package muralsim
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+const maxWebhooks = 5
+
+func newID() string {
+	return uuid.NewString()
+}
+
+func (s *Server) accountSnapshot() mural.Account {
+	acct := s.account
+	acct.AccountDetails = &mural.AccountDetails{
+		Balances: []mural.TokenBalance{{TokenAmount: s.balance, TokenSymbol: string(money.USDC)}},
+		WalletDetails: &mural.WalletDetails{
+			WalletAddress: s.cfg.WalletAddress,
+			Blockchain:    s.cfg.Blockchain,
+		},
+	}
+	return acct
+}
+
+func (s *Server) handleListAccounts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, []mural.Account{s.accountSnapshot()})
+}
+
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.PathValue("id") != s.account.ID {
+		writeError(w, http.StatusNotFound, "AccountNotFoundException", "account not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.accountSnapshot())
+}
+
+// searchRequest is the body shared by the search endpoints; each endpoint
+// only looks at the filter fields that apply to it.
+type searchRequest struct {
+	Filter struct {
+		StartDate             *time.Time `json:"startDate"`
+		EndDate               *time.Time `json:"endDate"`
+		Direction             string     `json:"direction"`
+		TokenSymbol           string     `json:"tokenSymbol"`
+		Statuses              []string   `json:"statuses"`
+		DestinationAccountIDs []string   `json:"destinationAccountIds"`
+		Name                  string     `json:"name"`
+		Status                string     `json:"status"`
+	} `json:"filter"`
+}
+
+func (q searchRequest) timeRange() mural.TimeRange {
+	var tr mural.TimeRange
+	if q.Filter.StartDate != nil {
+		tr.From = *q.Filter.StartDate
+	}
+	if q.Filter.EndDate != nil {
+		tr.To = *q.Filter.EndDate
+	}
+	return tr
+}
+
+// page returns the page of items (newest first) selected by the limit and
+// nextId query parameters. The cursor is the ID of the first item of the
+// next page.
+func page[T any](r *http.Request, items []T, id func(T) string) ([]T, *string) {
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v < limit {
+		limit = v
+	}
+	start := 0
+	if next := r.URL.Query().Get("nextId"); next != "" {
+		start = len(items)
+		for i, it := range items {
+			if id(it) == next {
+				start = i
+				break
+			}
+		}
+	}
+	end := min(start+limit, len(items))
+	var nextID *string
+	if end < len(items) {
+		n := id(items[end])
+		nextID = &n
+	}
+	return items[start:end], nextID
+}
+
+func (s *Server) handleSearchOrganizations(w http.ResponseWriter, r *http.Request) {
+	var q searchRequest
+	if !decodeBody(w, r, &q) {
+		return
+	}
+	filter := mural.OrganizationFilter{Name: q.Filter.Name, Status: q.Filter.Status}
+	var orgs []mural.Organization
+	org := mural.Organization{ID: s.cfg.OrganizationID, Name: "Mural Checkout Demo", Status: "ACTIVE"}
+	if filter.Matches(org) {
+		orgs = append(orgs, org)
+	}
+	items, next := page(r, orgs, func(o mural.Organization) string { return o.ID })
+	writeJSON(w, http.StatusOK, mural.SearchOrganizationsResponse{Count: len(orgs), NextID: next, Organizations: nonNil(items)})
+}
+
+func (s *Server) handleSearchTransactions(w http.ResponseWriter, r *http.Request) {
+	var q searchRequest
+	if !decodeBody(w, r, &q) {
+		return
+	}
+	filter := mural.TransactionFilter{
+		Executed:    q.timeRange(),
+		Direction:   q.Filter.Direction,
+		Status:      q.Filter.Status,
+		TokenSymbol: q.Filter.TokenSymbol,
+	}
+
+	s.mu.Lock()
+	if r.PathValue("id") != s.account.ID {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "AccountNotFoundException", "account not found")
+		return
+	}
+	var matched []mural.Transaction
+	for i := len(s.transactions) - 1; i >= 0; i-- {
+		if filter.Matches(s.transactions[i]) {
+			matched = append(matched, s.transactions[i])
+		}
+	}
+	s.mu.Unlock()
+
+	items, next := page(r, matched, func(t mural.Transaction) string { return t.ID })
+	writeJSON(w, http.StatusOK, mural.SearchTransactionsForAccountResponse{Count: len(matched), NextID: next, Transactions: nonNil(items)})
+}
+
+func (s *Server) handleSearchPayins(w http.ResponseWriter, r *http.Request) {
+	var q searchRequest
+	if !decodeBody(w, r, &q) {
+		return
+	}
+	filter := mural.PayinFilter{
+		Created:     q.timeRange(),
+		Statuses:    q.Filter.Statuses,
+		TokenSymbol: q.Filter.TokenSymbol,
+	}
+
+	s.mu.Lock()
+	var matched []mural.Payin
+	for i := len(s.payins) - 1; i >= 0; i-- {
+		p := *s.payins[i]
+		if len(q.Filter.DestinationAccountIDs) > 0 && !slices.Contains(q.Filter.DestinationAccountIDs, p.DestinationAccountID) {
+			continue
+		}
+		if filter.Matches(p) {
+			matched = append(matched, p)
+		}
+	}
+	s.mu.Unlock()
+
+	items, next := page(r, matched, func(p mural.Payin) string { return p.ID })
+	writeJSON(w, http.StatusOK, mural.SearchPayinsResponse{Count: len(matched), NextID: next, Payins: nonNil(items)})
+}
+
+func (s *Server) handleTokenToFiatFees(w http.ResponseWriter, r *http.Request) {
+	var req mural.TokenToFiatQuoteRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.TokenFeeRequests) == 0 {
+		writeError(w, http.StatusBadRequest, "InvalidRequestBodyException", "tokenFeeRequests is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]mural.TokenToFiatQuoteResult, 0, len(req.TokenFeeRequests))
+	for _, fr := range req.TokenFeeRequests {
+		rail := strings.ToLower(fr.FiatAndRailCode)
+		rate, ok := s.rates[rail]
+		currency, known := railCurrencies[rail]
+		if !ok || !known {
+			writeError(w, http.StatusBadRequest, "UnsupportedFiatAndRailException", "unsupported fiatAndRailCode "+fr.FiatAndRailCode)
+			return
+		}
+		amount := fr.Amount.Money()
+		if amount.Currency != money.USDC || amount.Amount.Sign() <= 0 {
+			writeError(w, http.StatusBadRequest, "InvalidTokenAmountException", "amount must be a positive USDC amount")
+			return
+		}
+		fiat := amount.Convert(rate, currency)
+		fee := mural.NewTokenAmount(money.Zero(money.USDC))
+		out = append(out, mural.TokenToFiatQuoteResult{
+			Type:                "success",
+			FiatAndRailCode:     rail,
+			TokenAmount:         fr.Amount,
+			ExchangeRate:        rate,
+			FeeTotal:            &fee,
+			EstimatedFiatAmount: mural.FiatAmount{Amount: fiat.Amount, CurrencyCode: string(currency)},
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleFiatToTokenFees(w http.ResponseWriter, r *http.Request) {
+	var req mural.FiatToTokenQuoteRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.FiatFeeRequests) == 0 {
+		writeError(w, http.StatusBadRequest, "InvalidRequestBodyException", "fiatFeeRequests is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]mural.FiatToTokenQuoteResult, 0, len(req.FiatFeeRequests))
+	for _, fr := range req.FiatFeeRequests {
+		rail := strings.ToLower(fr.FiatAndRailCode)
+		rate, ok := s.rates[rail]
+		currency, known := railCurrencies[rail]
+		if !ok || !known {
+			writeError(w, http.StatusBadRequest, "UnsupportedFiatAndRailException", "unsupported fiatAndRailCode "+fr.FiatAndRailCode)
+			return
+		}
+		if money.ParseCurrency(fr.TokenSymbol) != money.USDC || fr.FiatAmount.Sign() <= 0 {
+			writeError(w, http.StatusBadRequest, "InvalidTokenAmountException", "fiatAmount must be positive and tokenSymbol USDC")
+			return
+		}
+		// Round the token amount up so converting it back never falls
+		// short of the requested fiat amount.
+		fiat := money.NewMoney(fr.FiatAmount, currency)
+		tokens := money.NewMoney(fiat.Amount.Div(rate, money.USDC.Scale()), money.USDC)
+		if tokens.Convert(rate, currency).Amount.LessThan(fiat.Amount) {
+			tokens.Amount = tokens.Amount.Add(money.MustParse("0.000001"))
+		}
+		fee := mural.NewTokenAmount(money.Zero(money.USDC))
+		out = append(out, mural.FiatToTokenQuoteResult{
+			Type:                         "success",
+			FiatAndRailCode:              rail,
+			FiatAmount:                   mural.FiatAmount{Amount: fiat.Amount, CurrencyCode: string(currency)},
+			ExchangeRate:                 rate,
+			FeeTotal:                     &fee,
+			EstimatedTokenAmountRequired: mural.NewTokenAmount(tokens),
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleCreatePayout(w http.ResponseWriter, r *http.Request) {
+	var req mural.CreatePayoutRequestRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idemKey := r.Header.Get(mural.IdempotencyKeyHeader)
+	if prev, ok := s.idempotent["create:"+idemKey].(*payout); ok && idemKey != "" {
+		writeJSON(w, http.StatusOK, createResponse(prev))
+		return
+	}
+
+	if req.SourceAccountID != s.account.ID {
+		writeError(w, http.StatusBadRequest, "AccountNotFoundException", "unknown sourceAccountId "+req.SourceAccountID)
+		return
+	}
+	if len(req.Payouts) == 0 {
+		writeError(w, http.StatusBadRequest, "InvalidRequestBodyException", "payouts is required")
+		return
+	}
+	total := money.Zero(money.USDC)
+	for i, p := range req.Payouts {
+		if msg := s.validatePayout(p); msg != "" {
+			writeError(w, http.StatusBadRequest, "InvalidPayoutException", "payouts["+strconv.Itoa(i)+"]: "+msg)
+			return
+		}
+		total, _ = total.Add(p.Amount.Money())
+	}
+
+	now := time.Now().UTC()
+	p := &payout{
+		PayoutRequest: mural.PayoutRequest{
+			ID:              newID(),
+			Status:          mural.PayoutStatusAwaitingExecution,
+			SourceAccountID: req.SourceAccountID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
+		Request: req,
+		Amount:  total,
+	}
+	s.payouts = append(s.payouts, p)
+	if idemKey != "" {
+		s.idempotent["create:"+idemKey] = p
+	}
+	logf("created payout %s for %s", p.ID, total)
+	writeJSON(w, http.StatusCreated, createResponse(p))
+}
+
+// validatePayout must be called with s.mu held.
+func (s *Server) validatePayout(p mural.PayoutInfoInput) string {
+	amount := p.Amount.Money()
+	if amount.Currency != money.USDC || amount.Amount.Sign() <= 0 {
+		return "amount must be a positive USDC amount"
+	}
+	if p.PayoutMethodID != "" {
+		pm, ok := s.payoutMethods[p.PayoutMethodID]
+		if !ok || pm.CounterpartyID != p.CounterpartyID {
+			return "unknown counterparty payout method"
+		}
+		return ""
+	}
+	if p.PayoutDetails == nil || p.RecipientInfo == nil {
+		return "payoutMethodId or payoutDetails and recipientInfo are required"
+	}
+	if err := p.PayoutDetails.Validate(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func createResponse(p *payout) mural.CreatePayoutRequestResponse {
+	return mural.CreatePayoutRequestResponse{
+		ID:              p.ID,
+		Status:          p.Status,
+		CreatedAt:       p.CreatedAt,
+		UpdatedAt:       p.UpdatedAt,
+		SourceAccountID: p.SourceAccountID,
+	}
+}
+
+// findPayout must be called with s.mu held.
+func (s *Server) findPayout(id string) *payout {
+	for _, p := range s.payouts {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleGetPayout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.findPayout(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "PayoutRequestNotFoundException", "payout request not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.PayoutRequest)
+}
+
+// handleExecutePayout moves a payout to PENDING and schedules it to settle
+// with the next queued outcome (EXECUTED by default).
+func (s *Server) handleExecutePayout(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("transfer-api-key")
+	if key == "" || (s.cfg.TransferKey != "" && key != s.cfg.TransferKey) {
+		writeError(w, http.StatusUnauthorized, "UnauthorizedException", "invalid transfer api key")
+		return
+	}
+	var body struct {
+		ExchangeRateToleranceMode string `json:"exchangeRateToleranceMode"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	p := s.findPayout(r.PathValue("id"))
+	if p == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "PayoutRequestNotFoundException", "payout request not found")
+		return
+	}
+	idemKey := r.Header.Get(mural.IdempotencyKeyHeader)
+	if prev, ok := s.idempotent["execute:"+idemKey].(*payout); ok && idemKey != "" && prev == p {
+		resp := createResponse(p)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if status := p.Status; status != mural.PayoutStatusAwaitingExecution {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "PayoutRequestNotExecutableException", "payout request is "+status)
+		return
+	}
+
+	p.final = mural.PayoutStatusExecuted
+	if len(s.outcomes) > 0 {
+		p.final, s.outcomes = s.outcomes[0], s.outcomes[1:]
+	}
+	p.Status = mural.PayoutStatusPending
+	p.UpdatedAt = time.Now().UTC()
+	s.balance = s.balance.Sub(p.Amount.Amount)
+	s.transactions = append(s.transactions, mural.Transaction{
+		ID:          newID(),
+		Memo:        p.Request.Memo,
+		Direction:   mural.DirectionPayout,
+		Status:      mural.TransactionStatusCompleted,
+		ExecutedAt:  p.UpdatedAt,
+		TokenAmount: mural.NewTokenAmount(p.Amount),
+	})
+	if idemKey != "" {
+		s.idempotent["execute:"+idemKey] = p
+	}
+	resp := createResponse(p)
+	id, final := p.ID, p.final
+	s.mu.Unlock()
+
+	logf("executing payout %s; it will settle as %s", id, final)
+	s.emitPayoutStatus(resp.ID, resp.Status)
+	if s.cfg.SettleDelay >= 0 {
+		time.AfterFunc(s.cfg.SettleDelay, func() {
+			if _, err := s.SetPayoutStatus(id, final); err != nil {
+				logf("settle payout %s: %v", id, err)
+			}
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateCounterparty(w http.ResponseWriter, r *http.Request) {
+	var req mural.CreateCounterpartyRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	info := req.Counterparty
+	if strings.TrimSpace(info.Name) == "" {
+		writeError(w, http.StatusBadRequest, "InvalidCounterpartyException", "counterparty name is required")
+		return
+	}
+	now := time.Now().UTC()
+	addr := info.PhysicalAddress
+	cp := &mural.Counterparty{
+		ID:              newID(),
+		Type:            info.Type,
+		Name:            info.Name,
+		Email:           info.Email,
+		Status:          "ACTIVE",
+		PhysicalAddress: &addr,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	s.mu.Lock()
+	s.counterparties[cp.ID] = cp
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, cp)
+}
+
+func (s *Server) handleGetCounterparty(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.counterparties[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "CounterpartyNotFoundException", "counterparty not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, cp)
+}
+
+func (s *Server) handleCreatePayoutMethod(w http.ResponseWriter, r *http.Request) {
+	var req mural.CreatePayoutMethodRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if err := req.PayoutDetails.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidPayoutMethodException", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cpID := r.PathValue("id")
+	if _, ok := s.counterparties[cpID]; !ok {
+		writeError(w, http.StatusNotFound, "CounterpartyNotFoundException", "counterparty not found")
+		return
+	}
+	now := time.Now().UTC()
+	pm := &mural.PayoutMethod{
+		ID:             newID(),
+		CounterpartyID: cpID,
+		Alias:          req.Alias,
+		Status:         "ACTIVE",
+		PayoutDetails:  req.PayoutDetails,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	s.payoutMethods[pm.ID] = pm
+	writeJSON(w, http.StatusCreated, pm)
+}
+
+func (s *Server) handleGetPayoutMethod(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, ok := s.payoutMethods[r.PathValue("methodId")]
+	if !ok || pm.CounterpartyID != r.PathValue("id") {
+		writeError(w, http.StatusNotFound, "PayoutMethodNotFoundException", "payout method not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, pm)
+}
+
+func (s *Server) handleDeletePayoutMethod(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, ok := s.payoutMethods[r.PathValue("methodId")]
+	if !ok || pm.CounterpartyID != r.PathValue("id") {
+		writeError(w, http.StatusNotFound, "PayoutMethodNotFoundException", "payout method not found")
+		return
+	}
+	delete(s.payoutMethods, pm.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]mural.Webhook, 0, len(s.webhooks))
+	for _, wh := range s.webhooks {
+		out = append(out, *wh)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req mural.CreateWebhookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.URL == "" || len(req.Events) == 0 {
+		writeError(w, http.StatusBadRequest, "InvalidWebhookException", "url and events are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.webhooks) >= maxWebhooks {
+		writeError(w, http.StatusBadRequest, "WebhookLimitExceededException", "at most 5 webhooks are allowed")
+		return
+	}
+	wh := &mural.Webhook{ID: newID(), URL: req.URL, Status: "DISABLED", Events: req.Events}
+	s.webhooks = append(s.webhooks, wh)
+	writeJSON(w, http.StatusCreated, wh)
+}
+
+func (s *Server) handleUpdateWebhookStatus(w http.ResponseWriter, r *http.Request) {
+	var req mural.UpdateWebhookStatusRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Status != "ACTIVE" && req.Status != "DISABLED" {
+		writeError(w, http.StatusBadRequest, "InvalidWebhookException", "status must be ACTIVE or DISABLED")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, wh := range s.webhooks {
+		if wh.ID == r.PathValue("id") {
+			wh.Status = req.Status
+			writeJSON(w, http.StatusOK, wh)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "WebhookNotFoundException", "webhook not found")
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, wh := range s.webhooks {
+		if wh.ID == r.PathValue("id") {
+			s.webhooks = slices.Delete(s.webhooks, i, i+1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "WebhookNotFoundException", "webhook not found")
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,269 @@
+// Package muralsim is an in-memory stand-in for the subset of the Mural API
+// that mural.Client uses. It lets the whole checkout run offline and can be
+// mounted in an httptest.Server for integration tests.
+//
+// Besides the Mural endpoints it serves admin hooks under /_sim/ to inject
+// deposits, force payout outcomes and inject faults; the same operations are
+// available as methods on Server.
+package muralsim
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// Defaults match the account and organization the API server pins for the
+// demo, so it works against the simulator without extra configuration.
+const (
+	DefaultAccountID      = "34b0890c-889b-4b02-8ba7-0011e4af5074"
+	DefaultOrganizationID = "3e8ad179-74ce-4526-a265-80b005e9c3d0"
+)
+
+// Config configures a simulator. Zero fields take sensible defaults.
+type Config struct {
+	AccountID      string
+	AccountName    string
+	OrganizationID string
+	WalletAddress  string
+	Blockchain     string
+	// StartingBalance is the account's initial USDC balance.
+	StartingBalance money.Decimal
+
+	// APIKey and TransferKey, when set, must be presented by clients.
+	APIKey      string
+	TransferKey string
+
+	// Rates are fiat units per USDC keyed by fiat-and-rail code.
+	Rates map[string]money.Decimal
+	// SettleDelay is how long an executed payout stays PENDING before it
+	// settles. A negative delay leaves payouts pending until an admin hook
+	// settles them.
+	SettleDelay time.Duration
+
+	// SigningKey signs webhook deliveries; a P-256 key is generated if nil.
+	SigningKey *ecdsa.PrivateKey
+	// HTTPClient delivers webhooks.
+	HTTPClient *http.Client
+}
+
+var defaultRates = map[string]string{
+	mural.RailCOP: "4000",
+	mural.RailMXN: "17.1",
+	mural.RailBRL: "5.05",
+	mural.RailARS: "905",
+	mural.RailUSD: "1",
+	mural.RailEUR: "0.92",
+}
+
+var railCurrencies = map[string]money.Currency{
+	mural.RailCOP: money.COP,
+	mural.RailMXN: money.MXN,
+	mural.RailBRL: money.BRL,
+	mural.RailARS: money.ARS,
+	mural.RailUSD: money.USD,
+	mural.RailEUR: money.EUR,
+}
+
+// Server is the simulator. It implements http.Handler.
+type Server struct {
+	cfg    Config
+	key    *ecdsa.PrivateKey
+	client *http.Client
+	mux    *http.ServeMux
+
+	mu             sync.Mutex
+	account        mural.Account
+	balance        money.Decimal
+	rates          map[string]money.Decimal
+	transactions   []mural.Transaction // oldest first
+	payins         []*mural.Payin      // oldest first
+	payouts        []*payout           // oldest first
+	idempotent     map[string]any
+	webhooks       []*mural.Webhook
+	counterparties map[string]*mural.Counterparty
+	payoutMethods  map[string]*mural.PayoutMethod
+	outcomes       []string
+	faults         []*Fault
+	deliveries     []Delivery
+}
+
+type payout struct {
+	mural.PayoutRequest
+	Request mural.CreatePayoutRequestRequest `json:"request"`
+	Amount  money.Money                      `json:"amount"`
+	final   string
+}
+
+// New returns a simulator with an empty ledger.
+func New(cfg Config) (*Server, error) {
+	if cfg.AccountID == "" {
+		cfg.AccountID = DefaultAccountID
+	}
+	if cfg.AccountName == "" {
+		cfg.AccountName = "Main Account"
+	}
+	if cfg.OrganizationID == "" {
+		cfg.OrganizationID = DefaultOrganizationID
+	}
+	if cfg.WalletAddress == "" {
+		cfg.WalletAddress = "0xSIMULATEDMURALWALLET00000000000000000000"
+	}
+	if cfg.Blockchain == "" {
+		cfg.Blockchain = "POLYGON"
+	}
+	if cfg.StartingBalance.IsZero() {
+		cfg.StartingBalance = money.NewFromInt(1_000_000)
+	}
+	if cfg.SettleDelay == 0 {
+		cfg.SettleDelay = 3 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	key := cfg.SigningKey
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+	}
+
+	rates := make(map[string]money.Decimal, len(defaultRates))
+	for rail, r := range defaultRates {
+		rates[rail] = money.MustParse(r)
+	}
+	for rail, r := range cfg.Rates {
+		rates[strings.ToLower(rail)] = r
+	}
+
+	now := time.Now().UTC()
+	s := &Server{
+		cfg:    cfg,
+		key:    key,
+		client: cfg.HTTPClient,
+		account: mural.Account{
+			ID:             cfg.AccountID,
+			Name:           cfg.AccountName,
+			IsAPIEnabled:   true,
+			Status:         "ACTIVE",
+			OrganizationID: cfg.OrganizationID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		},
+		balance:        cfg.StartingBalance,
+		rates:          rates,
+		idempotent:     map[string]any{},
+		counterparties: map[string]*mural.Counterparty{},
+		payoutMethods:  map[string]*mural.PayoutMethod{},
+	}
+	s.routes()
+	return s, nil
+}
+
+func (s *Server) routes() {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/accounts", s.auth(s.handleListAccounts))
+	mux.HandleFunc("GET /api/accounts/{id}", s.auth(s.handleGetAccount))
+	mux.HandleFunc("POST /api/organizations/search", s.auth(s.handleSearchOrganizations))
+	mux.HandleFunc("POST /api/transactions/search/account/{id}", s.auth(s.handleSearchTransactions))
+	mux.HandleFunc("POST /api/payins/search", s.auth(s.handleSearchPayins))
+	mux.HandleFunc("POST /api/payouts/fees/token-to-fiat", s.auth(s.handleTokenToFiatFees))
+	mux.HandleFunc("POST /api/payouts/fees/fiat-to-token", s.auth(s.handleFiatToTokenFees))
+	mux.HandleFunc("POST /api/payouts/payout", s.auth(s.handleCreatePayout))
+	mux.HandleFunc("GET /api/payouts/payout/{id}", s.auth(s.handleGetPayout))
+	mux.HandleFunc("POST /api/payouts/payout/{id}/execute", s.auth(s.handleExecutePayout))
+	mux.HandleFunc("POST /api/counterparties", s.auth(s.handleCreateCounterparty))
+	mux.HandleFunc("GET /api/counterparties/{id}", s.auth(s.handleGetCounterparty))
+	mux.HandleFunc("POST /api/counterparties/{id}/payout-methods", s.auth(s.handleCreatePayoutMethod))
+	mux.HandleFunc("GET /api/counterparties/{id}/payout-methods/{methodId}", s.auth(s.handleGetPayoutMethod))
+	mux.HandleFunc("DELETE /api/counterparties/{id}/payout-methods/{methodId}", s.auth(s.handleDeletePayoutMethod))
+	mux.HandleFunc("GET /api/webhooks", s.auth(s.handleListWebhooks))
+	mux.HandleFunc("POST /api/webhooks", s.auth(s.handleCreateWebhook))
+	mux.HandleFunc("PATCH /api/webhooks/{id}/status", s.auth(s.handleUpdateWebhookStatus))
+	mux.HandleFunc("DELETE /api/webhooks/{id}", s.auth(s.handleDeleteWebhook))
+
+	mux.HandleFunc("GET /_sim/state", s.handleSimState)
+	mux.HandleFunc("GET /_sim/webhook-public-key", s.handleSimPublicKey)
+	mux.HandleFunc("POST /_sim/deposits", s.handleSimDeposit)
+	mux.HandleFunc("POST /_sim/payins/{id}/status", s.handleSimPayinStatus)
+	mux.HandleFunc("POST /_sim/payouts/outcomes", s.handleSimPayoutOutcomes)
+	mux.HandleFunc("POST /_sim/payouts/{id}/status", s.handleSimPayoutStatus)
+	mux.HandleFunc("POST /_sim/faults", s.handleSimFault)
+	mux.HandleFunc("PUT /_sim/rates", s.handleSimRates)
+
+	s.mux = mux
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/_sim/") && s.injectFault(w, r) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// PublicKeyPEM returns the PEM-encoded public key that verifies webhook
+// signatures, in the form MURAL_WEBHOOK_PUBLIC_KEY expects.
+func (s *Server) PublicKeyPEM() string {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		// Only fails for unsupported key types; ours is always ECDSA.
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+s.cfg.APIKey {
+			writeError(w, http.StatusUnauthorized, "UnauthorizedException", "invalid api key")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds with a MuralServiceException body.
+func writeError(w http.ResponseWriter, status int, name, msg string) {
+	writeJSON(w, status, mural.ServiceError{
+		ErrorInstanceID: newID(),
+		Name:            name,
+		Message:         msg,
+		Params:          map[string]any{},
+	})
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequestBodyException", err.Error())
+		return false
+	}
+	return true
+}
+
+func logf(format string, args ...any) {
+	log.Printf("muralsim: "+format, args...)
+}
@@ -0,0 +1,226 @@
+package muralsim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+	"github.com/srypher/mural-challenge-backend/internal/webhooks"
+)
+
+// newTestClient mounts a simulator in an httptest.Server and returns it with
+// a mural.Client pointed at it.
+func newTestClient(t *testing.T, cfg Config) (*Server, *mural.Client) {
+	t.Helper()
+	cfg.APIKey, cfg.TransferKey = "api-key", "transfer-key"
+	sim, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(sim)
+	t.Cleanup(srv.Close)
+
+	client, err := mural.NewClient(mural.Config{
+		BaseURL:        srv.URL,
+		APIKey:         cfg.APIKey,
+		TransferKey:    cfg.TransferKey,
+		OrganizationID: DefaultOrganizationID,
+		AccountID:      DefaultAccountID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim, client
+}
+
+func usdc(s string) money.Money {
+	return money.NewMoney(money.MustParse(s), money.USDC)
+}
+
+func TestDepositsAreListedAsPayins(t *testing.T) {
+	sim, client := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	completed, err := sim.InjectDeposit(usdc("10.004321"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := sim.InjectDeposit(usdc("5"), mural.PayinStatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.InjectDeposit(usdc("5"), "LOST"); err == nil {
+		t.Error("deposit with an unknown status was accepted")
+	}
+
+	statuses := map[string]string{}
+	filter := mural.PayinFilter{DestinationAccountID: DefaultAccountID, TokenSymbol: string(money.USDC)}
+	for p, err := range client.Payins(ctx, filter) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses[p.ID] = p.Status
+		if p.ID == completed.ID && !p.TokenAmount.Money().Amount.Equal(money.MustParse("10.004321")) {
+			t.Errorf("payin amount %s, want 10.004321", p.TokenAmount.Money())
+		}
+	}
+	if statuses[completed.ID] != mural.PayinStatusCompleted || statuses[pending.ID] != mural.PayinStatusPending {
+		t.Errorf("payin statuses %v", statuses)
+	}
+
+	if _, err := sim.SetPayinStatus(pending.ID, mural.PayinStatusCompleted); err != nil {
+		t.Fatal(err)
+	}
+	filter.Statuses = []string{mural.PayinStatusCompleted}
+	n := 0
+	for _, err := range client.Payins(ctx, filter) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("%d completed payins, want 2", n)
+	}
+}
+
+func TestQuotesFollowRates(t *testing.T) {
+	sim, client := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	results, err := client.QuoteTokenToFiat(ctx, usdc("100"), mural.RailMXN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].ExchangeRate.Equal(money.MustParse("17.1")) {
+		t.Fatalf("quote = %+v, want rate 17.1", results)
+	}
+
+	if err := sim.SetRate(mural.RailMXN, money.MustParse("18")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = client.QuoteTokenToFiat(ctx, usdc("100"), mural.RailMXN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].ExchangeRate.Equal(money.MustParse("18")) {
+		t.Errorf("rate after SetRate = %s, want 18", results[0].ExchangeRate)
+	}
+}
+
+func TestPayoutSettlesWithQueuedOutcome(t *testing.T) {
+	sim, client := newTestClient(t, Config{SettleDelay: time.Millisecond})
+	ctx := context.Background()
+
+	if err := sim.QueuePayoutOutcomes(mural.PayoutStatusFailed); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.QueuePayoutOutcomes("LOST"); err == nil {
+		t.Error("queued an unknown payout status")
+	}
+
+	created, err := client.CreatePayoutRequest(ctx, mural.CreatePayoutRequestRequest{
+		SourceAccountID: DefaultAccountID,
+		Payouts: []mural.PayoutInfoInput{{
+			Amount: mural.NewTokenAmount(usdc("25")),
+			PayoutDetails: &mural.FiatPayoutDetails{BankName: "BBVA", BankAccountOwner: "Acme",
+				FiatAndRailDetails: mural.MxnDetails{BankAccountNumber: "012180001234567897"}},
+			RecipientInfo: &mural.BusinessRecipientInfo{Type: "business", Name: "Acme S.A. de C.V."},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Status != mural.PayoutStatusAwaitingExecution {
+		t.Errorf("created payout is %s", created.Status)
+	}
+
+	executed, err := client.ExecutePayoutRequest(ctx, created.ID, mural.ExchangeRateStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if executed.Status != mural.PayoutStatusPending {
+		t.Errorf("executed payout is %s", executed.Status)
+	}
+	if _, err := client.ExecutePayoutRequest(ctx, created.ID, ""); err == nil {
+		t.Error("executed a pending payout again")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p, err := client.GetPayoutRequest(ctx, created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status == mural.PayoutStatusFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("payout still %s, want it to settle as FAILED", p.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestInvalidPayoutIsRejected(t *testing.T) {
+	_, client := newTestClient(t, Config{})
+	_, err := client.CreatePayoutRequest(context.Background(), mural.CreatePayoutRequestRequest{
+		SourceAccountID: DefaultAccountID,
+		Payouts: []mural.PayoutInfoInput{{
+			Amount: mural.NewTokenAmount(usdc("25")),
+			PayoutDetails: &mural.FiatPayoutDetails{BankName: "BBVA", BankAccountOwner: "Acme",
+				FiatAndRailDetails: mural.MxnDetails{BankAccountNumber: "123"}},
+			RecipientInfo: &mural.BusinessRecipientInfo{Type: "business", Name: "Acme S.A. de C.V."},
+		}},
+	})
+	if code := mural.StatusCode(err); code != http.StatusBadRequest {
+		t.Errorf("err = %v (status %d), want 400", err, code)
+	}
+}
+
+func TestWebhooksAreSignedWithThePublishedKey(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan delivery, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.Header.Clone(), body}
+	}))
+	t.Cleanup(receiver.Close)
+
+	sim, client := newTestClient(t, Config{})
+	ctx := context.Background()
+	wh, err := client.CreateWebhook(ctx, receiver.URL, []string{CategoryPayin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateWebhookStatus(ctx, wh.ID, "ACTIVE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.InjectDeposit(usdc("10"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := webhooks.NewVerifier(sim.PublicKeyPEM(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-received:
+		if err := verifier.Verify(d.header, d.body); err != nil {
+			t.Errorf("Verify: %v", err)
+		}
+		if err := verifier.Verify(d.header, append(d.body, ' ')); err == nil {
+			t.Error("Verify accepted a tampered body")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+	}
+}
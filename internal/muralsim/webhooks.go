@@ -0,0 +1,188 @@
+package muralsim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// Webhook event categories.
+const (
+	CategoryBalanceActivity = "MURAL_ACCOUNT_BALANCE_ACTIVITY"
+	CategoryPayin           = "PAYIN"
+	CategoryPayoutRequest   = "PAYOUT_REQUEST"
+)
+
+const deliveryAttempts = 3
+
+// Delivery records one attempt to deliver a webhook event.
+type Delivery struct {
+	WebhookID     string    `json:"webhookId"`
+	EventID       string    `json:"eventId"`
+	EventCategory string    `json:"eventCategory"`
+	AttemptNumber int       `json:"attemptNumber"`
+	StatusCode    int       `json:"statusCode,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+type webhookEvent struct {
+	EventID       string    `json:"eventId"`
+	DeliveryID    string    `json:"deliveryId"`
+	AttemptNumber int       `json:"attemptNumber"`
+	EventCategory string    `json:"eventCategory"`
+	OccurredAt    time.Time `json:"occurredAt"`
+	Payload       any       `json:"payload"`
+}
+
+type balancePayload struct {
+	Type          string            `json:"type"`
+	AccountID     string            `json:"accountId"`
+	TransactionID string            `json:"transactionId"`
+	TokenAmount   mural.TokenAmount `json:"tokenAmount"`
+}
+
+type payinPayload struct {
+	Type                 string            `json:"type"`
+	PayinID              string            `json:"payinId"`
+	DestinationAccountID string            `json:"destinationAccountId"`
+	Status               string            `json:"payinStatus"`
+	TokenAmount          mural.TokenAmount `json:"tokenAmount"`
+}
+
+type payoutPayload struct {
+	Type            string `json:"type"`
+	PayoutRequestID string `json:"payoutRequestId"`
+	SourceAccountID string `json:"sourceAccountId"`
+	Status          string `json:"status"`
+}
+
+func (s *Server) emitAccountCredited(tx mural.Transaction) {
+	s.emit(CategoryBalanceActivity, balancePayload{
+		Type:          "account_credited",
+		AccountID:     s.cfg.AccountID,
+		TransactionID: tx.ID,
+		TokenAmount:   tx.TokenAmount,
+	})
+}
+
+func (s *Server) emitPayinStatus(p mural.Payin) {
+	s.emit(CategoryPayin, payinPayload{
+		Type:                 "payin_status_changed",
+		PayinID:              p.ID,
+		DestinationAccountID: p.DestinationAccountID,
+		Status:               p.Status,
+		TokenAmount:          p.TokenAmount,
+	})
+}
+
+func (s *Server) emitPayoutStatus(id, status string) {
+	s.emit(CategoryPayoutRequest, payoutPayload{
+		Type:            "payout_request_status_changed",
+		PayoutRequestID: id,
+		SourceAccountID: s.cfg.AccountID,
+		Status:          status,
+	})
+}
+
+// emit delivers an event to every active webhook subscribed to its category.
+// Deliveries run in the background.
+func (s *Server) emit(category string, payload any) {
+	s.mu.Lock()
+	var targets []mural.Webhook
+	for _, wh := range s.webhooks {
+		if wh.Status == "ACTIVE" && slices.Contains(wh.Events, category) {
+			targets = append(targets, *wh)
+		}
+	}
+	s.mu.Unlock()
+
+	ev := webhookEvent{
+		EventID:       newID(),
+		EventCategory: category,
+		OccurredAt:    time.Now().UTC(),
+		Payload:       payload,
+	}
+	for _, wh := range targets {
+		go s.deliver(wh, ev)
+	}
+}
+
+// deliver posts ev to wh, retrying failed attempts with a short backoff.
+func (s *Server) deliver(wh mural.Webhook, ev webhookEvent) {
+	ev.DeliveryID = newID()
+	for attempt := 1; attempt <= deliveryAttempts; attempt++ {
+		ev.AttemptNumber = attempt
+		d := Delivery{
+			WebhookID:     wh.ID,
+			EventID:       ev.EventID,
+			EventCategory: ev.EventCategory,
+			AttemptNumber: attempt,
+			At:            time.Now().UTC(),
+		}
+		status, err := s.post(wh.URL, ev)
+		d.StatusCode = status
+		if err != nil {
+			d.Error = err.Error()
+		}
+		s.mu.Lock()
+		s.deliveries = append(s.deliveries, d)
+		s.mu.Unlock()
+
+		if err == nil {
+			return
+		}
+		logf("deliver %s event %s to %s (attempt %d): %v", ev.EventCategory, ev.EventID, wh.URL, attempt, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (s *Server) post(url string, ev webhookEvent) (int, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().UTC().Format(time.RFC3339)
+	sig, err := s.sign(ts, body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-mural-webhook-signature", sig)
+	req.Header.Set("x-mural-webhook-signature-version", "1")
+	req.Header.Set("x-mural-webhook-timestamp", ts)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// sign returns the base64 ASN.1 ECDSA signature of sha256(timestamp + "." + body),
+// which is what Mural sends in x-mural-webhook-signature.
+func (s *Server) sign(ts string, body []byte) (string, error) {
+	hash := sha256.Sum256([]byte(ts + "." + string(body)))
+	sig, err := s.key.Sign(rand.Reader, hash[:], nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,103 @@
+package payments
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// Detector lists the USDC deposits made to the Mural account. The Ledger
+// attributes them to orders.
+type Detector interface {
+	// Kind is the kind of deposit the detector reports; it is the only kind
+	// the Ledger counts, whether it comes from polling or a webhook.
+	Kind() models.DepositKind
+	// Deposits returns the deposits made since the given time.
+	Deposits(ctx context.Context, since time.Time) ([]*models.Deposit, error)
+}
+
+// PayinDetector uses the Payins API, the canonical deposit signal, and
+// reports each Payin's status so only COMPLETED payins count as received.
+type PayinDetector struct {
+	mural *mural.Client
+}
+
+func NewPayinDetector(muralClient *mural.Client) *PayinDetector {
+	return &PayinDetector{mural: muralClient}
+}
+
+func (d *PayinDetector) Kind() models.DepositKind { return models.DepositKindPayin }
+
+func (d *PayinDetector) Deposits(ctx context.Context, since time.Time) ([]*models.Deposit, error) {
+	filter := mural.PayinFilter{
+		Created:              mural.TimeRange{From: since},
+		DestinationAccountID: d.mural.AccountID(),
+		TokenSymbol:          string(money.USDC),
+	}
+	var out []*models.Deposit
+	for p, err := range d.mural.Payins(ctx, filter) {
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, payinDeposit(p.ID, p.Status, p.TokenAmount.Money()))
+	}
+	return out, nil
+}
+
+// payinDeposit describes a Mural Payin as a deposit.
+func payinDeposit(id, status string, amount money.Money) *models.Deposit {
+	status = strings.ToUpper(status)
+	dep := &models.Deposit{
+		ID:          id,
+		Kind:        models.DepositKindPayin,
+		AmountUSDC:  amount.Amount,
+		PayinStatus: status,
+	}
+	switch status {
+	case mural.PayinStatusCompleted:
+		dep.Status = models.DepositCompleted
+	case mural.PayinStatusFailed:
+		dep.Status = models.DepositFailed
+	default:
+		dep.Status = models.DepositPending
+	}
+	return dep
+}
+
+// TransactionDetector looks for settled USDC deposit transactions on the
+// account. It is kept for sandboxes where Payins search returns no results.
+type TransactionDetector struct {
+	mural *mural.Client
+}
+
+func NewTransactionDetector(muralClient *mural.Client) *TransactionDetector {
+	return &TransactionDetector{mural: muralClient}
+}
+
+func (d *TransactionDetector) Kind() models.DepositKind { return models.DepositKindTransaction }
+
+func (d *TransactionDetector) Deposits(ctx context.Context, since time.Time) ([]*models.Deposit, error) {
+	filter := mural.TransactionFilter{
+		Executed:    mural.TimeRange{From: since},
+		Direction:   mural.DirectionDeposit,
+		Status:      mural.TransactionStatusCompleted,
+		TokenSymbol: string(money.USDC),
+	}
+	var out []*models.Deposit
+	for tx, err := range d.mural.Transactions(ctx, filter) {
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &models.Deposit{
+			ID:         tx.ID,
+			Kind:       models.DepositKindTransaction,
+			AmountUSDC: tx.TokenAmount.Money().Amount,
+			Status:     models.DepositCompleted,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+	"github.com/srypher/mural-challenge-backend/internal/webhooks"
+)
+
+// EventHandlers apply Mural webhook events to orders. Webhooks only speed
+// things up: the payment workflow reaches the same outcome by polling, so
+// events that do not match an order are ignored rather than retried.
+type EventHandlers struct {
+	orders  *models.OrderStore
+	ledger  *Ledger
+	mural   *mural.Client
+	payouts *PayoutTracker
+	refunds *Refunds
+}
+
+func NewEventHandlers(orders *models.OrderStore, ledger *Ledger, refunds *Refunds, muralClient *mural.Client) *EventHandlers {
+	return &EventHandlers{
+		orders:  orders,
+		ledger:  ledger,
+		mural:   muralClient,
+		payouts: NewPayoutTracker(orders, muralClient),
+		refunds: refunds,
+	}
+}
+
+// Register routes the events the handlers understand to them.
+func (h *EventHandlers) Register(d *webhooks.Dispatcher) {
+	d.OnAccountCredited(h.accountCredited)
+	d.OnPayinStatusChanged(h.payinStatusChanged)
+	d.OnPayoutStatusChanged(h.payoutStatusChanged)
+}
+
+// ourAccount reports whether accountID is the Mural account customers pay
+// into. Until the account is known every event is ignored; polling picks up
+// the deposits once it is.
+func (h *EventHandlers) ourAccount(accountID string) bool {
+	return accountID != "" && h.mural != nil && h.mural.AccountID() == accountID
+}
+
+// accountCredited records a USDC credit to the account as a completed
+// deposit. The ledger only counts it when deposits are detected from
+// transactions.
+func (h *EventHandlers) accountCredited(ctx context.Context, e *webhooks.Event, p webhooks.BalanceActivity) error {
+	amount := p.TokenAmount.Money()
+	if !h.ourAccount(p.AccountID) || amount.Currency != money.USDC {
+		return nil
+	}
+	// Prefer the transaction ID so the polling detector recognises the same deposit.
+	depositID := p.TransactionID
+	if depositID == "" {
+		depositID = "webhook:" + e.EventID
+	}
+	return h.ledger.Record(ctx, &models.Deposit{
+		ID:         depositID,
+		Kind:       models.DepositKindTransaction,
+		AmountUSDC: amount.Amount,
+		Status:     models.DepositCompleted,
+	}, models.ActorWebhook)
+}
+
+// payinStatusChanged records a payin and its new status as a deposit.
+func (h *EventHandlers) payinStatusChanged(ctx context.Context, e *webhooks.Event, p webhooks.PayinStatusChanged) error {
+	amount := p.TokenAmount.Money()
+	if p.PayinID == "" || !h.ourAccount(p.DestinationAccountID) || amount.Currency != money.USDC {
+		return nil
+	}
+	// The payin ID is the deposit ID the Payins detector uses too.
+	return h.ledger.Record(ctx, payinDeposit(p.PayinID, p.Status, amount), models.ActorWebhook)
+}
+
+// payoutStatusChanged hands the payout request's new status to the payout
+// tracker, or to the refund processor for a refund's payout request.
+func (h *EventHandlers) payoutStatusChanged(ctx context.Context, e *webhooks.Event, p webhooks.PayoutStatusChanged) error {
+	payoutID, err := uuid.Parse(p.PayoutRequestID)
+	if err != nil {
+		log.Printf("ignoring payout webhook %s with invalid payout request id %q", e.EventID, p.PayoutRequestID)
+		return nil
+	}
+	order, err := h.orders.GetByPayoutRequestID(ctx, payoutID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		_, err := h.refunds.ApplyPayoutStatus(ctx, payoutID, p.Status, models.ActorWebhook)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = h.payouts.Apply(ctx, order, payoutID, p.Status, models.ActorWebhook)
+	return err
+}
@@ -0,0 +1,108 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+const (
+	// DefaultPaymentWindow is how long a customer has to pay a new order.
+	DefaultPaymentWindow = 30 * time.Minute
+	// DefaultSweepInterval is how often the ExpirySweeper runs.
+	DefaultSweepInterval = time.Minute
+
+	sweepBatchSize = 100
+)
+
+// ExpirySweeper moves orders that were not (fully) paid within their payment
+// window to expired. Until models.LatePaymentWindow has passed it keeps
+// polling for deposits to expired orders, which the ledger flags as late
+// payments, so they are not lost when webhooks are disabled.
+type ExpirySweeper struct {
+	orders   *models.OrderStore
+	ledger   *Ledger
+	interval time.Duration
+}
+
+// NewExpirySweeper returns a sweeper running every interval (or
+// DefaultSweepInterval). ledger may be nil to skip looking for late
+// deposits.
+func NewExpirySweeper(orders *models.OrderStore, ledger *Ledger, interval time.Duration) *ExpirySweeper {
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	return &ExpirySweeper{orders: orders, ledger: ledger, interval: interval}
+}
+
+// Run sweeps until ctx is cancelled.
+func (s *ExpirySweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires overdue orders and checks recently expired ones for late
+// deposits once.
+func (s *ExpirySweeper) Sweep(ctx context.Context) {
+	if err := s.expireOverdue(ctx); err != nil {
+		log.Printf("expire overdue orders: %v", err)
+	}
+	if s.ledger == nil {
+		return
+	}
+	if err := s.detectLatePayments(ctx); err != nil {
+		log.Printf("detect late payments: %v", err)
+	}
+}
+
+func (s *ExpirySweeper) expireOverdue(ctx context.Context) error {
+	for {
+		orders, err := s.orders.ListOverdue(ctx, time.Now(), sweepBatchSize)
+		if err != nil {
+			return err
+		}
+		expired := 0
+		for _, o := range orders {
+			err := s.orders.Transition(ctx, o.ID, models.StatusExpired, models.ActorSystem,
+				"payment window elapsed at "+o.ExpiresAt.UTC().Format(time.RFC3339))
+			if errors.Is(err, models.ErrInvalidTransition) {
+				// Paid (or cancelled) in the meantime.
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("expire order %s: %w", o.ID.String(), err)
+			}
+			log.Printf("order %s expired unpaid", o.ID.String())
+			expired++
+		}
+		if len(orders) < sweepBatchSize || expired == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *ExpirySweeper) detectLatePayments(ctx context.Context) error {
+	orders, err := s.orders.ListAwaitingLatePayment(ctx, time.Now().Add(-models.LatePaymentWindow))
+	if err != nil || len(orders) == 0 {
+		return err
+	}
+	since := orders[0].CreatedAt
+	for _, o := range orders[1:] {
+		if o.CreatedAt.Before(since) {
+			since = o.CreatedAt
+		}
+	}
+	return s.ledger.Poll(ctx, since, models.ActorSystem)
+}
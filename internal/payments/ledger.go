@@ -0,0 +1,282 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// DefaultTolerance is how far the amount received may be from an order's
+// amount for the order to count as paid exactly, and how far a deposit may be
+// from an order's balance due to be attributed to it.
+var DefaultTolerance = money.MustParse("0.01")
+
+// Ledger records incoming deposits, attributes them to orders and settles
+// orders from the total they have received.
+//
+// A deposit is attributed to an order the first time it is seen (or changes
+// status), to the first of:
+//
+//   - the one order awaiting payment whose balance due is exactly the
+//     deposit amount (for a new order that is its amount, which includes its
+//     unique payment reference);
+//   - the one order awaiting payment whose balance due is within the
+//     tolerance of the deposit amount;
+//   - the one order awaiting payment whose payment reference is the deposit's
+//     sub-cent digits, which is how an overpayment or the first of several
+//     transfers is recognised;
+//   - the recently expired order holding exactly the deposit amount, as a
+//     late payment.
+//
+// A deposit matching none of these, or one that several awaiting orders fit,
+// stays unmatched until an admin assigns it. Once an order has received its amount give or
+// take the tolerance it is paid; less and it is underpaid and waits for the
+// rest, more and it is overpaid, with the excess owed to the customer.
+type Ledger struct {
+	orders    *models.OrderStore
+	deposits  *models.DepositStore
+	detector  Detector
+	tolerance money.Decimal
+}
+
+// NewLedger returns a Ledger counting deposits of the detector's kind. A
+// negative tolerance falls back to DefaultTolerance.
+func NewLedger(orders *models.OrderStore, deposits *models.DepositStore, detector Detector, tolerance money.Decimal) *Ledger {
+	if tolerance.Sign() < 0 {
+		tolerance = DefaultTolerance
+	}
+	return &Ledger{orders: orders, deposits: deposits, detector: detector, tolerance: tolerance}
+}
+
+// Poll records the deposits the detector reports since the given time.
+func (l *Ledger) Poll(ctx context.Context, since time.Time, actor string) error {
+	deps, err := l.detector.Deposits(ctx, since)
+	if err != nil {
+		return err
+	}
+	for _, dep := range deps {
+		if err := l.Record(ctx, dep, actor); err != nil {
+			return fmt.Errorf("deposit %s: %w", dep.ID, err)
+		}
+	}
+	return nil
+}
+
+// Record stores a deposit, attributes it to an order if it is new and applies
+// it to that order. Deposits of a kind other than the detector's are ignored,
+// so one transfer reported both as a Payin and as a transaction is counted
+// once.
+func (l *Ledger) Record(ctx context.Context, dep *models.Deposit, actor string) error {
+	if dep.Kind != l.detector.Kind() {
+		return nil
+	}
+	changed, err := l.deposits.Record(ctx, dep)
+	if err != nil {
+		return fmt.Errorf("record deposit: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+	if dep.OrderID == uuid.Nil {
+		// Only attribute deposits when they are first seen (or change status),
+		// so one left unmatched is never matched to an order created later.
+		order, matchedBy, err := l.match(ctx, dep)
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			log.Printf("deposit %s of %s matches no order; waiting for an admin to assign it", dep.ID, dep.Amount())
+			return nil
+		}
+		assigned, err := l.deposits.Assign(ctx, dep.ID, order.ID, matchedBy)
+		if errors.Is(err, models.ErrDepositAssigned) {
+			// Assigned concurrently; whoever did so also applied it.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("assign deposit: %w", err)
+		}
+		dep = assigned
+		log.Printf("deposit %s of %s attributed to order %s (%s)", dep.ID, dep.Amount(), order.ID.String(), matchedBy)
+	}
+	return l.apply(ctx, dep, actor)
+}
+
+// Assign attributes an unmatched deposit to an order on an admin's behalf and
+// applies it.
+func (l *Ledger) Assign(ctx context.Context, depositID string, orderID uuid.UUID, actor string) (*models.Deposit, error) {
+	dep, err := l.deposits.Assign(ctx, depositID, orderID, models.MatchAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.apply(ctx, dep, actor); err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+// match finds the order a new deposit pays, if exactly one fits.
+func (l *Ledger) match(ctx context.Context, dep *models.Deposit) (*models.Order, string, error) {
+	candidates, err := l.orders.FindDepositCandidates(ctx, dep.Amount(), l.tolerance)
+	if err != nil {
+		return nil, "", fmt.Errorf("find order for deposit: %w", err)
+	}
+	order, matchedBy, ambiguous := pickOrder(dep.AmountUSDC, candidates, l.tolerance)
+	if order != nil {
+		return order, matchedBy, nil
+	}
+	if ambiguous {
+		log.Printf("deposit %s of %s matches several orders", dep.ID, dep.Amount())
+		return nil, "", nil
+	}
+
+	order, err = l.orders.FindLateByAmount(ctx, dep.Amount())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("find expired order for deposit: %w", err)
+	}
+	return order, models.MatchLate, nil
+}
+
+// pickOrder chooses among orders awaiting payment the one a deposit of amount
+// pays, trying each rule in turn: balance due exactly amount, balance due
+// within tolerance of amount, then payment reference. It returns nil when no
+// rule picks a single order; ambiguous reports that several orders fit, either
+// by one rule or because the tolerance and the reference point at different
+// orders.
+func pickOrder(amount money.Decimal, candidates []*models.Order, tolerance money.Decimal) (order *models.Order, matchedBy string, ambiguous bool) {
+	var exact, near, tagged []*models.Order
+	ref := models.PaymentReferenceOf(amount)
+	for _, o := range candidates {
+		diff := o.AmountUSDC.Sub(o.ReceivedUSDC).Sub(amount).Abs()
+		if diff.IsZero() {
+			exact = append(exact, o)
+		}
+		if !diff.GreaterThan(tolerance) {
+			near = append(near, o)
+		}
+		if o.PaymentReference == ref {
+			tagged = append(tagged, o)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0], models.MatchRemaining, false
+	}
+	if len(near) == 1 {
+		if len(tagged) == 1 && tagged[0] != near[0] {
+			return nil, "", true
+		}
+		return near[0], models.MatchTolerance, false
+	}
+	if len(tagged) == 1 {
+		return tagged[0], models.MatchReference, false
+	}
+	return nil, "", len(exact) > 1 || len(near) > 1 || len(tagged) > 1
+}
+
+// apply updates the order a deposit is attributed to from the order's new
+// total received. Races with other writers (a transition that is no longer
+// allowed, a deposit that already settled the order) are logged and dropped:
+// the order has already moved on.
+func (l *Ledger) apply(ctx context.Context, dep *models.Deposit, actor string) error {
+	err := l.applyToOrder(ctx, dep, actor)
+	switch {
+	case errors.Is(err, models.ErrInvalidTransition),
+		errors.Is(err, models.ErrDepositAlreadyClaimed),
+		errors.Is(err, models.ErrOrderAlreadySettled):
+		log.Printf("deposit %s not applied to order %s: %v", dep.ID, dep.OrderID.String(), err)
+		return nil
+	}
+	return err
+}
+
+func (l *Ledger) applyToOrder(ctx context.Context, dep *models.Deposit, actor string) error {
+	order, err := l.orders.GetByID(ctx, dep.OrderID)
+	if err != nil {
+		return fmt.Errorf("load order: %w", err)
+	}
+	if dep.Kind == models.DepositKindPayin && (order.PayinID != dep.ID || order.PayinStatus != dep.PayinStatus) {
+		if err := l.orders.UpdatePayin(ctx, order.ID, dep.ID, dep.PayinStatus); err != nil {
+			return fmt.Errorf("link payin: %w", err)
+		}
+	}
+
+	reason := fmt.Sprintf("deposit %s of %s %s; received %s of %s",
+		dep.ID, dep.Amount(), dep.Status, order.Received(), order.TotalUSDC())
+	to := l.statusAfter(order, dep)
+	switch to {
+	case "":
+		awaiting := order.Status == models.StatusPendingPayment || order.Status == models.StatusUnderpaid ||
+			order.Status == models.StatusPaymentFailed
+		if dep.Status == models.DepositCompleted && !awaiting {
+			log.Printf("order %s received deposit %s while %s; %s is owed to the customer",
+				order.ID.String(), dep.ID, order.Status, order.BalanceOwedUSDC)
+		}
+		return nil
+	case models.StatusPaymentFailed:
+		return l.orders.Transition(ctx, order.ID, to, actor, reason)
+	case models.StatusUnderpaid:
+		log.Printf("order %s underpaid: %s still due", order.ID.String(), order.BalanceDueUSDC)
+		return l.orders.Transition(ctx, order.ID, to, actor, reason)
+	case models.StatusOverpaid:
+		log.Printf("order %s overpaid: %s owed to the customer", order.ID.String(), order.BalanceOwedUSDC)
+		return l.orders.MarkOverpaid(ctx, order.ID, dep.ID, actor, reason)
+	case models.StatusPaid:
+		log.Printf("order %s paid by deposit %s (%s)", order.ID.String(), dep.ID, actor)
+		return l.orders.MarkPaid(ctx, order.ID, dep.ID, actor, reason)
+	case models.StatusLatePayment:
+		log.Printf("order %s received deposit %s after it expired; flagged late_payment for review", order.ID.String(), dep.ID)
+		return l.orders.MarkLatePayment(ctx, order.ID, dep.ID, actor, reason)
+	}
+	return fmt.Errorf("unexpected status %s after deposit", to)
+}
+
+// statusAfter returns the status a deposit moves its order to, given the
+// order's total received including the deposit, or "" if the order stays as
+// it is. Only completed deposits count towards an order awaiting payment; a
+// failed payin fails an order that has received nothing yet. A deposit for an
+// expired order flags it as a late payment.
+func (l *Ledger) statusAfter(order *models.Order, dep *models.Deposit) models.OrderStatus {
+	switch order.Status {
+	case models.StatusPendingPayment, models.StatusUnderpaid, models.StatusPaymentFailed:
+		if order.ReceivedUSDC.IsZero() {
+			if dep.Status == models.DepositFailed && order.Status == models.StatusPendingPayment {
+				return models.StatusPaymentFailed
+			}
+			return ""
+		}
+		if dep.Status != models.DepositCompleted {
+			return ""
+		}
+		return l.settledStatus(order)
+	case models.StatusExpired:
+		if dep.Status == models.DepositCompleted {
+			return models.StatusLatePayment
+		}
+	}
+	return ""
+}
+
+// settledStatus classifies an order by what it has received against its
+// amount, allowing for the tolerance either way.
+func (l *Ledger) settledStatus(order *models.Order) models.OrderStatus {
+	diff := order.ReceivedUSDC.Sub(order.AmountUSDC)
+	switch {
+	case diff.Neg().GreaterThan(l.tolerance):
+		return models.StatusUnderpaid
+	case diff.GreaterThan(l.tolerance):
+		return models.StatusOverpaid
+	default:
+		return models.StatusPaid
+	}
+}
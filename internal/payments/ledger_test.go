@@ -0,0 +1,213 @@
+package payments
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/workflow"
+)
+
+func TestSettledStatus(t *testing.T) {
+	l := NewLedger(nil, nil, nil, money.MustParse("0.01"))
+	tests := []struct {
+		amount, received string
+		want             models.OrderStatus
+	}{
+		{"100.004321", "100.004321", models.StatusPaid},
+		{"100.004321", "99.994321", models.StatusPaid},
+		{"100.004321", "100.014321", models.StatusPaid},
+		{"100.004321", "99.994320", models.StatusUnderpaid},
+		{"100.004321", "50", models.StatusUnderpaid},
+		{"100.004321", "100.014322", models.StatusOverpaid},
+		{"100.004321", "200", models.StatusOverpaid},
+	}
+	for _, tt := range tests {
+		order := &models.Order{AmountUSDC: money.MustParse(tt.amount), ReceivedUSDC: money.MustParse(tt.received)}
+		if got := l.settledStatus(order); got != tt.want {
+			t.Errorf("received %s of %s: %s, want %s", tt.received, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestSettledStatusExact(t *testing.T) {
+	l := NewLedger(nil, nil, nil, money.Decimal{})
+	order := &models.Order{AmountUSDC: money.MustParse("10.000001"), ReceivedUSDC: money.MustParse("10")}
+	if got := l.settledStatus(order); got != models.StatusUnderpaid {
+		t.Errorf("one micro-USDC short with no tolerance: %s", got)
+	}
+	order.ReceivedUSDC = money.MustParse("10.000001")
+	if got := l.settledStatus(order); got != models.StatusPaid {
+		t.Errorf("exact amount with no tolerance: %s", got)
+	}
+}
+
+func TestNewLedgerDefaultsNegativeTolerance(t *testing.T) {
+	if l := NewLedger(nil, nil, nil, money.MustParse("-1")); !l.tolerance.Equal(DefaultTolerance) {
+		t.Errorf("tolerance = %s, want %s", l.tolerance, DefaultTolerance)
+	}
+}
+
+func TestAwaitPaymentResult(t *testing.T) {
+	tests := []struct {
+		status   models.OrderStatus
+		wantDone bool
+		want     workflow.Result
+	}{
+		{models.StatusPendingPayment, false, workflow.Result{}},
+		{models.StatusUnderpaid, false, workflow.Result{}},
+		{models.StatusPaymentFailed, false, workflow.Result{}},
+		{models.StatusPaid, true, workflow.Next(StepQuote)},
+		{models.StatusOverpaid, true, workflow.Next(StepQuote)},
+		{models.StatusExpired, true, workflow.Complete()},
+		{models.StatusCancelled, true, workflow.Complete()},
+	}
+	for _, tt := range tests {
+		res, done := awaitPaymentResult(&models.Order{Status: tt.status})
+		if done != tt.wantDone || res != tt.want {
+			t.Errorf("%s: %+v, %v; want %+v, %v", tt.status, res, done, tt.want, tt.wantDone)
+		}
+	}
+}
+
+func awaiting(amount, received, ref string) *models.Order {
+	return &models.Order{
+		Status:           models.StatusPendingPayment,
+		AmountUSDC:       money.MustParse(amount),
+		ReceivedUSDC:     money.MustParse(received),
+		PaymentReference: ref,
+	}
+}
+
+func TestPickOrder(t *testing.T) {
+	a := awaiting("1.004321", "0", "4321")
+	b := awaiting("2.007777", "0", "7777")
+	split := awaiting("1.004321", "0.504321", "4321")
+	ten1 := awaiting("10.001234", "0", "1234")
+	ten2 := awaiting("10.005678", "0", "5678")
+	tolerance := money.MustParse("0.01")
+
+	tests := []struct {
+		name          string
+		amount        string
+		candidates    []*models.Order
+		want          *models.Order
+		wantMatchedBy string
+		wantAmbiguous bool
+	}{
+		{"exact amount", "1.004321", []*models.Order{a, b}, a, models.MatchRemaining, false},
+		{"underpaid within tolerance", "0.994321", []*models.Order{a, b}, a, models.MatchTolerance, false},
+		{"overpaid within tolerance", "1.01", []*models.Order{a, b}, a, models.MatchTolerance, false},
+		{"underpaid carrying the reference", "0.504321", []*models.Order{a, b}, a, models.MatchReference, false},
+		{"overpaid carrying the reference", "3.004321", []*models.Order{a, b}, a, models.MatchReference, false},
+		{"tolerance and reference disagree", "2.004321", []*models.Order{a, b}, nil, "", true},
+		{"rest of a split payment", "0.5", []*models.Order{split, b}, split, models.MatchRemaining, false},
+		{"no reference, beyond tolerance", "0.5", []*models.Order{a, b}, nil, "", false},
+		{"no candidates", "1.004321", nil, nil, "", false},
+		{"reference settles a tolerance tie", "10.011234", []*models.Order{ten1, ten2}, ten1, models.MatchReference, false},
+		{"several within tolerance", "10.003", []*models.Order{ten1, ten2}, nil, "", true},
+		{"several carrying the reference", "3.004321", []*models.Order{a, split}, nil, "", true},
+	}
+	for _, tt := range tests {
+		got, matchedBy, ambiguous := pickOrder(money.MustParse(tt.amount), tt.candidates, tolerance)
+		if got != tt.want || matchedBy != tt.wantMatchedBy || ambiguous != tt.wantAmbiguous {
+			t.Errorf("%s: got %v, %q, %v; want %v, %q, %v", tt.name, got, matchedBy, ambiguous,
+				tt.want, tt.wantMatchedBy, tt.wantAmbiguous)
+		}
+	}
+}
+
+// TestDepositsSettleOrder follows an order through the deposits it receives:
+// each one must be attributed to it and leave it in the expected status.
+func TestDepositsSettleOrder(t *testing.T) {
+	l := NewLedger(nil, nil, nil, money.MustParse("0.01"))
+	tests := []struct {
+		name     string
+		deposits []string
+		want     []models.OrderStatus
+	}{
+		{"exact", []string{"1.004321"}, []models.OrderStatus{models.StatusPaid}},
+		{"underpaid within tolerance", []string{"0.995"}, []models.OrderStatus{models.StatusPaid}},
+		{"underpaid, then the rest", []string{"0.904321", "0.1"},
+			[]models.OrderStatus{models.StatusUnderpaid, models.StatusPaid}},
+		{"split in halves", []string{"0.504321", "0.5"},
+			[]models.OrderStatus{models.StatusUnderpaid, models.StatusPaid}},
+		{"overpaid", []string{"2.004321"}, []models.OrderStatus{models.StatusOverpaid}},
+		{"underpaid, then too much", []string{"0.504321", "0.604321"},
+			[]models.OrderStatus{models.StatusUnderpaid, models.StatusOverpaid}},
+	}
+	for _, tt := range tests {
+		order := awaiting("1.004321", "0", "4321")
+		other := awaiting("5.007777", "0", "7777")
+		for i, amount := range tt.deposits {
+			dep := money.MustParse(amount)
+			got, _, _ := pickOrder(dep, []*models.Order{order, other}, l.tolerance)
+			if got != order {
+				t.Errorf("%s: deposit %s not attributed to the order", tt.name, amount)
+				break
+			}
+			order.ReceivedUSDC = order.ReceivedUSDC.Add(dep)
+			if status := l.settledStatus(order); status != tt.want[i] {
+				t.Errorf("%s: after %s received %s: %s, want %s", tt.name, amount, order.ReceivedUSDC, status, tt.want[i])
+			}
+			order.Status = models.StatusUnderpaid
+		}
+	}
+}
+
+func TestPayinDeposit(t *testing.T) {
+	tests := []struct {
+		status string
+		want   models.DepositStatus
+	}{
+		{"COMPLETED", models.DepositCompleted},
+		{"completed", models.DepositCompleted},
+		{"FAILED", models.DepositFailed},
+		{"PENDING", models.DepositPending},
+		{"SOMETHING_NEW", models.DepositPending},
+	}
+	for _, tt := range tests {
+		dep := payinDeposit("payin-1", tt.status, money.NewMoney(money.MustParse("10.5"), money.USDC))
+		if dep.Status != tt.want {
+			t.Errorf("payin %s: deposit %s, want %s", tt.status, dep.Status, tt.want)
+		}
+		if dep.ID != "payin-1" || dep.Kind != models.DepositKindPayin || dep.PayinStatus != strings.ToUpper(tt.status) ||
+			!dep.AmountUSDC.Equal(money.MustParse("10.5")) {
+			t.Errorf("payin %s: %+v", tt.status, dep)
+		}
+	}
+}
+
+func TestStatusAfterDeposit(t *testing.T) {
+	l := NewLedger(nil, nil, nil, money.MustParse("0.01"))
+	tests := []struct {
+		name     string
+		status   models.OrderStatus
+		received string // including the deposit, as recorded
+		deposit  models.DepositStatus
+		want     models.OrderStatus
+	}{
+		{"pending payin", models.StatusPendingPayment, "0", models.DepositPending, ""},
+		{"failed payin", models.StatusPendingPayment, "0", models.DepositFailed, models.StatusPaymentFailed},
+		{"failed payin after a failure", models.StatusPaymentFailed, "0", models.DepositFailed, ""},
+		{"failed payin of an underpaid order", models.StatusUnderpaid, "4", models.DepositFailed, ""},
+		{"completed in full", models.StatusPendingPayment, "10", models.DepositCompleted, models.StatusPaid},
+		{"completed after a failure", models.StatusPaymentFailed, "10", models.DepositCompleted, models.StatusPaid},
+		{"completed in part", models.StatusPendingPayment, "4", models.DepositCompleted, models.StatusUnderpaid},
+		{"completes the rest", models.StatusUnderpaid, "10", models.DepositCompleted, models.StatusPaid},
+		{"completed with excess", models.StatusPendingPayment, "12", models.DepositCompleted, models.StatusOverpaid},
+		{"pending payin of an underpaid order", models.StatusUnderpaid, "4", models.DepositPending, ""},
+		{"completed after expiry", models.StatusExpired, "0", models.DepositCompleted, models.StatusLatePayment},
+		{"pending after expiry", models.StatusExpired, "0", models.DepositPending, ""},
+		{"completed after payment", models.StatusPaid, "20", models.DepositCompleted, ""},
+		{"completed after cancellation", models.StatusCancelled, "10", models.DepositCompleted, ""},
+	}
+	for _, tt := range tests {
+		order := &models.Order{Status: tt.status, AmountUSDC: money.MustParse("10"), ReceivedUSDC: money.MustParse(tt.received)}
+		dep := &models.Deposit{Status: tt.deposit}
+		if got := l.statusAfter(order, dep); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+	"github.com/srypher/mural-challenge-backend/internal/workflow"
+)
+
+// WorkflowKind identifies the order payment lifecycle in workflow_runs.
+const WorkflowKind = "order_payment"
+
+// Steps of the order payment lifecycle, in order.
+const (
+	StepAwaitPayment  = "await_payment"
+	StepQuote         = "quote"
+	StepCreatePayout  = "create_payout"
+	StepExecutePayout = "execute_payout"
+	StepTrackPayout   = "track_payout"
+)
+
+const (
+	// pollInterval is how often a run waiting for payment checks its order.
+	pollInterval = 5 * time.Second
+	// payoutPollInterval is how often a pending payout is checked in case its
+	// webhook never arrives.
+	payoutPollInterval = 30 * time.Second
+)
+
+// Lifecycle implements the wait / quote / payout pipeline for an order as
+// workflow steps so that it survives restarts.
+type Lifecycle struct {
+	orders       *models.OrderStore
+	destinations *models.DestinationStore
+	mural        *mural.Client
+	quoter       *Quoter
+	payouts      *PayoutTracker
+}
+
+func NewLifecycle(orders *models.OrderStore, destinations *models.DestinationStore, muralClient *mural.Client, quoter *Quoter) *Lifecycle {
+	return &Lifecycle{
+		orders:       orders,
+		destinations: destinations,
+		mural:        muralClient,
+		quoter:       quoter,
+		payouts:      NewPayoutTracker(orders, muralClient),
+	}
+}
+
+// Register adds the lifecycle steps to the engine. StepAwaitPayment is
+// registered first so new runs start there.
+func (l *Lifecycle) Register(e *workflow.Engine) {
+	e.Register(WorkflowKind, StepAwaitPayment, l.awaitPayment)
+	e.Register(WorkflowKind, StepQuote, l.quote)
+	e.Register(WorkflowKind, StepCreatePayout, l.createPayout)
+	e.Register(WorkflowKind, StepExecutePayout, l.executePayout)
+	e.Register(WorkflowKind, StepTrackPayout, l.trackPayout)
+	e.OnFailure(WorkflowKind, l.onFailure)
+}
+
+// awaitPayment waits for the DepositPoller (or a webhook) to record the
+// order's payment in the ledger, which marks the order paid (or overpaid)
+// once it has received its amount. A partial payment leaves the order
+// underpaid and the step keeps waiting for the rest; a failed Payin moves it
+// to payment_failed, where it keeps waiting for the customer to pay again.
+// Orders that are never paid are expired by the ExpirySweeper, which ends the
+// run.
+func (l *Lifecycle) awaitPayment(ctx context.Context, run *models.WorkflowRun) (workflow.Result, error) {
+	order, err := l.orders.GetByID(ctx, run.OrderID)
+	if err != nil {
+		return workflow.Result{}, fmt.Errorf("load order: %w", err)
+	}
+	if res, done := awaitPaymentResult(order); done {
+		return res, nil
+	}
+	return workflow.Wait(pollInterval), nil
+}
+
+// awaitPaymentResult reports how the await step ends for an order that is no
+// longer waiting for (the rest of) its payment.
+func awaitPaymentResult(order *models.Order) (workflow.Result, bool) {
+	switch order.Status {
+	case models.StatusPendingPayment, models.StatusUnderpaid, models.StatusPaymentFailed:
+		return workflow.Result{}, false
+	case models.StatusPaid, models.StatusOverpaid:
+		// Possibly marked paid by the webhook before this step ran.
+		return workflow.Next(StepQuote), true
+	default:
+		log.Printf("order %s is %s; nothing left for the payment workflow to do", order.ID.String(), order.Status)
+		return workflow.Complete(), true
+	}
+}
+
+// quote makes sure the order has a valid quote for its payout destination's
+// rail: the one locked at checkout if it has not expired, else a fresh one.
+// A failed quote is retried like any other Mural call; the order is never
+// paid out on a made-up rate.
+func (l *Lifecycle) quote(ctx context.Context, run *models.WorkflowRun) (workflow.Result, error) {
+	order, err := l.orders.GetByID(ctx, run.OrderID)
+	if err != nil {
+		return workflow.Result{}, fmt.Errorf("load order: %w", err)
+	}
+	if payoutCancelled(order) {
+		return workflow.Complete(), nil
+	}
+	dest, err := l.destinationFor(ctx, order)
+	if err != nil {
+		return workflow.Result{}, err
+	}
+	if _, err := l.quoter.Current(ctx, order, dest); err != nil {
+		return workflow.Result{}, muralError("mural quote", err)
+	}
+	return workflow.Next(StepCreatePayout), nil
+}
+
+// createPayout sends the order's payout amount (its total less platform fees)
+// to the order's payout destination (the default destination if none was
+// chosen yet). A payout request that was already recorded on the order is
+// reused so a retried step does not create a second one.
+func (l *Lifecycle) createPayout(ctx context.Context, run *models.WorkflowRun) (workflow.Result, error) {
+	order, err := l.orders.GetByID(ctx, run.OrderID)
+	if err != nil {
+		return workflow.Result{}, fmt.Errorf("load order: %w", err)
+	}
+	if payoutCancelled(order) {
+		return workflow.Complete(), nil
+	}
+	if order.MuralPayoutRequestID != uuid.Nil {
+		if err := l.orders.Transition(ctx, order.ID, models.StatusPayoutCreated, models.ActorWorkflow,
+			"resuming mural payout request "+order.MuralPayoutRequestID.String()); err != nil {
+			return workflow.Result{}, fmt.Errorf("mark payout created: %w", err)
+		}
+		return workflow.Next(StepExecutePayout), nil
+	}
+
+	dest, err := l.destinationFor(ctx, order)
+	if err != nil {
+		return workflow.Result{}, err
+	}
+
+	amount := order.PayoutUSDC()
+	payoutReq := mural.CreatePayoutRequestRequest{
+		SourceAccountID: l.mural.AccountID(),
+		Memo:            "Order " + order.ID.String(),
+		Payouts: []mural.PayoutInfoInput{
+			{
+				Amount:         mural.NewTokenAmount(amount),
+				CounterpartyID: dest.CounterpartyID,
+				PayoutMethodID: dest.PayoutMethodID,
+			},
+		},
+	}
+
+	// The key is derived from the order's payout attempt so a retried step,
+	// even after a restart, can never create a second payout request, while
+	// a payout retried after its request failed gets a new one.
+	key := payoutKey(order, "create")
+	payout, err := l.mural.CreatePayoutRequest(mural.WithIdempotencyKey(ctx, key), payoutReq)
+	if err != nil {
+		return workflow.Result{}, muralError("mural create payout", err)
+	}
+
+	payoutUUID, err := uuid.Parse(payout.ID)
+	if err != nil {
+		return workflow.Result{}, workflow.Permanent(fmt.Errorf("mural returned invalid payout id %q: %w", payout.ID, err))
+	}
+	// persist the payout request ID and initial status on the order. A
+	// refund that changed the payout amount meanwhile leaves this request
+	// unexecuted; the retried step requests the new amount.
+	if err := l.orders.RecordPayoutRequest(ctx, order.ID, payoutUUID, payout.Status, amount); err != nil {
+		return workflow.Result{}, fmt.Errorf("record payout request %s: %w", payout.ID, err)
+	}
+	if err := l.orders.Transition(ctx, order.ID, models.StatusPayoutCreated, models.ActorWorkflow,
+		"created mural payout request "+payout.ID); err != nil {
+		return workflow.Result{}, fmt.Errorf("mark payout created: %w", err)
+	}
+	return workflow.Next(StepExecutePayout), nil
+}
+
+// executePayout executes the order's payout request, strictly at the quoted
+// rate if the market has drifted from the order's locked quote (see
+// Quoter.ToleranceMode). Mural usually reports it PENDING; the order then
+// waits in payout_pending until the payout settles.
+func (l *Lifecycle) executePayout(ctx context.Context, run *models.WorkflowRun) (workflow.Result, error) {
+	order, err := l.orders.GetByID(ctx, run.OrderID)
+	if err != nil {
+		return workflow.Result{}, fmt.Errorf("load order: %w", err)
+	}
+	if order.MuralPayoutRequestID == uuid.Nil {
+		return workflow.Next(StepCreatePayout), nil
+	}
+
+	dest, err := l.destinationFor(ctx, order)
+	if err != nil {
+		return workflow.Result{}, err
+	}
+	mode := l.quoter.ToleranceMode(ctx, order, dest)
+	executed, err := l.mural.ExecutePayoutRequest(mural.WithIdempotencyKey(ctx, payoutKey(order, "execute")),
+		order.MuralPayoutRequestID.String(), mode)
+	if err != nil {
+		return workflow.Result{}, muralError("mural execute payout", err)
+	}
+
+	quoted := "none"
+	if order.Quote != nil {
+		quoted = order.Quote.Fiat().String()
+	}
+	log.Printf("executed payout %s for order %s (payout=%s, quoted=%s, mode=%s, status=%s)",
+		executed.ID, order.ID.String(), order.PayoutUSDC(), quoted, mode, executed.Status)
+	final, err := l.payouts.Apply(ctx, order, order.MuralPayoutRequestID, executed.Status, models.ActorWorkflow)
+	if err != nil {
+		return workflow.Result{}, err
+	}
+	if final {
+		return workflow.Complete(), nil
+	}
+	return workflow.NextAfter(StepTrackPayout, payoutPollInterval), nil
+}
+
+// trackPayout polls the payout request until it reaches a final status. A
+// payout webhook usually gets there first, in which case the order has
+// already left payout_created/payout_pending.
+func (l *Lifecycle) trackPayout(ctx context.Context, run *models.WorkflowRun) (workflow.Result, error) {
+	order, err := l.orders.GetByID(ctx, run.OrderID)
+	if err != nil {
+		return workflow.Result{}, fmt.Errorf("load order: %w", err)
+	}
+	if order.Status != models.StatusPayoutCreated && order.Status != models.StatusPayoutPending {
+		return workflow.Complete(), nil
+	}
+
+	_, final, err := l.payouts.Refresh(ctx, order, models.ActorWorkflow)
+	if err != nil {
+		return workflow.Result{}, err
+	}
+	if final {
+		return workflow.Complete(), nil
+	}
+	return workflow.Wait(payoutPollInterval), nil
+}
+
+// payoutCancelled reports whether an order was cancelled (to be refunded)
+// before its payout was created, which ends the workflow. A payout request
+// created meanwhile is left unexecuted: the order can no longer move to
+// payout_created, and only then is a payout executed.
+func payoutCancelled(order *models.Order) bool {
+	if order.Status != models.StatusCancelled && order.Status != models.StatusRefunded {
+		return false
+	}
+	log.Printf("order %s is %s; not paying it out", order.ID.String(), order.Status)
+	return true
+}
+
+// destinationFor returns the active destination for an order's payout and
+// records it on the order. Without a usable destination the payout cannot
+// proceed, so the error is permanent.
+func (l *Lifecycle) destinationFor(ctx context.Context, order *models.Order) (*models.PayoutDestination, error) {
+	if order.PayoutDestinationID != uuid.Nil {
+		dest, err := l.destinations.GetByID(ctx, order.PayoutDestinationID)
+		if err != nil {
+			return nil, fmt.Errorf("load payout destination: %w", err)
+		}
+		if dest.Status != models.DestinationActive {
+			return nil, workflow.Permanent(fmt.Errorf("payout destination %s: %w", dest.ID, models.ErrDestinationInactive))
+		}
+		return dest, nil
+	}
+
+	dest, err := l.destinations.Default(ctx)
+	if errors.Is(err, models.ErrNoDefaultDestination) {
+		return nil, workflow.Permanent(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load default payout destination: %w", err)
+	}
+	if err := l.orders.SetPayoutDestination(ctx, order.ID, dest.ID); err != nil {
+		return nil, fmt.Errorf("record payout destination: %w", err)
+	}
+	return dest, nil
+}
+
+// payoutKey is the idempotency key for a payout operation on an order's
+// current payout attempt.
+func payoutKey(order *models.Order, op string) string {
+	return fmt.Sprintf("order-%s-payout-%d-%s", order.ID, order.PayoutAttempt, op)
+}
+
+// muralError wraps a failed Mural call, marking terminal 4xx responses (e.g. a
+// 400 for an invalid payout) as permanent so the workflow does not retry them.
+func muralError(msg string, err error) error {
+	err = fmt.Errorf("%s: %w", msg, err)
+	if code := mural.StatusCode(err); code >= 400 && code < 500 && !mural.IsRetryable(err) {
+		return workflow.Permanent(err)
+	}
+	return err
+}
+
+// onFailure moves the order to payout_error when the workflow gives up after
+// the order was paid, so a stalled payout is visible instead of silent.
+func (l *Lifecycle) onFailure(ctx context.Context, run *models.WorkflowRun, cause error) {
+	if run.Step == StepAwaitPayment {
+		return
+	}
+	err := l.orders.Transition(ctx, run.OrderID, models.StatusPayoutError, models.ActorWorkflow,
+		fmt.Sprintf("workflow failed at step %s: %v", run.Step, cause))
+	if err != nil {
+		log.Printf("failed to mark order %s payout_error after workflow failure: %v", run.OrderID.String(), err)
+	}
+}
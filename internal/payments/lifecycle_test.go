@@ -0,0 +1,27 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+func TestPayoutKeyFollowsAttempt(t *testing.T) {
+	order := &models.Order{ID: uuid.New(), PayoutAttempt: 1}
+	create, execute := payoutKey(order, "create"), payoutKey(order, "execute")
+	if create == execute {
+		t.Errorf("create and execute share key %q", create)
+	}
+	if again := payoutKey(order, "create"); again != create {
+		t.Errorf("key not stable: %q, %q", create, again)
+	}
+	order.PayoutAttempt++
+	if retried := payoutKey(order, "create"); retried == create {
+		t.Errorf("retried payout reuses key %q", create)
+	}
+	if other := payoutKey(&models.Order{ID: uuid.New(), PayoutAttempt: 1}, "create"); other == create {
+		t.Errorf("orders share key %q", create)
+	}
+}
@@ -0,0 +1,113 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// PayoutTracker follows an order's payout request to a final status and moves
+// the order along with it: PENDING → payout_pending, EXECUTED → withdrawn,
+// FAILED or CANCELED → payout_error. A failed request is then released from
+// the order, so an admin can retry the payout with a new one. It is fed by
+// payout webhooks and by the payment workflow, which polls Mural in case a
+// webhook never arrives.
+type PayoutTracker struct {
+	orders *models.OrderStore
+	mural  *mural.Client
+}
+
+func NewPayoutTracker(orders *models.OrderStore, muralClient *mural.Client) *PayoutTracker {
+	return &PayoutTracker{orders: orders, mural: muralClient}
+}
+
+// IsFinalPayoutStatus reports whether a Mural payout request status will not
+// change any more.
+func IsFinalPayoutStatus(status string) bool {
+	switch strings.ToUpper(status) {
+	case mural.PayoutStatusExecuted, mural.PayoutStatusFailed, mural.PayoutStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// orderStatusForPayout maps a payout request status to the order status it
+// implies, or "" if it implies none.
+func orderStatusForPayout(status string) models.OrderStatus {
+	switch status {
+	case mural.PayoutStatusPending:
+		return models.StatusPayoutPending
+	case mural.PayoutStatusExecuted:
+		return models.StatusWithdrawn
+	case mural.PayoutStatusFailed, mural.PayoutStatusCanceled:
+		return models.StatusPayoutError
+	}
+	return ""
+}
+
+// Apply records a payout request status reported by Mural on the order and
+// makes the matching status transition. Statuses for a payout request that is
+// no longer the order's, and updates that arrive after the order has moved
+// past them (e.g. a late PENDING after EXECUTED), are ignored. It reports
+// whether the status is final.
+func (t *PayoutTracker) Apply(ctx context.Context, order *models.Order, payoutID uuid.UUID, status, actor string) (bool, error) {
+	status = strings.ToUpper(status)
+	final := IsFinalPayoutStatus(status)
+	if order.MuralPayoutRequestID != payoutID {
+		log.Printf("ignoring status %s of payout %s: it no longer pays out order %s",
+			status, payoutID, order.ID.String())
+		return final, nil
+	}
+
+	to := orderStatusForPayout(status)
+	if to != "" && order.Status != to && !order.Status.CanTransitionTo(to) {
+		log.Printf("ignoring payout %s status %s for order %s in status %s", payoutID, status, order.ID.String(), order.Status)
+		return final, nil
+	}
+	if order.MuralPayoutStatus != status {
+		if err := t.orders.UpdatePayoutMetadata(ctx, order.ID, payoutID, status); err != nil {
+			return false, fmt.Errorf("update payout metadata: %w", err)
+		}
+	}
+	if to == "" {
+		return final, nil
+	}
+
+	err := t.orders.Transition(ctx, order.ID, to, actor, "mural payout status "+status)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		// Another writer moved the order first; its state wins.
+		log.Printf("payout tracker: %v", err)
+		return final, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("mark order %s: %w", to, err)
+	}
+	if to == models.StatusPayoutError {
+		if _, err := t.orders.ReleasePayoutRequest(ctx, order.ID, payoutID); err != nil {
+			return false, fmt.Errorf("release payout request: %w", err)
+		}
+		log.Printf("payout %s for order %s is %s; released for a retry", payoutID, order.ID.String(), status)
+	}
+	return final, nil
+}
+
+// Refresh fetches the order's payout request from Mural and applies its
+// status.
+func (t *PayoutTracker) Refresh(ctx context.Context, order *models.Order, actor string) (*mural.PayoutRequest, bool, error) {
+	if order.MuralPayoutRequestID == uuid.Nil {
+		return nil, false, fmt.Errorf("order %s has no payout request", order.ID.String())
+	}
+	payout, err := t.mural.GetPayoutRequest(ctx, order.MuralPayoutRequestID.String())
+	if err != nil {
+		return nil, false, muralError("mural get payout", err)
+	}
+	final, err := t.Apply(ctx, order, order.MuralPayoutRequestID, payout.Status, actor)
+	return payout, final, err
+}
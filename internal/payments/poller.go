@@ -0,0 +1,57 @@
+package payments
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+// DefaultDepositPollInterval is how often the DepositPoller runs.
+const DefaultDepositPollInterval = 5 * time.Second
+
+// DepositPoller polls for deposits on behalf of every order awaiting payment
+// and records them in the ledger, which attributes them to orders and marks
+// an order paid once it has received its amount. One search covers every
+// open order: it starts from when the oldest of them was created.
+type DepositPoller struct {
+	orders   *models.OrderStore
+	ledger   *Ledger
+	interval time.Duration
+}
+
+// NewDepositPoller returns a poller running every interval (or
+// DefaultDepositPollInterval).
+func NewDepositPoller(orders *models.OrderStore, ledger *Ledger, interval time.Duration) *DepositPoller {
+	if interval <= 0 {
+		interval = DefaultDepositPollInterval
+	}
+	return &DepositPoller{orders: orders, ledger: ledger, interval: interval}
+}
+
+// Run polls until ctx is cancelled.
+func (p *DepositPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("deposit detection error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll records the deposits made since the oldest order awaiting payment was
+// created, if there is one.
+func (p *DepositPoller) Poll(ctx context.Context) error {
+	since, ok, err := p.orders.OldestAwaitingPayment(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	return p.ledger.Poll(ctx, since, models.ActorWorkflow)
+}
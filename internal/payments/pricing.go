@@ -0,0 +1,95 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+)
+
+// feeScale is the precision fees are charged at, so they never touch the
+// sub-cent digits that hold an order's payment reference.
+const feeScale = 2
+
+// PricingConfig is what a Pricer charges on top of a cart subtotal. Rates
+// are fractions (0.02 is 2%); zero disables a fee.
+type PricingConfig struct {
+	// MarkupRate is the merchant's markup on the subtotal.
+	MarkupRate money.Decimal
+	// PassThroughFees charges the customer Mural's fees for converting the
+	// payout to fiat, instead of the merchant absorbing them.
+	PassThroughFees bool
+	// PlatformFeeRate and PlatformFeeUSDC make up the platform fee: a rate on
+	// the subtotal plus markup, and a fixed amount per order.
+	PlatformFeeRate money.Decimal
+	PlatformFeeUSDC money.Decimal
+}
+
+// Pricer works out the fees a customer pays on top of their cart so the
+// merchant receives the subtotal plus markup in full:
+//
+//   - markup: MarkupRate × subtotal;
+//   - conversion: Mural's fees for converting subtotal + markup on the
+//     default payout destination's rail, from the token-to-fiat fees
+//     endpoint;
+//   - platform: PlatformFeeRate × (subtotal + markup) + PlatformFeeUSDC,
+//     which is kept back from the payout.
+//
+// Each fee is rounded to the cent.
+type Pricer struct {
+	quoter       *Quoter
+	destinations *models.DestinationStore
+	cfg          PricingConfig
+}
+
+func NewPricer(quoter *Quoter, destinations *models.DestinationStore, cfg PricingConfig) *Pricer {
+	return &Pricer{quoter: quoter, destinations: destinations, cfg: cfg}
+}
+
+// Price returns the fee breakdown for a cart subtotal. Passing Mural's fees
+// through needs a quote; if one cannot be had the order cannot be priced.
+func (p *Pricer) Price(ctx context.Context, subtotal money.Money) ([]models.FeeLine, error) {
+	fees := []models.FeeLine{}
+	add := func(kind models.FeeKind, description string, amount money.Decimal) {
+		if amount = amount.Round(feeScale); amount.Sign() > 0 {
+			fees = append(fees, models.FeeLine{Kind: kind, Description: description, AmountUSDC: amount})
+		}
+	}
+
+	markup := subtotal.Amount.Mul(p.cfg.MarkupRate)
+	add(models.FeeMarkup, "Merchant markup", markup)
+	base := money.NewMoney(subtotal.Amount.Add(markup.Round(feeScale)), money.USDC)
+
+	if p.cfg.PassThroughFees {
+		fee, rail, err := p.conversionFee(ctx, base)
+		if err != nil {
+			return nil, err
+		}
+		add(models.FeeConversion, "Mural conversion fee ("+rail+")", fee)
+	}
+
+	add(models.FeePlatform, "Platform fee", base.Amount.Mul(p.cfg.PlatformFeeRate).Add(p.cfg.PlatformFeeUSDC))
+	return fees, nil
+}
+
+// conversionFee quotes Mural's fee for paying amount out on the default
+// destination's rail. Without a default destination there is no payout to
+// quote, and no fee.
+func (p *Pricer) conversionFee(ctx context.Context, amount money.Money) (money.Decimal, string, error) {
+	dest, err := p.destinations.Default(ctx)
+	if errors.Is(err, models.ErrNoDefaultDestination) {
+		log.Printf("pricing %s without conversion fees: %v", amount, err)
+		return money.Decimal{}, "", nil
+	}
+	if err != nil {
+		return money.Decimal{}, "", fmt.Errorf("load default payout destination: %w", err)
+	}
+	quote, err := p.quoter.Quote(ctx, amount, dest)
+	if err != nil {
+		return money.Decimal{}, "", fmt.Errorf("quote conversion fees: %w", err)
+	}
+	return quote.FeeUSDC, dest.Rail, nil
+}
@@ -0,0 +1,247 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// DefaultQuoteTTL is how long a quote locked on an order stays valid.
+const DefaultQuoteTTL = 5 * time.Minute
+
+// DefaultMaxRateDrift is how far, as a fraction of the locked rate, the
+// market rate may have moved when a payout is executed for it to be executed
+// at the market rate.
+var DefaultMaxRateDrift = money.MustParse("0.005")
+
+// ErrNoQuote is returned when Mural does not quote a conversion. There is no
+// fallback rate: an order is never paid out on a rate Mural did not give.
+var ErrNoQuote = errors.New("mural returned no quote")
+
+// Quoter fetches USDC→fiat quotes from Mural and locks them on orders. A
+// quote is taken at checkout, so the customer sees what the merchant will
+// receive, and is reused for the payout until it expires.
+type Quoter struct {
+	orders       *models.OrderStore
+	destinations *models.DestinationStore
+	mural        *mural.Client
+	ttl          time.Duration
+	maxDrift     money.Decimal
+}
+
+// NewQuoter returns a Quoter locking quotes for ttl (or DefaultQuoteTTL). A
+// negative maxDrift falls back to DefaultMaxRateDrift.
+func NewQuoter(orders *models.OrderStore, destinations *models.DestinationStore, muralClient *mural.Client, ttl time.Duration, maxDrift money.Decimal) *Quoter {
+	if ttl <= 0 {
+		ttl = DefaultQuoteTTL
+	}
+	if maxDrift.Sign() < 0 {
+		maxDrift = DefaultMaxRateDrift
+	}
+	return &Quoter{orders: orders, destinations: destinations, mural: muralClient, ttl: ttl, maxDrift: maxDrift}
+}
+
+// Quote asks Mural what sending amount to dest yields now.
+func (q *Quoter) Quote(ctx context.Context, amount money.Money, dest *models.PayoutDestination) (*models.FXQuote, error) {
+	res, err := q.tokenToFiat(ctx, amount, dest.Rail)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	quote := &models.FXQuote{
+		Rail:       dest.Rail,
+		Currency:   dest.Currency,
+		Rate:       res.ExchangeRate,
+		FiatAmount: res.EstimatedFiatAmount.Amount,
+		QuotedAt:   now,
+		ExpiresAt:  now.Add(q.ttl),
+	}
+	if res.FeeTotal != nil {
+		quote.FeeUSDC = res.FeeTotal.Money().Amount
+	}
+	return quote, nil
+}
+
+// tokenToFiat asks Mural what sending amount on rail yields now.
+func (q *Quoter) tokenToFiat(ctx context.Context, amount money.Money, rail string) (*mural.TokenToFiatQuoteResult, error) {
+	results, err := q.mural.QuoteTokenToFiat(ctx, amount, rail)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNoQuote
+	}
+	res := results[0]
+	if strings.EqualFold(res.Type, "error") {
+		return nil, fmt.Errorf("%w for %s on %s: %s", ErrNoQuote, amount, rail, res.Message)
+	}
+	if res.ExchangeRate.Sign() <= 0 || res.EstimatedFiatAmount.Amount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w for %s on %s: rate %s", ErrNoQuote, amount, rail, res.ExchangeRate)
+	}
+	return &res, nil
+}
+
+// usdcCent is the precision fiat prices are converted to USDC at, so the
+// converted subtotal leaves the sub-cent digits to the payment reference.
+var usdcCent = money.MustParse("0.01")
+
+// FiatToUSDC converts a fiat cart subtotal to the USDC the customer pays for
+// it: the USDC Mural says must be paid out on the currency's rail for the
+// fiat amount to arrive, less Mural's fees for paying it out, which the
+// Pricer charges (or the merchant absorbs) separately. The USDC amount is
+// rounded up to the cent. The returned pricing records the fiat-to-token
+// rate and Mural's token-to-fiat rate for the USDC amount, which the payout's
+// rate is later checked against.
+func (q *Quoter) FiatToUSDC(ctx context.Context, fiat money.Money) (money.Money, *models.FiatPricing, error) {
+	rail, ok := mural.RailForCurrency(fiat.Currency)
+	if !ok {
+		return money.Money{}, nil, fmt.Errorf("no payout rail for %s", fiat.Currency)
+	}
+	results, err := q.mural.QuoteFiatToToken(ctx, fiat, rail)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+	if len(results) == 0 {
+		return money.Money{}, nil, ErrNoQuote
+	}
+	res := results[0]
+	if strings.EqualFold(res.Type, "error") {
+		return money.Money{}, nil, fmt.Errorf("%w for %s on %s: %s", ErrNoQuote, fiat, rail, res.Message)
+	}
+	required := res.EstimatedTokenAmountRequired.Money()
+	if required.Currency != money.USDC || required.Amount.Sign() <= 0 {
+		return money.Money{}, nil, fmt.Errorf("%w for %s on %s: %s required", ErrNoQuote, fiat, rail, required)
+	}
+	var fee money.Decimal
+	if res.FeeTotal != nil {
+		fee = res.FeeTotal.Money().Amount
+	}
+	usdc, ok := chargeForPayout(required.Amount, fee)
+	if !ok {
+		return money.Money{}, nil, fmt.Errorf("%w for %s on %s: fees exceed the %s required", ErrNoQuote, fiat, rail, required)
+	}
+	subtotal := money.NewMoney(usdc, money.USDC)
+
+	sell, err := q.tokenToFiat(ctx, subtotal, rail)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+	pricing := &models.FiatPricing{
+		Currency:     fiat.Currency,
+		SubtotalFiat: fiat.Amount,
+		Rail:         rail,
+		Rate:         res.ExchangeRate,
+		SellRate:     &sell.ExchangeRate,
+		QuotedAt:     time.Now().UTC(),
+	}
+	return subtotal, pricing, nil
+}
+
+// chargeForPayout returns the USDC to charge for a payout Mural says
+// requires the given USDC, fees included: the fees, which are priced
+// separately, are taken off and the rest is rounded up to the cent. It
+// reports false if nothing is left once the fees are taken off.
+func chargeForPayout(required, fee money.Decimal) (money.Decimal, bool) {
+	usdc := required.Sub(fee)
+	if usdc.Sign() <= 0 {
+		return money.Decimal{}, false
+	}
+	if rounded := usdc.Round(2); rounded.LessThan(usdc) {
+		return rounded.Add(usdcCent), true
+	}
+	return usdc.Round(2), true
+}
+
+// LockAtCheckout locks a quote on a new order for the default payout
+// destination. It returns nil without a default destination; the payout step
+// then fails the order as before.
+func (q *Quoter) LockAtCheckout(ctx context.Context, order *models.Order) (*models.FXQuote, error) {
+	dest, err := q.destinations.Default(ctx)
+	if errors.Is(err, models.ErrNoDefaultDestination) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load default payout destination: %w", err)
+	}
+	return q.lock(ctx, order, dest)
+}
+
+// Current returns the quote to pay an order out to dest with: the order's
+// locked quote while it is valid, else a fresh one, which is locked in its
+// place.
+func (q *Quoter) Current(ctx context.Context, order *models.Order, dest *models.PayoutDestination) (*models.FXQuote, error) {
+	locked := order.Quote
+	if locked != nil && locked.Rail == dest.Rail && !locked.Expired(time.Now()) {
+		return locked, nil
+	}
+	quote, err := q.lock(ctx, order, dest)
+	if err != nil {
+		return nil, err
+	}
+	if locked != nil {
+		log.Printf("re-quoted order %s: rate %s → %s (%s → %s)",
+			order.ID.String(), locked.Rate, quote.Rate, locked.Fiat(), quote.Fiat())
+	}
+	return quote, nil
+}
+
+func (q *Quoter) lock(ctx context.Context, order *models.Order, dest *models.PayoutDestination) (*models.FXQuote, error) {
+	quote, err := q.Quote(ctx, order.PayoutUSDC(), dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.orders.SetQuote(ctx, order.ID, quote); err != nil {
+		return nil, fmt.Errorf("store quote: %w", err)
+	}
+	order.Quote = quote
+	return quote, nil
+}
+
+// ToleranceMode picks the exchangeRateToleranceMode to execute an order's
+// payout with. If the market rate is within the maximum drift of the locked
+// rate the payout may settle at the market rate (FLEXIBLE); if it has moved
+// further, or cannot be checked, the payout must settle at the rate quoted
+// when it was created (STRICT). An order priced in its payout currency is
+// checked against the token-to-fiat rate quoted for it at checkout, however
+// often its payout quote has been renewed since.
+func (q *Quoter) ToleranceMode(ctx context.Context, order *models.Order, dest *models.PayoutDestination) string {
+	if order.Quote == nil {
+		return mural.ExchangeRateStrict
+	}
+	locked := lockedRate(order, dest)
+	market, err := q.Quote(ctx, order.PayoutUSDC(), dest)
+	if err != nil {
+		log.Printf("re-quote order %s before executing payout: %v; executing strictly", order.ID.String(), err)
+		return mural.ExchangeRateStrict
+	}
+	drift := rateDrift(locked, market.Rate)
+	if drift.GreaterThan(q.maxDrift) {
+		log.Printf("order %s rate drifted %s from locked %s to %s; executing strictly",
+			order.ID.String(), drift, locked, market.Rate)
+		return mural.ExchangeRateStrict
+	}
+	return mural.ExchangeRateFlexible
+}
+
+// lockedRate returns the rate an order's payout to dest is checked against:
+// the checkout token-to-fiat rate of an order priced in dest's currency, else
+// the rate of its locked quote, which must be set.
+func lockedRate(order *models.Order, dest *models.PayoutDestination) money.Decimal {
+	if fp := order.FiatPricing; fp != nil && fp.Rail == dest.Rail && fp.SellRate != nil {
+		return *fp.SellRate
+	}
+	return order.Quote.Rate
+}
+
+// rateDrift returns how far market is from locked, as a fraction of locked.
+func rateDrift(locked, market money.Decimal) money.Decimal {
+	return market.Sub(locked).Abs().Div(locked, 10)
+}
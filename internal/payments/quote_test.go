@@ -0,0 +1,78 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/money"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+func TestChargeForPayout(t *testing.T) {
+	tests := []struct {
+		required, fee string
+		want          string // "" when nothing is left to charge
+	}{
+		{"100", "0", "100"},
+		{"100.5", "0.5", "100"},
+		{"100.004321", "0", "100.01"},
+		{"100.011", "1.001", "99.01"},
+		{"99.999999", "0", "100"},
+		{"0.000001", "0", "0.01"},
+		{"1", "1", ""},
+		{"1", "2", ""},
+	}
+	for _, tt := range tests {
+		got, ok := chargeForPayout(money.MustParse(tt.required), money.MustParse(tt.fee))
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("required %s, fee %s: %s, want nothing to charge", tt.required, tt.fee, got)
+		case tt.want != "" && (!ok || !got.Equal(money.MustParse(tt.want))):
+			t.Errorf("required %s, fee %s: %s (%v), want %s", tt.required, tt.fee, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLockedRate(t *testing.T) {
+	mxn := &models.PayoutDestination{Rail: mural.RailMXN, Currency: money.MXN}
+	quote := &models.FXQuote{Rail: mural.RailMXN, Rate: money.MustParse("17.1")}
+	sell := money.MustParse("17.4")
+
+	tests := []struct {
+		name    string
+		pricing *models.FiatPricing
+		want    string
+	}{
+		{"priced in usdc", nil, "17.1"},
+		{"priced in the payout currency", &models.FiatPricing{Rail: mural.RailMXN, Rate: money.MustParse("0.058"), SellRate: &sell}, "17.4"},
+		{"priced in another currency", &models.FiatPricing{Rail: mural.RailBRL, Rate: money.MustParse("0.19"), SellRate: &sell}, "17.1"},
+		{"priced before sell rates were stored", &models.FiatPricing{Rail: mural.RailMXN, Rate: money.MustParse("0.058")}, "17.1"},
+	}
+	for _, tt := range tests {
+		order := &models.Order{Quote: quote, FiatPricing: tt.pricing}
+		if got := lockedRate(order, mxn); !got.Equal(money.MustParse(tt.want)) {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateDrift(t *testing.T) {
+	tests := []struct {
+		locked, market string
+		want           string
+	}{
+		{"20", "20", "0"},
+		{"20", "20.1", "0.005"},
+		{"20", "19.9", "0.005"},
+		{"20", "21", "0.05"},
+	}
+	for _, tt := range tests {
+		got := rateDrift(money.MustParse(tt.locked), money.MustParse(tt.market))
+		if !got.Equal(money.MustParse(tt.want)) {
+			t.Errorf("locked %s, market %s: drift %s, want %s", tt.locked, tt.market, got, tt.want)
+		}
+	}
+	if drift := rateDrift(money.MustParse("20"), money.MustParse("20.1")); drift.GreaterThan(DefaultMaxRateDrift) {
+		t.Errorf("drift %s at the limit exceeds DefaultMaxRateDrift %s", drift, DefaultMaxRateDrift)
+	}
+}
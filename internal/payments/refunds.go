@@ -0,0 +1,269 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// DefaultRefundSweepInterval is how often the Refunds processor retries and
+// tracks open refunds.
+const DefaultRefundSweepInterval = time.Minute
+
+// ErrInvalidRefund is matched by errors for refund requests that can never
+// be paid out, such as a malformed wallet address.
+var ErrInvalidRefund = errors.New("invalid refund")
+
+// Refunds pays refunds back to customers' wallets with Mural blockchain
+// payouts of USDC and follows each payout to a final status. A refund is
+// processed as soon as it is requested; anything that fails transiently (or
+// whose payout webhook never arrives) is picked up by the next sweep. Once an
+// order has been refunded everything it received, it moves to refunded.
+type Refunds struct {
+	refunds  *models.RefundStore
+	orders   *models.OrderStore
+	mural    *mural.Client
+	interval time.Duration
+}
+
+// NewRefunds returns a refund processor sweeping every interval (or
+// DefaultRefundSweepInterval).
+func NewRefunds(refunds *models.RefundStore, orders *models.OrderStore, muralClient *mural.Client, interval time.Duration) *Refunds {
+	if interval <= 0 {
+		interval = DefaultRefundSweepInterval
+	}
+	return &Refunds{refunds: refunds, orders: orders, mural: muralClient, interval: interval}
+}
+
+// Run sweeps until ctx is cancelled.
+func (p *Refunds) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep processes every open refund once.
+func (p *Refunds) Sweep(ctx context.Context) {
+	refunds, err := p.refunds.ListOpen(ctx)
+	if err != nil {
+		log.Printf("list open refunds: %v", err)
+		return
+	}
+	for _, r := range refunds {
+		if err := p.process(ctx, r, models.ActorSystem); err != nil {
+			log.Printf("process refund %s for order %s: %v", r.ID, r.OrderID.String(), err)
+		}
+	}
+}
+
+// Request records a refund and starts paying it out. The refund is returned
+// once recorded: a payout that cannot be made straight away is retried by
+// the sweep, and shows up in the refund's status.
+func (p *Refunds) Request(ctx context.Context, r *models.Refund) error {
+	r.Blockchain = strings.ToUpper(r.Blockchain)
+	if err := refundPayoutDetails(r).Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRefund, err)
+	}
+	if r.AmountUSDC.Sign() <= 0 {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidRefund)
+	}
+	if err := p.refunds.Create(ctx, r); err != nil {
+		return err
+	}
+	log.Printf("refund %s of %s requested for order %s by %s", r.ID, r.Amount(), r.OrderID.String(), r.RequestedBy)
+
+	if err := p.process(ctx, r, models.ActorAdmin); err != nil {
+		log.Printf("process refund %s for order %s: %v", r.ID, r.OrderID.String(), err)
+	}
+	if reloaded, err := p.refunds.GetByID(ctx, r.ID); err == nil {
+		*r = *reloaded
+	}
+	return nil
+}
+
+// ApplyPayoutStatus records the status of the payout request paying out a
+// refund, as reported by a webhook. It reports whether the payout request
+// belongs to a refund.
+func (p *Refunds) ApplyPayoutStatus(ctx context.Context, payoutID uuid.UUID, status, actor string) (bool, error) {
+	r, err := p.refunds.GetByPayoutRequestID(ctx, payoutID)
+	if errors.Is(err, models.ErrRefundNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, p.apply(ctx, r, status, actor)
+}
+
+// process moves a refund on by one step: a requested refund has its payout
+// request created (once) and executed; a processing one has its payout
+// request's status checked.
+func (p *Refunds) process(ctx context.Context, r *models.Refund, actor string) error {
+	switch r.Status {
+	case models.RefundRequested:
+		return p.payOut(ctx, r, actor)
+	case models.RefundProcessing:
+		payout, err := p.mural.GetPayoutRequest(ctx, r.MuralPayoutRequestID.String())
+		if err != nil {
+			return fmt.Errorf("mural get payout: %w", err)
+		}
+		return p.apply(ctx, r, payout.Status, actor)
+	}
+	return nil
+}
+
+func (p *Refunds) payOut(ctx context.Context, r *models.Refund, actor string) error {
+	if r.MuralPayoutRequestID == uuid.Nil {
+		order, err := p.orders.GetByID(ctx, r.OrderID)
+		if err != nil {
+			return fmt.Errorf("load order: %w", err)
+		}
+		req := mural.CreatePayoutRequestRequest{
+			SourceAccountID: p.mural.AccountID(),
+			Memo:            "Refund for order " + order.ID.String(),
+			Payouts: []mural.PayoutInfoInput{
+				{
+					Amount:        mural.NewTokenAmount(r.Amount()),
+					PayoutDetails: refundPayoutDetails(r),
+					RecipientInfo: refundRecipient(order),
+				},
+			},
+		}
+		// As for order payouts, the key is derived from the refund so a
+		// retry can never create a second payout request.
+		payout, err := p.mural.CreatePayoutRequest(mural.WithIdempotencyKey(ctx, refundKey(r.ID, "create")), req)
+		if err != nil {
+			return p.failIfPermanent(ctx, r, "mural create payout", err)
+		}
+		payoutID, err := uuid.Parse(payout.ID)
+		if err != nil {
+			return p.fail(ctx, r, "", fmt.Sprintf("mural returned invalid payout id %q", payout.ID))
+		}
+		if err := p.refunds.SetPayout(ctx, r.ID, payoutID, payout.Status); err != nil {
+			return fmt.Errorf("store refund payout: %w", err)
+		}
+		r.MuralPayoutRequestID, r.MuralPayoutStatus = payoutID, payout.Status
+	}
+
+	executed, err := p.mural.ExecutePayoutRequest(mural.WithIdempotencyKey(ctx, refundKey(r.ID, "execute")),
+		r.MuralPayoutRequestID.String(), mural.ExchangeRateFlexible)
+	if err != nil {
+		return p.failIfPermanent(ctx, r, "mural execute payout", err)
+	}
+	log.Printf("executed refund payout %s for refund %s (status %s)", executed.ID, r.ID, executed.Status)
+	if _, err := p.refunds.UpdateStatus(ctx, r.ID, models.RefundProcessing, executed.Status, ""); err != nil {
+		return fmt.Errorf("mark refund processing: %w", err)
+	}
+	r.Status = models.RefundProcessing
+	return p.apply(ctx, r, executed.Status, actor)
+}
+
+// apply records a payout request status on a refund: EXECUTED completes it,
+// FAILED or CANCELED fail it, anything else leaves it processing.
+func (p *Refunds) apply(ctx context.Context, r *models.Refund, status, actor string) error {
+	status = strings.ToUpper(status)
+	switch status {
+	case mural.PayoutStatusExecuted:
+		updated, err := p.refunds.UpdateStatus(ctx, r.ID, models.RefundCompleted, status, "")
+		if err != nil || !updated {
+			return err
+		}
+		log.Printf("refund %s of %s for order %s completed", r.ID, r.Amount(), r.OrderID.String())
+		return p.settleOrder(ctx, r.OrderID, actor)
+	case mural.PayoutStatusFailed, mural.PayoutStatusCanceled:
+		return p.fail(ctx, r, status, "mural payout "+r.MuralPayoutRequestID.String()+" "+status)
+	}
+	if r.Status == models.RefundProcessing && r.MuralPayoutStatus != status {
+		_, err := p.refunds.UpdateStatus(ctx, r.ID, models.RefundProcessing, status, "")
+		return err
+	}
+	return nil
+}
+
+// settleOrder moves an order to refunded once everything it received has
+// been refunded and no refund is still open.
+func (p *Refunds) settleOrder(ctx context.Context, orderID uuid.UUID, actor string) error {
+	order, err := p.orders.GetByID(ctx, orderID)
+	if err != nil {
+		return fmt.Errorf("load order: %w", err)
+	}
+	if order.ReceivedUSDC.IsZero() || order.RefundedUSDC.LessThan(order.ReceivedUSDC) ||
+		!order.Status.CanTransitionTo(models.StatusRefunded) {
+		return nil
+	}
+	refunds, err := p.refunds.ListByOrder(ctx, orderID)
+	if err != nil {
+		return fmt.Errorf("list refunds: %w", err)
+	}
+	for _, r := range refunds {
+		if r.Status == models.RefundRequested || r.Status == models.RefundProcessing {
+			return nil
+		}
+	}
+	err = p.orders.Transition(ctx, orderID, models.StatusRefunded, actor,
+		fmt.Sprintf("refunded %s of %s received", order.RefundedUSDC, order.Received()))
+	if errors.Is(err, models.ErrInvalidTransition) {
+		log.Printf("order %s not marked refunded: %v", orderID.String(), err)
+		return nil
+	}
+	return err
+}
+
+// failIfPermanent fails the refund when Mural rejected the payout outright
+// (a 4xx that retrying cannot fix) and otherwise returns the error for the
+// sweep to retry.
+func (p *Refunds) failIfPermanent(ctx context.Context, r *models.Refund, msg string, err error) error {
+	err = fmt.Errorf("%s: %w", msg, err)
+	if code := mural.StatusCode(err); code >= 400 && code < 500 && !mural.IsRetryable(err) {
+		return p.fail(ctx, r, "", err.Error())
+	}
+	return err
+}
+
+func (p *Refunds) fail(ctx context.Context, r *models.Refund, payoutStatus, reason string) error {
+	updated, err := p.refunds.UpdateStatus(ctx, r.ID, models.RefundFailed, payoutStatus, reason)
+	if err != nil {
+		return fmt.Errorf("mark refund failed: %w", err)
+	}
+	if updated {
+		log.Printf("refund %s for order %s failed: %s", r.ID, r.OrderID.String(), reason)
+	}
+	return nil
+}
+
+func refundPayoutDetails(r *models.Refund) mural.BlockchainPayoutDetails {
+	return mural.BlockchainPayoutDetails{
+		WalletDetails: mural.WalletDetails{WalletAddress: r.WalletAddress, Blockchain: r.Blockchain},
+	}
+}
+
+// refundRecipient describes the customer receiving a refund, from the name
+// and email on their order.
+func refundRecipient(order *models.Order) *mural.IndividualRecipientInfo {
+	first, last, _ := strings.Cut(strings.TrimSpace(order.CustomerName), " ")
+	return &mural.IndividualRecipientInfo{
+		Type:      "individual",
+		FirstName: first,
+		LastName:  strings.TrimSpace(last),
+		Email:     order.CustomerEmail,
+	}
+}
+
+func refundKey(refundID uuid.UUID, op string) string {
+	return "refund-" + refundID.String() + "-payout-" + op
+}
@@ -0,0 +1,148 @@
+// Package pubsub tells subscribers in this process when an order has
+// changed, whichever replica changed it.
+package pubsub
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	listenRetryMin = time.Second
+	listenRetryMax = 30 * time.Second
+)
+
+// Broker fans order change notifications out to subscribers. It is fed
+// in-process by the order store (OrderStore.OnEvent) and, through Listen, by
+// Postgres notifications on a channel every replica notifies on.
+//
+// A notification carries no data: it only wakes the order's subscribers,
+// which then read what changed from the database. Duplicate or coalesced
+// notifications are therefore harmless, and nothing is lost while a
+// subscriber is busy.
+type Broker struct {
+	mu       sync.Mutex
+	subs     map[uuid.UUID]map[chan struct{}]struct{}
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: map[uuid.UUID]map[chan struct{}]struct{}{}, done: make(chan struct{})}
+}
+
+// Shutdown tells subscribers to stop, e.g. so the HTTP server can close
+// long-lived streams when shutting down.
+func (b *Broker) Shutdown() {
+	b.shutdown.Do(func() { close(b.done) })
+}
+
+// Done is closed once Shutdown has been called.
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Subscribe returns a channel that receives a value whenever the order may
+// have changed since the last receive, and a function to unsubscribe.
+func (b *Broker) Subscribe(orderID uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	if b.subs[orderID] == nil {
+		b.subs[orderID] = map[chan struct{}]struct{}{}
+	}
+	b.subs[orderID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[orderID], ch)
+		if len(b.subs[orderID]) == 0 {
+			delete(b.subs, orderID)
+		}
+	}
+}
+
+// Publish wakes the order's subscribers. It never blocks.
+func (b *Broker) Publish(orderID uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[orderID] {
+		wake(ch)
+	}
+}
+
+// publishAll wakes every subscriber, after notifications may have been missed.
+func (b *Broker) publishAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subs := range b.subs {
+		for ch := range subs {
+			wake(ch)
+		}
+	}
+}
+
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Listen publishes the order IDs notified on channel until ctx is cancelled.
+// It holds one pooled connection, and reconnects with backoff when it is
+// lost; as notifications sent meanwhile are gone, every subscriber is woken
+// after reconnecting.
+func (b *Broker) Listen(ctx context.Context, pool *pgxpool.Pool, channel string) {
+	retry := listenRetryMin
+	for {
+		err := b.listen(ctx, pool, channel, func() { retry = listenRetryMin })
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listen on %s: %v; reconnecting in %s", channel, err, retry)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(2*retry, listenRetryMax)
+	}
+}
+
+func (b *Broker) listen(ctx context.Context, pool *pgxpool.Pool, channel string, connected func()) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection is left in LISTEN mode, so it is taken out of the pool
+	// rather than returned to it.
+	conn := pooled.Hijack()
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	connected()
+	b.publishAll()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(n.Payload)
+		if err != nil {
+			log.Printf("ignoring %s notification with payload %q", channel, n.Payload)
+			continue
+		}
+		b.Publish(id)
+	}
+}
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func woken(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestPublishWakesTheOrdersSubscribers(t *testing.T) {
+	b := NewBroker()
+	order, other := uuid.New(), uuid.New()
+	first, unsubFirst := b.Subscribe(order)
+	defer unsubFirst()
+	second, unsubSecond := b.Subscribe(order)
+	defer unsubSecond()
+	elsewhere, unsubElsewhere := b.Subscribe(other)
+	defer unsubElsewhere()
+
+	b.Publish(order)
+	if !woken(first) || !woken(second) {
+		t.Error("subscriber of the order not woken")
+	}
+	if woken(elsewhere) {
+		t.Error("subscriber of another order woken")
+	}
+}
+
+func TestPublishCoalescesAndNeverBlocks(t *testing.T) {
+	b := NewBroker()
+	order := uuid.New()
+	ch, unsubscribe := b.Subscribe(order)
+	defer unsubscribe()
+
+	for range 3 {
+		b.Publish(order)
+	}
+	if !woken(ch) {
+		t.Fatal("not woken")
+	}
+	if woken(ch) {
+		t.Error("woken once per publish; want notifications coalesced")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBroker()
+	order := uuid.New()
+	ch, unsubscribe := b.Subscribe(order)
+	unsubscribe()
+
+	b.Publish(order)
+	if woken(ch) {
+		t.Error("woken after unsubscribing")
+	}
+	if len(b.subs) != 0 {
+		t.Errorf("%d orders still tracked after their last subscriber left", len(b.subs))
+	}
+}
+
+func TestPublishAll(t *testing.T) {
+	b := NewBroker()
+	first, unsubFirst := b.Subscribe(uuid.New())
+	defer unsubFirst()
+	second, unsubSecond := b.Subscribe(uuid.New())
+	defer unsubSecond()
+
+	b.publishAll()
+	if !woken(first) || !woken(second) {
+		t.Error("publishAll did not wake every subscriber")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	b := NewBroker()
+	select {
+	case <-b.Done():
+		t.Fatal("done before Shutdown")
+	default:
+	}
+	b.Shutdown()
+	b.Shutdown()
+	select {
+	case <-b.Done():
+	default:
+		t.Error("not done after Shutdown")
+	}
+}
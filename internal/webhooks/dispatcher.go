@@ -0,0 +1,88 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// EventLog persists the IDs of processed events so redeliveries are dropped.
+type EventLog interface {
+	// Claim records the event, reporting false if it was already recorded.
+	Claim(ctx context.Context, eventID, category, payloadType string, occurredAt time.Time) (bool, error)
+	// Release forgets a claimed event so a redelivery is processed again.
+	Release(ctx context.Context, eventID string) error
+}
+
+// HandlerFunc processes one event. Returning an error releases the event so
+// Mural's redelivery is processed again.
+type HandlerFunc func(ctx context.Context, e *Event) error
+
+// Dispatcher routes events to the handler registered for their category and
+// payload type.
+type Dispatcher struct {
+	events   EventLog
+	handlers map[string]HandlerFunc
+}
+
+func NewDispatcher(events EventLog) *Dispatcher {
+	return &Dispatcher{events: events, handlers: map[string]HandlerFunc{}}
+}
+
+// Handle registers fn for events of the given category and payload type.
+func (d *Dispatcher) Handle(category, payloadType string, fn HandlerFunc) {
+	d.handlers[category+"/"+payloadType] = fn
+}
+
+// OnAccountCredited registers fn for USDC credited to a Mural account.
+func (d *Dispatcher) OnAccountCredited(fn func(context.Context, *Event, BalanceActivity) error) {
+	d.Handle(CategoryBalanceActivity, TypeAccountCredited, typed(fn))
+}
+
+// OnPayinStatusChanged registers fn for payin status changes.
+func (d *Dispatcher) OnPayinStatusChanged(fn func(context.Context, *Event, PayinStatusChanged) error) {
+	d.Handle(CategoryPayin, TypePayinStatusChanged, typed(fn))
+}
+
+// OnPayoutStatusChanged registers fn for payout request status changes.
+func (d *Dispatcher) OnPayoutStatusChanged(fn func(context.Context, *Event, PayoutStatusChanged) error) {
+	d.Handle(CategoryPayoutRequest, TypePayoutStatusChanged, typed(fn))
+}
+
+func typed[T any](fn func(context.Context, *Event, T) error) HandlerFunc {
+	return func(ctx context.Context, e *Event) error {
+		var payload T
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		return fn(ctx, e, payload)
+	}
+}
+
+// Dispatch runs the handler for e unless the event was already processed.
+// Events nobody handles are ignored.
+func (d *Dispatcher) Dispatch(ctx context.Context, e *Event) error {
+	fn, ok := d.handlers[e.EventCategory+"/"+e.PayloadType]
+	if !ok {
+		log.Printf("ignoring mural webhook event %s (%s/%s)", e.EventID, e.EventCategory, e.PayloadType)
+		return nil
+	}
+
+	first, err := d.events.Claim(ctx, e.EventID, e.EventCategory, e.PayloadType, e.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("record webhook event %s: %w", e.EventID, err)
+	}
+	if !first {
+		log.Printf("dropping duplicate mural webhook event %s (delivery %s, attempt %d)", e.EventID, e.DeliveryID, e.AttemptNumber)
+		return nil
+	}
+
+	if err := fn(ctx, e); err != nil {
+		if rerr := d.events.Release(ctx, e.EventID); rerr != nil {
+			log.Printf("failed to release webhook event %s after handler error: %v", e.EventID, rerr)
+		}
+		return fmt.Errorf("handle %s/%s event %s: %w", e.EventCategory, e.PayloadType, e.EventID, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package webhooks receives Mural webhook events: it verifies their
+// signatures, decodes them into typed payloads, drops redeliveries and routes
+// each event to the handler registered for it.
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/srypher/mural-challenge-backend/internal/mural"
+)
+
+// Event categories, as subscribed to when creating a Mural webhook.
+const (
+	CategoryBalanceActivity = "MURAL_ACCOUNT_BALANCE_ACTIVITY"
+	CategoryPayin           = "PAYIN"
+	CategoryPayoutRequest   = "PAYOUT_REQUEST"
+)
+
+// Categories lists every category the backend handles.
+var Categories = []string{CategoryBalanceActivity, CategoryPayin, CategoryPayoutRequest}
+
+// Payload types within the categories.
+const (
+	TypeAccountCredited     = "account_credited"
+	TypeAccountDebited      = "account_debited"
+	TypePayinStatusChanged  = "payin_status_changed"
+	TypePayoutStatusChanged = "payout_request_status_changed"
+)
+
+// Event is the envelope Mural posts for every webhook delivery. EventID is
+// stable across redeliveries of the same event; DeliveryID is not.
+type Event struct {
+	EventID       string          `json:"eventId"`
+	DeliveryID    string          `json:"deliveryId"`
+	AttemptNumber int             `json:"attemptNumber"`
+	EventCategory string          `json:"eventCategory"`
+	OccurredAt    time.Time       `json:"occurredAt"`
+	Payload       json.RawMessage `json:"payload"`
+
+	// PayloadType is the payload's "type" field.
+	PayloadType string `json:"-"`
+}
+
+// BalanceActivity is the payload of MURAL_ACCOUNT_BALANCE_ACTIVITY events.
+type BalanceActivity struct {
+	Type          string            `json:"type"`
+	AccountID     string            `json:"accountId"`
+	TransactionID string            `json:"transactionId"`
+	TokenAmount   mural.TokenAmount `json:"tokenAmount"`
+}
+
+// PayinStatusChanged is the payload of PAYIN events.
+type PayinStatusChanged struct {
+	Type                 string            `json:"type"`
+	PayinID              string            `json:"payinId"`
+	DestinationAccountID string            `json:"destinationAccountId"`
+	Status               string            `json:"payinStatus"`
+	TokenAmount          mural.TokenAmount `json:"tokenAmount"`
+}
+
+// PayoutStatusChanged is the payload of PAYOUT_REQUEST events.
+type PayoutStatusChanged struct {
+	Type            string `json:"type"`
+	PayoutRequestID string `json:"payoutRequestId"`
+	SourceAccountID string `json:"sourceAccountId"`
+	Status          string `json:"status"`
+}
+
+// ErrMalformedEvent is returned by Parse for bodies that are not a Mural
+// webhook event.
+var ErrMalformedEvent = errors.New("malformed webhook event")
+
+// Parse decodes a webhook request body.
+func Parse(body []byte) (*Event, error) {
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	if e.EventID == "" || e.EventCategory == "" {
+		return nil, fmt.Errorf("%w: eventId and eventCategory are required", ErrMalformedEvent)
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	if len(e.Payload) > 0 {
+		if err := json.Unmarshal(e.Payload, &head); err != nil {
+			return nil, fmt.Errorf("%w: payload: %v", ErrMalformedEvent, err)
+		}
+	}
+	e.PayloadType = head.Type
+	return &e, nil
+}
+
+// Decode unmarshals the event payload into v.
+func (e *Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("%w: %s/%s payload: %v", ErrMalformedEvent, e.EventCategory, e.PayloadType, err)
+	}
+	return nil
+}
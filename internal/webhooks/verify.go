@@ -0,0 +1,104 @@
+package webhooks
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signature headers Mural sends with every delivery.
+const (
+	SignatureHeader        = "x-mural-webhook-signature"
+	SignatureVersionHeader = "x-mural-webhook-signature-version"
+	TimestampHeader        = "x-mural-webhook-timestamp"
+)
+
+// DefaultMaxAge is how far a delivery's timestamp may be from our clock.
+const DefaultMaxAge = 5 * time.Minute
+
+var (
+	ErrMissingSignature = errors.New("missing webhook signature headers")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp outside the accepted window")
+)
+
+// Verifier checks webhook signatures against Mural's public key. The key is
+// parsed once, when the verifier is created.
+type Verifier struct {
+	key    *ecdsa.PublicKey
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewVerifier parses a PEM-encoded ECDSA public key. Deliveries whose
+// timestamp is more than maxAge away from now are rejected as replays; a
+// non-positive maxAge uses DefaultMaxAge.
+func NewVerifier(publicKeyPEM string, maxAge time.Duration) (*Verifier, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, errors.New("webhook public key is not PEM encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse webhook public key: %w", err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("webhook public key is %T, want ECDSA", pub)
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	return &Verifier{key: key, maxAge: maxAge, now: time.Now}, nil
+}
+
+// Verify checks that body was signed by Mural at a recent timestamp. The
+// signature is an ASN.1 ECDSA signature over sha256(timestamp + "." + body).
+func (v *Verifier) Verify(h http.Header, body []byte) error {
+	sigB64 := h.Get(SignatureHeader)
+	ts := h.Get(TimestampHeader)
+	if sigB64 == "" || h.Get(SignatureVersionHeader) == "" || ts == "" {
+		return ErrMissingSignature
+	}
+
+	at, err := parseTimestamp(ts)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if age := v.now().Sub(at); age > v.maxAge || age < -v.maxAge {
+		return fmt.Errorf("%w: %s", ErrStaleTimestamp, ts)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		return fmt.Errorf("%w: bad encoding", ErrInvalidSignature)
+	}
+	hash := sha256.Sum256([]byte(ts + "." + string(body)))
+	if !ecdsa.VerifyASN1(v.key, hash[:], sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// parseTimestamp accepts RFC 3339 timestamps and unix times in seconds or
+// milliseconds.
+func parseTimestamp(ts string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		return t, nil
+	}
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognised timestamp %q", ts)
+	}
+	if n > 1e12 {
+		return time.UnixMilli(n), nil
+	}
+	return time.Unix(n, 0), nil
+}
@@ -0,0 +1,324 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+// StepFunc executes one step of a workflow run. It returns the Result that
+// decides what happens next, or an error to retry the same step with backoff.
+type StepFunc func(ctx context.Context, run *models.WorkflowRun) (Result, error)
+
+// FailureFunc is called once when a run of its kind fails permanently.
+type FailureFunc func(ctx context.Context, run *models.WorkflowRun, cause error)
+
+// Result tells the engine how to proceed after a step succeeded.
+type Result struct {
+	next  string
+	delay time.Duration
+	done  bool
+}
+
+// Next advances the run to step, executing it as soon as possible.
+func Next(step string) Result {
+	return Result{next: step}
+}
+
+// NextAfter advances the run to step and schedules it after delay.
+func NextAfter(step string, delay time.Duration) Result {
+	return Result{next: step, delay: delay}
+}
+
+// Wait keeps the run on its current step and re-runs it after delay without
+// counting an attempt. It is meant for polling steps that are not failing.
+func Wait(delay time.Duration) Result {
+	return Result{delay: delay}
+}
+
+// Complete finishes the run successfully.
+func Complete() Result {
+	return Result{done: true}
+}
+
+// permanentError marks an error as non-retryable.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the engine fails the run instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Config controls polling and retry behaviour of the Engine.
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 10
+	}
+	if c.Lease <= 0 {
+		c.Lease = 2 * time.Minute
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 8
+	}
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = 2 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+}
+
+// Engine drives persisted workflow runs. Because every transition is written
+// to Postgres before the next step runs, a restarted process resumes each run
+// from its last recorded step when Run is called on boot.
+type Engine struct {
+	store *models.WorkflowStore
+	cfg   Config
+
+	mu    sync.RWMutex
+	steps map[string]map[string]StepFunc // kind -> step -> func
+	first map[string]string              // kind -> initial step
+	fail  map[string]FailureFunc         // kind -> failure hook
+
+	wake chan struct{}
+}
+
+func NewEngine(store *models.WorkflowStore, cfg Config) *Engine {
+	cfg.setDefaults()
+	return &Engine{
+		store: store,
+		cfg:   cfg,
+		steps: map[string]map[string]StepFunc{},
+		first: map[string]string{},
+		fail:  map[string]FailureFunc{},
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Register adds a step implementation for a workflow kind. The first step
+// registered for a kind is the one new runs start at.
+func (e *Engine) Register(kind, step string, fn StepFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.steps[kind] == nil {
+		e.steps[kind] = map[string]StepFunc{}
+		e.first[kind] = step
+	}
+	e.steps[kind][step] = fn
+}
+
+// OnFailure registers a hook invoked when a run of kind fails permanently,
+// either through Permanent or by exhausting its attempts.
+func (e *Engine) OnFailure(kind string, fn FailureFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fail[kind] = fn
+}
+
+// NewRun returns an unsaved run of kind at its first step, for callers that
+// persist it together with its order (see models.OrderStore.Create). Call
+// Notify once it is committed.
+func (e *Engine) NewRun(kind string, orderID uuid.UUID) (*models.WorkflowRun, error) {
+	e.mu.RLock()
+	step, ok := e.first[kind]
+	e.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("workflow kind %q has no registered steps", kind)
+	}
+	return &models.WorkflowRun{Kind: kind, OrderID: orderID, Step: step}, nil
+}
+
+// Start persists a new run of kind for the order and wakes the engine. It is
+// a no-op if a run of that kind already exists for the order.
+func (e *Engine) Start(ctx context.Context, kind string, orderID uuid.UUID) error {
+	run, err := e.NewRun(kind, orderID)
+	if err != nil {
+		return err
+	}
+	if err := e.store.Create(ctx, run); err != nil {
+		if errors.Is(err, models.ErrWorkflowExists) {
+			return nil
+		}
+		return err
+	}
+	e.Notify()
+	return nil
+}
+
+// Resume restarts the order's finished run of kind at step, for example once
+// an admin has resolved what stopped it. It returns models.ErrWorkflowRunning
+// if the run is still in progress.
+func (e *Engine) Resume(ctx context.Context, kind string, orderID uuid.UUID, step string) error {
+	e.mu.RLock()
+	_, ok := e.steps[kind][step]
+	e.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("workflow kind %q has no step %q", kind, step)
+	}
+	if err := e.store.Reopen(ctx, kind, orderID, step); err != nil {
+		return err
+	}
+	e.Notify()
+	return nil
+}
+
+// RunsForOrder returns every run recorded for the order, for diagnostics.
+func (e *Engine) RunsForOrder(ctx context.Context, orderID uuid.UUID) ([]*models.WorkflowRun, error) {
+	return e.store.ListByOrder(ctx, orderID)
+}
+
+// Notify asks the engine to poll for due runs immediately.
+func (e *Engine) Notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls for due runs until ctx is cancelled. In-flight steps are allowed
+// to finish before Run returns.
+func (e *Engine) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(e.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		runs, err := e.store.ClaimDue(ctx, e.cfg.BatchSize, e.cfg.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("workflow: claim due runs: %v", err)
+		}
+		for _, run := range runs {
+			wg.Add(1)
+			go func(run *models.WorkflowRun) {
+				defer wg.Done()
+				e.execute(ctx, run)
+			}(run)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+func (e *Engine) execute(ctx context.Context, run *models.WorkflowRun) {
+	e.mu.RLock()
+	fn := e.steps[run.Kind][run.Step]
+	onFail := e.fail[run.Kind]
+	e.mu.RUnlock()
+
+	// Persisting the outcome must survive shutdown of the polling context.
+	storeCtx := context.WithoutCancel(ctx)
+
+	if fn == nil {
+		msg := fmt.Sprintf("no step %q registered for workflow kind %q", run.Step, run.Kind)
+		log.Printf("workflow %s: %s", run.ID, msg)
+		if err := e.store.Finish(storeCtx, run, models.WorkflowFailed, msg); err != nil {
+			logStoreError(run, "record failure", err)
+		}
+		return
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, e.cfg.Lease)
+	defer cancel()
+
+	res, err := fn(stepCtx, run)
+	if err != nil {
+		var perm *permanentError
+		attempts := run.Attempts + 1
+		if errors.As(err, &perm) || attempts >= e.cfg.MaxAttempts {
+			log.Printf("workflow %s (%s order %s) failed at step %s after %d attempts: %v",
+				run.ID, run.Kind, run.OrderID, run.Step, attempts, err)
+			if err := e.store.Finish(storeCtx, run, models.WorkflowFailed, err.Error()); err != nil {
+				logStoreError(run, "record failure", err)
+				if errors.Is(err, models.ErrLeaseLost) {
+					// The run is being executed again elsewhere; it decides
+					// whether the run fails.
+					return
+				}
+			}
+			if onFail != nil {
+				onFail(storeCtx, run, err)
+			}
+			return
+		}
+		delay := e.backoff(attempts)
+		log.Printf("workflow %s (%s order %s) step %s attempt %d failed, retrying in %s: %v",
+			run.ID, run.Kind, run.OrderID, run.Step, attempts, delay, err)
+		if err := e.store.Retry(storeCtx, run, err.Error(), time.Now().Add(delay)); err != nil {
+			logStoreError(run, "record retry", err)
+		}
+		return
+	}
+
+	switch {
+	case res.done:
+		if err := e.store.Finish(storeCtx, run, models.WorkflowCompleted, ""); err != nil {
+			logStoreError(run, "record completion", err)
+		}
+	case res.next == "":
+		if err := e.store.Advance(storeCtx, run, run.Step, time.Now().Add(res.delay)); err != nil {
+			logStoreError(run, "reschedule step "+run.Step, err)
+		}
+	default:
+		if err := e.store.Advance(storeCtx, run, res.next, time.Now().Add(res.delay)); err != nil {
+			logStoreError(run, "advance to step "+res.next, err)
+			return
+		}
+		if res.delay == 0 {
+			e.Notify()
+		}
+	}
+}
+
+// logStoreError logs a failure to record the outcome of a step. A lost lease
+// means the step outlived its lease and the run was claimed again, so the
+// outcome is discarded in favour of the new holder's.
+func logStoreError(run *models.WorkflowRun, action string, err error) {
+	if errors.Is(err, models.ErrLeaseLost) {
+		log.Printf("workflow %s: %s: lease lost to another worker, discarding outcome of step %s",
+			run.ID, action, run.Step)
+		return
+	}
+	log.Printf("workflow %s: %s: %v", run.ID, action, err)
+}
+
+func (e *Engine) backoff(attempt int) time.Duration {
+	d := e.cfg.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > e.cfg.MaxBackoff {
+		d = e.cfg.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,99 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/srypher/mural-challenge-backend/internal/models"
+)
+
+func noop(context.Context, *models.WorkflowRun) (Result, error) {
+	return Complete(), nil
+}
+
+func TestBackoff(t *testing.T) {
+	e := NewEngine(nil, Config{BaseBackoff: time.Second, MaxBackoff: time.Minute})
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{40, time.Minute},
+		{200, time.Minute}, // the shift overflows
+	}
+	for _, tt := range tests {
+		if got := e.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	var c Config
+	c.setDefaults()
+	if c.PollInterval <= 0 || c.BatchSize <= 0 || c.Lease <= 0 || c.MaxAttempts <= 0 ||
+		c.BaseBackoff <= 0 || c.MaxBackoff < c.BaseBackoff {
+		t.Errorf("defaults not set: %+v", c)
+	}
+	c = Config{MaxAttempts: 3}
+	c.setDefaults()
+	if c.MaxAttempts != 3 {
+		t.Errorf("MaxAttempts overridden: %d", c.MaxAttempts)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+	cause := errors.New("bad destination")
+	err := Permanent(cause)
+	var perm *permanentError
+	if !errors.As(err, &perm) {
+		t.Error("Permanent error is not a permanentError")
+	}
+	if !errors.Is(err, cause) || err.Error() != cause.Error() {
+		t.Errorf("Permanent hides its cause: %v", err)
+	}
+}
+
+func TestNewRunStartsAtFirstRegisteredStep(t *testing.T) {
+	e := NewEngine(nil, Config{})
+	e.Register("payment", "await", noop)
+	e.Register("payment", "pay", noop)
+
+	orderID := uuid.New()
+	run, err := e.NewRun("payment", orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Kind != "payment" || run.Step != "await" || run.OrderID != orderID {
+		t.Errorf("NewRun = %+v", run)
+	}
+	if _, err := e.NewRun("refund", orderID); err == nil {
+		t.Error("NewRun of an unregistered kind succeeded")
+	}
+}
+
+func TestNotifyDoesNotBlock(t *testing.T) {
+	e := NewEngine(nil, Config{})
+	done := make(chan struct{})
+	go func() {
+		e.Notify()
+		e.Notify()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked with nobody running the engine")
+	}
+}